@@ -95,12 +95,13 @@ func main() {
 
 		for {
 			select {
-			case event, ok := <-subscriptions:
+			case delivery, ok := <-subscriptions:
 				if !ok {
 					break
 				}
 
-				log.Println(event.ID)
+				log.Println(delivery.Event.ID)
+				delivery.Ack()
 			case err, ok := <-errs:
 				if !ok {
 					break
@@ -19,19 +19,21 @@ type Event2 struct {
 const sleepTime = 100 * time.Millisecond
 
 func main() {
-	mediator := mediator.Create()
+	eventMediator := mediator.Create()
 	topic1 := es.Topic("topic1")
 	topic2 := es.Topic("topic2")
 
 	// Listeners
-	mediator.ListenTo(topic1, listener1)
-	mediator.Listen(universalListener1)
+	eventMediator.ListenTo(topic1, listener1, mediator.ContinueOnFailure())
+	eventMediator.Listen(universalListener1, mediator.ContinueOnFailure())
 
 	// Connectors
-	connector1 := mediator.ChannelTo(topic2)
+	connector1, subscription1 := eventMediator.ChannelTo(topic2)
 	connector1Func := func() {
-		data := <-connector1
-		log.Println("connector1:", data)
+		// The connector is closed when the subscription is cancelled
+		for data := range connector1 {
+			log.Println("connector1:", data)
+		}
 	}
 
 	go connector1Func()
@@ -45,17 +47,27 @@ func main() {
 	}
 
 	// Publish
-	mediator.Publish(es.SubjectID("me"), event1)
-	mediator.Publish(es.SubjectID("me"), event2)
+	if err := eventMediator.Publish(es.SubjectID("me"), event1); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := eventMediator.Publish(es.SubjectID("me"), event2); err != nil {
+		log.Fatal(err)
+	}
 
 	// We sleep in this example to ensure the channel has received the event data
 	time.Sleep(sleepTime)
+	subscription1.Cancel()
 }
 
-func listener1(subject es.SubjectID, data es.Data) {
+func listener1(subject es.SubjectID, data es.Data) error {
 	log.Println("listener1:", data)
+
+	return nil
 }
 
-func universalListener1(subject es.SubjectID, data es.Data) {
+func universalListener1(subject es.SubjectID, data es.Data) error {
 	log.Println("universalListener1:", data)
+
+	return nil
 }
@@ -1,9 +1,24 @@
 package main
 
 import (
+	"flag"
+
 	"github.com/hywmongous/example-service/internal/presentation/gin"
 )
 
 func main() {
+	mailDirectory := flag.String(
+		"dev-mail-directory",
+		"",
+		"write the emails to the directory instead of failing to send them, for development only",
+	)
+	flag.Parse()
+
+	if *mailDirectory != "" {
+		gin.RunDevelopment(*mailDirectory)
+
+		return
+	}
+
 	gin.Run()
 }
@@ -0,0 +1,120 @@
+package application
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/infrastructure"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+)
+
+var ErrUnexpectedRequest = errors.New("use case received a request of an unexpected type")
+
+// BusFactory creates the bus through which the presentation layer calls the use cases.
+func BusFactory(
+	createUnitOfWork infrastructure.UnitOfWorkCreator,
+	unregisteredUser UnregisteredUser,
+	registeredUser RegisteredUser,
+) (*mediator.Bus, error) {
+	bus := mediator.CreateBus()
+	bus.Use(
+		infrastructure.TracingBehaviour,
+		infrastructure.LoggingBehaviour,
+		mediator.ValidationBehaviour,
+		// Registering again is not retried as it would register the identity twice
+		infrastructure.RetryBehaviour(
+			infrastructure.DefaultRetryOptions(),
+			&LoginIdentityRequest{},
+			&LogoutIdentityRequest{},
+			&ConfirmIdentityEmailRequest{},
+			&ChangeIdentityPasswordRequest{},
+			&ForgotIdentityPasswordRequest{},
+			&ResetIdentityPasswordRequest{},
+		),
+		infrastructure.UnitOfWorkBehaviour(createUnitOfWork),
+	)
+
+	registrations := []struct {
+		request mediator.Request
+		handler mediator.RequestHandler
+	}{
+		{
+			request: &RegisterIdentityRequest{},
+			handler: func(ctx context.Context, request mediator.Request) (mediator.Response, error) {
+				if request, ok := request.(*RegisterIdentityRequest); ok {
+					return unregisteredUser.Register(ctx, request)
+				}
+
+				return nil, ErrUnexpectedRequest
+			},
+		},
+		{
+			request: &LoginIdentityRequest{},
+			handler: func(ctx context.Context, request mediator.Request) (mediator.Response, error) {
+				if request, ok := request.(*LoginIdentityRequest); ok {
+					return registeredUser.Login(ctx, request)
+				}
+
+				return nil, ErrUnexpectedRequest
+			},
+		},
+		{
+			request: &LogoutIdentityRequest{},
+			handler: func(ctx context.Context, request mediator.Request) (mediator.Response, error) {
+				if request, ok := request.(*LogoutIdentityRequest); ok {
+					return registeredUser.Logout(ctx, request)
+				}
+
+				return nil, ErrUnexpectedRequest
+			},
+		},
+		{
+			request: &ConfirmIdentityEmailRequest{},
+			handler: func(ctx context.Context, request mediator.Request) (mediator.Response, error) {
+				if request, ok := request.(*ConfirmIdentityEmailRequest); ok {
+					return unregisteredUser.ConfirmEmail(ctx, request)
+				}
+
+				return nil, ErrUnexpectedRequest
+			},
+		},
+		{
+			request: &ChangeIdentityPasswordRequest{},
+			handler: func(ctx context.Context, request mediator.Request) (mediator.Response, error) {
+				if request, ok := request.(*ChangeIdentityPasswordRequest); ok {
+					return registeredUser.ChangePassword(ctx, request)
+				}
+
+				return nil, ErrUnexpectedRequest
+			},
+		},
+		{
+			request: &ForgotIdentityPasswordRequest{},
+			handler: func(ctx context.Context, request mediator.Request) (mediator.Response, error) {
+				if request, ok := request.(*ForgotIdentityPasswordRequest); ok {
+					return registeredUser.ForgotPassword(ctx, request)
+				}
+
+				return nil, ErrUnexpectedRequest
+			},
+		},
+		{
+			request: &ResetIdentityPasswordRequest{},
+			handler: func(ctx context.Context, request mediator.Request) (mediator.Response, error) {
+				if request, ok := request.(*ResetIdentityPasswordRequest); ok {
+					return registeredUser.ResetPassword(ctx, request)
+				}
+
+				return nil, ErrUnexpectedRequest
+			},
+		},
+	}
+
+	for _, registration := range registrations {
+		if err := bus.Register(registration.request, registration.handler); err != nil {
+			return nil, err
+		}
+	}
+
+	return bus, nil
+}
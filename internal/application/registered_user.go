@@ -2,52 +2,87 @@ package application
 
 import (
 	"context"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/hywmongous/example-service/internal/domain/authentication"
 	"github.com/hywmongous/example-service/internal/infrastructure"
 	"github.com/hywmongous/example-service/internal/infrastructure/jaeger"
+	"github.com/hywmongous/example-service/internal/infrastructure/services"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/scheduler"
 )
 
 type RegisteredUser struct {
-	uow infrastructure.UnitOfWork
+	scheduler         *scheduler.Scheduler
+	loginPolicy       authentication.LoginPolicy
+	passwordPolicy    authentication.PasswordPolicy
+	jwtService        services.JWTService
+	sendPasswordReset services.PasswordResetSender
 }
 
 var (
-	ErrCouldNotFindIdentity   = errors.New("identity could not be found by email")
-	ErrLoginFailed            = errors.New("identity login failed")
-	ErrLoginFailedCommitting  = errors.New("identity login failed")
-	ErrLogoutFailed           = errors.New("identity logout failed")
-	ErrLogoutFailedCommitting = errors.New("identity logout failed")
+	ErrCouldNotFindIdentity     = errors.New("identity could not be found by email")
+	ErrLoginFailed              = errors.New("identity login failed")
+	ErrLogoutFailed             = errors.New("identity logout failed")
+	ErrPasswordChangeFailed     = errors.New("identity password change failed")
+	ErrPasswordResetFailed      = errors.New("identity password reset failed")
+	ErrIdentityMismatch         = errors.New("request does not concern the identity of the session")
+	ErrCouldNotCancelExpiration = errors.New("session expiration could not be cancelled")
 )
 
+// RegisteredUserFactory creates the use cases of registered users. Sessions
+// are logged out by the scheduler once the refresh tokens can no longer renew them.
 func RegisteredUserFactory(
-	uow infrastructure.UnitOfWork,
-) RegisteredUser {
-	return RegisteredUser{
-		uow: uow,
+	scheduler *scheduler.Scheduler,
+	loginPolicy authentication.LoginPolicy,
+	passwordPolicy authentication.PasswordPolicy,
+	jwtService services.JWTService,
+	sendPasswordReset services.PasswordResetSender,
+) (RegisteredUser, error) {
+	if err := scheduler.Register(&LogoutIdentityRequest{}); err != nil {
+		return RegisteredUser{}, err
 	}
+
+	return RegisteredUser{
+		scheduler:         scheduler,
+		loginPolicy:       loginPolicy,
+		passwordPolicy:    passwordPolicy,
+		jwtService:        jwtService,
+		sendPasswordReset: sendPasswordReset,
+	}, nil
 }
 
 func (user RegisteredUser) Login(ctx context.Context, request *LoginIdentityRequest) (*LoginIdentityResponse, error) {
-	span, ctx := jaeger.StartSpanFromSpanContext(ctx, "Login")
+	span, _ := jaeger.StartSpanFromSpanContext(ctx, "Login")
 	defer span.Finish()
 
-	defer user.uow.Clear()
+	uow, err := infrastructure.UnitOfWorkFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	me, err := user.uow.IdentityRepository().FindIdentityByEmail(request.Email)
+	me, err := uow.IdentityRepository().FindIdentityByEmail(request.Email)
 	if err != nil {
 		return nil, errors.Wrap(err, ErrCouldNotFindIdentity.Error())
 	}
 
-	sessionID, err := me.Login(request.Password)
+	sessionID, err := me.Login(request.Password, user.loginPolicy)
 	if err != nil {
 		return nil, errors.Wrap(err, ErrLoginFailed.Error())
 	}
 
-	if err = user.uow.Commit(ctx); err != nil {
-		return nil, errors.Wrap(err, ErrLoginFailedCommitting.Error())
-	}
+	// The session only expires if the login is committed
+	uow.OnCommitted(func(ctx context.Context, events []es.Event) error {
+		return user.scheduler.ScheduleCommand(
+			sessionExpiry(sessionID),
+			time.Now().Add(services.RefreshTokenAbsoluteTimeoutDuration),
+			&LogoutIdentityRequest{
+				Email:     request.Email,
+				SessionID: string(sessionID),
+			},
+		)
+	})
 
 	return &LoginIdentityResponse{
 		SessionID: string(sessionID),
@@ -58,26 +93,183 @@ func (user RegisteredUser) Logout(
 	ctx context.Context,
 	request *LogoutIdentityRequest,
 ) (*LogoutIdentityResponse, error) {
-	span, ctx := jaeger.StartSpanFromSpanContext(ctx, "Logout")
+	span, _ := jaeger.StartSpanFromSpanContext(ctx, "Logout")
 	defer span.Finish()
 
-	defer user.uow.Clear()
+	uow, err := infrastructure.UnitOfWorkFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	me, err := user.uow.IdentityRepository().FindIdentityByEmail(request.Email)
+	me, err := uow.IdentityRepository().FindIdentityByEmail(request.Email)
 	if err != nil {
 		return nil, errors.Wrap(err, ErrCouldNotFindIdentity.Error())
 	}
 
-	err = me.Logout(authentication.SessionID(request.SessionID))
+	sessionID := authentication.SessionID(request.SessionID)
+
+	err = me.Logout(sessionID)
 	if err != nil {
-		return nil, errors.Wrap(err, ErrLoginFailed.Error())
+		return nil, errors.Wrap(err, ErrLogoutFailed.Error())
 	}
 
-	if err = user.uow.Commit(ctx); err != nil {
-		return nil, errors.Wrap(err, ErrLogoutFailedCommitting.Error())
-	}
+	// Sessions which are logged out no longer have to expire, unless
+	// the expiry of the session is what is logging it out
+	uow.OnCommitted(func(ctx context.Context, events []es.Event) error {
+		return user.cancelExpiries([]authentication.SessionID{sessionID}, "logged out")
+	})
 
 	return &LogoutIdentityResponse{
 		Revoked: true,
 	}, nil
 }
+
+// ChangePassword changes the password of the identity of the session, which
+// must know the current password. The other sessions of the identity are revoked.
+func (user RegisteredUser) ChangePassword(
+	ctx context.Context,
+	request *ChangeIdentityPasswordRequest,
+) (*ChangeIdentityPasswordResponse, error) {
+	span, _ := jaeger.StartSpanFromSpanContext(ctx, "ChangePassword")
+	defer span.Finish()
+
+	uow, err := infrastructure.UnitOfWorkFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	me, err := uow.IdentityRepository().FindIdentityByEmail(request.Email)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotFindIdentity.Error())
+	}
+
+	if me.ID() != authentication.IdentityID(request.IdentityID) {
+		return nil, ErrIdentityMismatch
+	}
+
+	revoked, err := me.ChangePassword(
+		request.CurrentPassword,
+		request.NewPassword,
+		user.passwordPolicy,
+		authentication.SessionID(request.SessionID),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrPasswordChangeFailed.Error())
+	}
+
+	uow.OnCommitted(func(ctx context.Context, events []es.Event) error {
+		return user.cancelExpiries(revoked, "password changed")
+	})
+
+	return &ChangeIdentityPasswordResponse{
+		RevokedSessions: int32(len(revoked)),
+	}, nil
+}
+
+// ForgotPassword sends a reset token to the email, if it is the email of an
+// identity. The response is the same either way, such that it cannot be used
+// to find out whether an email is registered.
+func (user RegisteredUser) ForgotPassword(
+	ctx context.Context,
+	request *ForgotIdentityPasswordRequest,
+) (*ForgotIdentityPasswordResponse, error) {
+	span, _ := jaeger.StartSpanFromSpanContext(ctx, "ForgotPassword")
+	defer span.Finish()
+
+	uow, err := infrastructure.UnitOfWorkFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ForgotIdentityPasswordResponse{
+		Requested: true,
+	}
+
+	me, err := uow.IdentityRepository().FindIdentityByEmail(request.Email)
+	if errors.IsAny(err, es.ErrNoEvents, authentication.ErrIdentityHasNoEvents) {
+		return response, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotFindIdentity.Error())
+	}
+
+	resetID, err := me.RequestPasswordReset()
+	if err != nil {
+		return nil, errors.Wrap(err, ErrPasswordResetFailed.Error())
+	}
+
+	// The token is only sent once the reset is committed, otherwise it could not be used
+	uow.OnCommitted(func(ctx context.Context, events []es.Event) error {
+		token, err := user.jwtService.SignPasswordReset(me.Email().Address(), string(resetID))
+		if err != nil {
+			return err
+		}
+
+		return user.sendPasswordReset(ctx, me.Email().Address(), token)
+	})
+
+	return response, nil
+}
+
+// ResetPassword sets the password of the identity which the reset token was
+// sent to. The token is the proof, so resetting does not require a session,
+// and all the sessions of the identity are revoked.
+func (user RegisteredUser) ResetPassword(
+	ctx context.Context,
+	request *ResetIdentityPasswordRequest,
+) (*ResetIdentityPasswordResponse, error) {
+	span, _ := jaeger.StartSpanFromSpanContext(ctx, "ResetPassword")
+	defer span.Finish()
+
+	uow, err := infrastructure.UnitOfWorkFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	email, resetID, err := user.jwtService.VerifyPasswordReset(request.Token)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrPasswordResetFailed.Error())
+	}
+
+	me, err := uow.IdentityRepository().FindIdentityByEmail(email)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotFindIdentity.Error())
+	}
+
+	revoked, err := me.ResetPassword(
+		authentication.PasswordResetID(resetID),
+		request.NewPassword,
+		user.passwordPolicy,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrPasswordResetFailed.Error())
+	}
+
+	uow.OnCommitted(func(ctx context.Context, events []es.Event) error {
+		return user.cancelExpiries(revoked, "password reset")
+	})
+
+	return &ResetIdentityPasswordResponse{
+		RevokedSessions: int32(len(revoked)),
+	}, nil
+}
+
+// cancelExpiries cancels the expiries of the sessions which are revoked.
+// Expiries which already fired or were cancelled are ignored.
+func (user RegisteredUser) cancelExpiries(sessionIDs []authentication.SessionID, reason string) error {
+	var errs error
+
+	for _, sessionID := range sessionIDs {
+		err := user.scheduler.Cancel(sessionExpiry(sessionID), reason)
+		if err != nil && !errors.IsAny(err, scheduler.ErrScheduleNotPending, scheduler.ErrScheduleNotFound) {
+			errs = errors.CombineErrors(errs, errors.Wrap(err, ErrCouldNotCancelExpiration.Error()))
+		}
+	}
+
+	return errs
+}
+
+func sessionExpiry(sessionID authentication.SessionID) scheduler.ID {
+	return scheduler.ID("session-expiry/" + string(sessionID))
+}
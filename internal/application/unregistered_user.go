@@ -7,22 +7,32 @@ import (
 	"github.com/hywmongous/example-service/internal/domain/authentication"
 	"github.com/hywmongous/example-service/internal/infrastructure"
 	"github.com/hywmongous/example-service/internal/infrastructure/jaeger"
+	"github.com/hywmongous/example-service/internal/infrastructure/services"
+	"github.com/hywmongous/example-service/pkg/es"
 )
 
 type UnregisteredUser struct {
-	uow infrastructure.UnitOfWork
+	passwordPolicy   authentication.PasswordPolicy
+	jwtService       services.JWTService
+	sendConfirmation services.ConfirmationSender
 }
 
 var (
-	ErrRegistrationFailed           = errors.New("identity registration failed")
-	ErrRegistrationFailedCommitting = errors.New("identity registration failed committing")
+	ErrRegistrationFailed      = errors.New("identity registration failed")
+	ErrEmailConfirmationFailed = errors.New("identity email confirmation failed")
 )
 
+// UnregisteredUserFactory creates the use cases of users without a session.
+// Registered identities are sent a token which confirms their email.
 func UnregisteredUserFactory(
-	uow infrastructure.UnitOfWork,
+	passwordPolicy authentication.PasswordPolicy,
+	jwtService services.JWTService,
+	sendConfirmation services.ConfirmationSender,
 ) UnregisteredUser {
 	return UnregisteredUser{
-		uow: uow,
+		passwordPolicy:   passwordPolicy,
+		jwtService:       jwtService,
+		sendConfirmation: sendConfirmation,
 	}
 }
 
@@ -30,25 +40,70 @@ func (user UnregisteredUser) Register(
 	ctx context.Context,
 	request *RegisterIdentityRequest,
 ) (*RegisterIdentityResponse, error) {
-	span, ctx := jaeger.StartSpanFromSpanContext(ctx, "Register")
+	span, _ := jaeger.StartSpanFromSpanContext(ctx, "Register")
 	defer span.Finish()
 
-	defer user.uow.Clear()
+	uow, err := infrastructure.UnitOfWorkFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	identity, err := authentication.Register(
 		request.Email,
 		request.Password,
-		user.uow.Mediator(),
+		uow.EmailPolicy(),
+		user.passwordPolicy,
 	)
 	if err != nil {
 		return nil, errors.Wrap(err, ErrRegistrationFailed.Error())
 	}
 
-	if err = user.uow.Commit(ctx); err != nil {
-		return nil, errors.Wrap(err, ErrRegistrationFailedCommitting.Error())
-	}
+	uow.IdentityRepository().Add(identity)
+
+	// The email is only confirmed for identities which are committed
+	uow.OnCommitted(func(ctx context.Context, events []es.Event) error {
+		token, err := user.jwtService.SignEmailConfirmation(identity.Email().Address())
+		if err != nil {
+			return err
+		}
+
+		return user.sendConfirmation(ctx, identity.Email().Address(), token)
+	})
 
 	return &RegisterIdentityResponse{
 		Id: string(identity.ID()),
 	}, nil
 }
+
+// ConfirmEmail confirms the email which the token was sent to. The token
+// is the proof, so confirming does not require a session.
+func (user UnregisteredUser) ConfirmEmail(
+	ctx context.Context,
+	request *ConfirmIdentityEmailRequest,
+) (*ConfirmIdentityEmailResponse, error) {
+	span, _ := jaeger.StartSpanFromSpanContext(ctx, "ConfirmEmail")
+	defer span.Finish()
+
+	uow, err := infrastructure.UnitOfWorkFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	email, err := user.jwtService.VerifyEmailConfirmation(request.Token)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrEmailConfirmationFailed.Error())
+	}
+
+	identity, err := uow.IdentityRepository().FindIdentityByEmail(email)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotFindIdentity.Error())
+	}
+
+	if err := identity.ConfirmEmail(email); err != nil {
+		return nil, errors.Wrap(err, ErrEmailConfirmationFailed.Error())
+	}
+
+	return &ConfirmIdentityEmailResponse{
+		Confirmed: true,
+	}, nil
+}
@@ -3,7 +3,11 @@ package application
 import "context"
 
 type (
-	IdentityLoginUseCase    func(ctx context.Context, request *LoginIdentityRequest) (*LoginIdentityResponse, error)
-	IdentityLogoutUseCase   func(ctx context.Context, request *LogoutIdentityRequest) (*LogoutIdentityResponse, error)
-	RegisterIdentityUseCase func(ctx context.Context, request *RegisterIdentityRequest) (*RegisterIdentityResponse, error)
+	IdentityLoginUseCase          func(ctx context.Context, request *LoginIdentityRequest) (*LoginIdentityResponse, error)
+	IdentityLogoutUseCase         func(ctx context.Context, request *LogoutIdentityRequest) (*LogoutIdentityResponse, error)
+	RegisterIdentityUseCase       func(ctx context.Context, request *RegisterIdentityRequest) (*RegisterIdentityResponse, error)
+	ConfirmIdentityEmailUseCase   func(ctx context.Context, request *ConfirmIdentityEmailRequest) (*ConfirmIdentityEmailResponse, error)
+	ChangeIdentityPasswordUseCase func(ctx context.Context, request *ChangeIdentityPasswordRequest) (*ChangeIdentityPasswordResponse, error)
+	ForgotIdentityPasswordUseCase func(ctx context.Context, request *ForgotIdentityPasswordRequest) (*ForgotIdentityPasswordResponse, error)
+	ResetIdentityPasswordUseCase  func(ctx context.Context, request *ResetIdentityPasswordRequest) (*ResetIdentityPasswordResponse, error)
 )
@@ -0,0 +1,321 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.14.0
+// source: usecases.proto
+
+package application
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// IdentityUseCasesClient is the client API for IdentityUseCases service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type IdentityUseCasesClient interface {
+	RegisterIdentity(ctx context.Context, in *RegisterIdentityRequest, opts ...grpc.CallOption) (*RegisterIdentityResponse, error)
+	LoginIdentity(ctx context.Context, in *LoginIdentityRequest, opts ...grpc.CallOption) (*LoginIdentityResponse, error)
+	LogoutIdentity(ctx context.Context, in *LogoutIdentityRequest, opts ...grpc.CallOption) (*LogoutIdentityResponse, error)
+	ConfirmIdentityEmail(ctx context.Context, in *ConfirmIdentityEmailRequest, opts ...grpc.CallOption) (*ConfirmIdentityEmailResponse, error)
+	ChangeIdentityPassword(ctx context.Context, in *ChangeIdentityPasswordRequest, opts ...grpc.CallOption) (*ChangeIdentityPasswordResponse, error)
+	ForgotIdentityPassword(ctx context.Context, in *ForgotIdentityPasswordRequest, opts ...grpc.CallOption) (*ForgotIdentityPasswordResponse, error)
+	ResetIdentityPassword(ctx context.Context, in *ResetIdentityPasswordRequest, opts ...grpc.CallOption) (*ResetIdentityPasswordResponse, error)
+}
+
+type identityUseCasesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIdentityUseCasesClient(cc grpc.ClientConnInterface) IdentityUseCasesClient {
+	return &identityUseCasesClient{cc}
+}
+
+func (c *identityUseCasesClient) RegisterIdentity(ctx context.Context, in *RegisterIdentityRequest, opts ...grpc.CallOption) (*RegisterIdentityResponse, error) {
+	out := new(RegisterIdentityResponse)
+	err := c.cc.Invoke(ctx, "/application.IdentityUseCases/RegisterIdentity", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *identityUseCasesClient) LoginIdentity(ctx context.Context, in *LoginIdentityRequest, opts ...grpc.CallOption) (*LoginIdentityResponse, error) {
+	out := new(LoginIdentityResponse)
+	err := c.cc.Invoke(ctx, "/application.IdentityUseCases/LoginIdentity", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *identityUseCasesClient) LogoutIdentity(ctx context.Context, in *LogoutIdentityRequest, opts ...grpc.CallOption) (*LogoutIdentityResponse, error) {
+	out := new(LogoutIdentityResponse)
+	err := c.cc.Invoke(ctx, "/application.IdentityUseCases/LogoutIdentity", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *identityUseCasesClient) ConfirmIdentityEmail(ctx context.Context, in *ConfirmIdentityEmailRequest, opts ...grpc.CallOption) (*ConfirmIdentityEmailResponse, error) {
+	out := new(ConfirmIdentityEmailResponse)
+	err := c.cc.Invoke(ctx, "/application.IdentityUseCases/ConfirmIdentityEmail", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *identityUseCasesClient) ChangeIdentityPassword(ctx context.Context, in *ChangeIdentityPasswordRequest, opts ...grpc.CallOption) (*ChangeIdentityPasswordResponse, error) {
+	out := new(ChangeIdentityPasswordResponse)
+	err := c.cc.Invoke(ctx, "/application.IdentityUseCases/ChangeIdentityPassword", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *identityUseCasesClient) ForgotIdentityPassword(ctx context.Context, in *ForgotIdentityPasswordRequest, opts ...grpc.CallOption) (*ForgotIdentityPasswordResponse, error) {
+	out := new(ForgotIdentityPasswordResponse)
+	err := c.cc.Invoke(ctx, "/application.IdentityUseCases/ForgotIdentityPassword", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *identityUseCasesClient) ResetIdentityPassword(ctx context.Context, in *ResetIdentityPasswordRequest, opts ...grpc.CallOption) (*ResetIdentityPasswordResponse, error) {
+	out := new(ResetIdentityPasswordResponse)
+	err := c.cc.Invoke(ctx, "/application.IdentityUseCases/ResetIdentityPassword", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// IdentityUseCasesServer is the server API for IdentityUseCases service.
+// All implementations must embed UnimplementedIdentityUseCasesServer
+// for forward compatibility
+type IdentityUseCasesServer interface {
+	RegisterIdentity(context.Context, *RegisterIdentityRequest) (*RegisterIdentityResponse, error)
+	LoginIdentity(context.Context, *LoginIdentityRequest) (*LoginIdentityResponse, error)
+	LogoutIdentity(context.Context, *LogoutIdentityRequest) (*LogoutIdentityResponse, error)
+	ConfirmIdentityEmail(context.Context, *ConfirmIdentityEmailRequest) (*ConfirmIdentityEmailResponse, error)
+	ChangeIdentityPassword(context.Context, *ChangeIdentityPasswordRequest) (*ChangeIdentityPasswordResponse, error)
+	ForgotIdentityPassword(context.Context, *ForgotIdentityPasswordRequest) (*ForgotIdentityPasswordResponse, error)
+	ResetIdentityPassword(context.Context, *ResetIdentityPasswordRequest) (*ResetIdentityPasswordResponse, error)
+	mustEmbedUnimplementedIdentityUseCasesServer()
+}
+
+// UnimplementedIdentityUseCasesServer must be embedded to have forward compatible implementations.
+type UnimplementedIdentityUseCasesServer struct {
+}
+
+func (UnimplementedIdentityUseCasesServer) RegisterIdentity(context.Context, *RegisterIdentityRequest) (*RegisterIdentityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterIdentity not implemented")
+}
+func (UnimplementedIdentityUseCasesServer) LoginIdentity(context.Context, *LoginIdentityRequest) (*LoginIdentityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LoginIdentity not implemented")
+}
+func (UnimplementedIdentityUseCasesServer) LogoutIdentity(context.Context, *LogoutIdentityRequest) (*LogoutIdentityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LogoutIdentity not implemented")
+}
+func (UnimplementedIdentityUseCasesServer) ConfirmIdentityEmail(context.Context, *ConfirmIdentityEmailRequest) (*ConfirmIdentityEmailResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfirmIdentityEmail not implemented")
+}
+func (UnimplementedIdentityUseCasesServer) ChangeIdentityPassword(context.Context, *ChangeIdentityPasswordRequest) (*ChangeIdentityPasswordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeIdentityPassword not implemented")
+}
+func (UnimplementedIdentityUseCasesServer) ForgotIdentityPassword(context.Context, *ForgotIdentityPasswordRequest) (*ForgotIdentityPasswordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ForgotIdentityPassword not implemented")
+}
+func (UnimplementedIdentityUseCasesServer) ResetIdentityPassword(context.Context, *ResetIdentityPasswordRequest) (*ResetIdentityPasswordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetIdentityPassword not implemented")
+}
+func (UnimplementedIdentityUseCasesServer) mustEmbedUnimplementedIdentityUseCasesServer() {}
+
+// UnsafeIdentityUseCasesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IdentityUseCasesServer will
+// result in compilation errors.
+type UnsafeIdentityUseCasesServer interface {
+	mustEmbedUnimplementedIdentityUseCasesServer()
+}
+
+func RegisterIdentityUseCasesServer(s grpc.ServiceRegistrar, srv IdentityUseCasesServer) {
+	s.RegisterService(&IdentityUseCases_ServiceDesc, srv)
+}
+
+func _IdentityUseCases_RegisterIdentity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterIdentityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IdentityUseCasesServer).RegisterIdentity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/application.IdentityUseCases/RegisterIdentity",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IdentityUseCasesServer).RegisterIdentity(ctx, req.(*RegisterIdentityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IdentityUseCases_LoginIdentity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginIdentityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IdentityUseCasesServer).LoginIdentity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/application.IdentityUseCases/LoginIdentity",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IdentityUseCasesServer).LoginIdentity(ctx, req.(*LoginIdentityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IdentityUseCases_LogoutIdentity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogoutIdentityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IdentityUseCasesServer).LogoutIdentity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/application.IdentityUseCases/LogoutIdentity",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IdentityUseCasesServer).LogoutIdentity(ctx, req.(*LogoutIdentityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IdentityUseCases_ConfirmIdentityEmail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfirmIdentityEmailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IdentityUseCasesServer).ConfirmIdentityEmail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/application.IdentityUseCases/ConfirmIdentityEmail",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IdentityUseCasesServer).ConfirmIdentityEmail(ctx, req.(*ConfirmIdentityEmailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IdentityUseCases_ChangeIdentityPassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeIdentityPasswordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IdentityUseCasesServer).ChangeIdentityPassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/application.IdentityUseCases/ChangeIdentityPassword",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IdentityUseCasesServer).ChangeIdentityPassword(ctx, req.(*ChangeIdentityPasswordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IdentityUseCases_ForgotIdentityPassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ForgotIdentityPasswordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IdentityUseCasesServer).ForgotIdentityPassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/application.IdentityUseCases/ForgotIdentityPassword",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IdentityUseCasesServer).ForgotIdentityPassword(ctx, req.(*ForgotIdentityPasswordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IdentityUseCases_ResetIdentityPassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResetIdentityPasswordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IdentityUseCasesServer).ResetIdentityPassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/application.IdentityUseCases/ResetIdentityPassword",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IdentityUseCasesServer).ResetIdentityPassword(ctx, req.(*ResetIdentityPasswordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// IdentityUseCases_ServiceDesc is the grpc.ServiceDesc for IdentityUseCases service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var IdentityUseCases_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "application.IdentityUseCases",
+	HandlerType: (*IdentityUseCasesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RegisterIdentity",
+			Handler:    _IdentityUseCases_RegisterIdentity_Handler,
+		},
+		{
+			MethodName: "LoginIdentity",
+			Handler:    _IdentityUseCases_LoginIdentity_Handler,
+		},
+		{
+			MethodName: "LogoutIdentity",
+			Handler:    _IdentityUseCases_LogoutIdentity_Handler,
+		},
+		{
+			MethodName: "ConfirmIdentityEmail",
+			Handler:    _IdentityUseCases_ConfirmIdentityEmail_Handler,
+		},
+		{
+			MethodName: "ChangeIdentityPassword",
+			Handler:    _IdentityUseCases_ChangeIdentityPassword_Handler,
+		},
+		{
+			MethodName: "ForgotIdentityPassword",
+			Handler:    _IdentityUseCases_ForgotIdentityPassword_Handler,
+		},
+		{
+			MethodName: "ResetIdentityPassword",
+			Handler:    _IdentityUseCases_ResetIdentityPassword_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "usecases.proto",
+}
@@ -0,0 +1,100 @@
+package application
+
+import "github.com/cockroachdb/errors"
+
+var (
+	ErrMissingEmail       = errors.New("request must have an email")
+	ErrMissingPassword    = errors.New("request must have a password")
+	ErrMissingSessionID   = errors.New("request must have a session id")
+	ErrMissingToken       = errors.New("request must have a token")
+	ErrMissingIdentity    = errors.New("request must have an identity id")
+	ErrMissingNewPassword = errors.New("request must have a new password")
+)
+
+func (request *RegisterIdentityRequest) Validate() error {
+	if request.Email == "" {
+		return ErrMissingEmail
+	}
+
+	if request.Password == "" {
+		return ErrMissingPassword
+	}
+
+	return nil
+}
+
+func (request *LoginIdentityRequest) Validate() error {
+	if request.Email == "" {
+		return ErrMissingEmail
+	}
+
+	if request.Password == "" {
+		return ErrMissingPassword
+	}
+
+	return nil
+}
+
+func (request *LogoutIdentityRequest) Validate() error {
+	if request.Email == "" {
+		return ErrMissingEmail
+	}
+
+	if request.SessionID == "" {
+		return ErrMissingSessionID
+	}
+
+	return nil
+}
+
+func (request *ConfirmIdentityEmailRequest) Validate() error {
+	if request.Token == "" {
+		return ErrMissingToken
+	}
+
+	return nil
+}
+
+func (request *ChangeIdentityPasswordRequest) Validate() error {
+	if request.IdentityID == "" {
+		return ErrMissingIdentity
+	}
+
+	if request.Email == "" {
+		return ErrMissingEmail
+	}
+
+	if request.SessionID == "" {
+		return ErrMissingSessionID
+	}
+
+	if request.CurrentPassword == "" {
+		return ErrMissingPassword
+	}
+
+	if request.NewPassword == "" {
+		return ErrMissingNewPassword
+	}
+
+	return nil
+}
+
+func (request *ForgotIdentityPasswordRequest) Validate() error {
+	if request.Email == "" {
+		return ErrMissingEmail
+	}
+
+	return nil
+}
+
+func (request *ResetIdentityPasswordRequest) Validate() error {
+	if request.Token == "" {
+		return ErrMissingToken
+	}
+
+	if request.NewPassword == "" {
+		return ErrMissingNewPassword
+	}
+
+	return nil
+}
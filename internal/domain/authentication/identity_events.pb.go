@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.25.0-devel
+// 	protoc-gen-go v1.27.1
 // 	protoc        v3.14.0
 // source: identity_events.proto
 
@@ -178,6 +178,155 @@ func (x *IdentityLoggedOut) GetSessionID() string {
 	return ""
 }
 
+type IdentityEmailConfirmed struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Email string `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
+}
+
+func (x *IdentityEmailConfirmed) Reset() {
+	*x = IdentityEmailConfirmed{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_identity_events_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IdentityEmailConfirmed) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IdentityEmailConfirmed) ProtoMessage() {}
+
+func (x *IdentityEmailConfirmed) ProtoReflect() protoreflect.Message {
+	mi := &file_identity_events_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IdentityEmailConfirmed.ProtoReflect.Descriptor instead.
+func (*IdentityEmailConfirmed) Descriptor() ([]byte, []int) {
+	return file_identity_events_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *IdentityEmailConfirmed) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+type IdentityPasswordResetRequested struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ResetID string `protobuf:"bytes,1,opt,name=resetID,proto3" json:"resetID,omitempty"`
+}
+
+func (x *IdentityPasswordResetRequested) Reset() {
+	*x = IdentityPasswordResetRequested{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_identity_events_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IdentityPasswordResetRequested) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IdentityPasswordResetRequested) ProtoMessage() {}
+
+func (x *IdentityPasswordResetRequested) ProtoReflect() protoreflect.Message {
+	mi := &file_identity_events_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IdentityPasswordResetRequested.ProtoReflect.Descriptor instead.
+func (*IdentityPasswordResetRequested) Descriptor() ([]byte, []int) {
+	return file_identity_events_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *IdentityPasswordResetRequested) GetResetID() string {
+	if x != nil {
+		return x.ResetID
+	}
+	return ""
+}
+
+type IdentityPasswordChanged struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Passwordhash string `protobuf:"bytes,1,opt,name=passwordhash,proto3" json:"passwordhash,omitempty"`
+	ResetID      string `protobuf:"bytes,2,opt,name=resetID,proto3" json:"resetID,omitempty"`
+}
+
+func (x *IdentityPasswordChanged) Reset() {
+	*x = IdentityPasswordChanged{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_identity_events_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IdentityPasswordChanged) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IdentityPasswordChanged) ProtoMessage() {}
+
+func (x *IdentityPasswordChanged) ProtoReflect() protoreflect.Message {
+	mi := &file_identity_events_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IdentityPasswordChanged.ProtoReflect.Descriptor instead.
+func (*IdentityPasswordChanged) Descriptor() ([]byte, []int) {
+	return file_identity_events_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *IdentityPasswordChanged) GetPasswordhash() string {
+	if x != nil {
+		return x.Passwordhash
+	}
+	return ""
+}
+
+func (x *IdentityPasswordChanged) GetResetID() string {
+	if x != nil {
+		return x.ResetID
+	}
+	return ""
+}
+
 var File_identity_events_proto protoreflect.FileDescriptor
 
 var file_identity_events_proto_rawDesc = []byte{
@@ -195,9 +344,22 @@ var file_identity_events_proto_rawDesc = []byte{
 	0x6e, 0x49, 0x44, 0x22, 0x31, 0x0a, 0x11, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x4c,
 	0x6f, 0x67, 0x67, 0x65, 0x64, 0x4f, 0x75, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x65, 0x73, 0x73,
 	0x69, 0x6f, 0x6e, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x73, 0x65, 0x73,
-	0x73, 0x69, 0x6f, 0x6e, 0x49, 0x44, 0x42, 0x1d, 0x5a, 0x1b, 0x2e, 0x2e, 0x2f, 0x69, 0x6e, 0x74,
-	0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x64, 0x6f, 0x6d, 0x61, 0x69, 0x6e, 0x2f, 0x69, 0x64, 0x65,
-	0x6e, 0x74, 0x69, 0x74, 0x79, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x73, 0x69, 0x6f, 0x6e, 0x49, 0x44, 0x22, 0x2e, 0x0a, 0x16, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69,
+	0x74, 0x79, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x72, 0x6d, 0x65, 0x64,
+	0x12, 0x14, 0x0a, 0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x22, 0x3a, 0x0a, 0x1e, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69,
+	0x74, 0x79, 0x50, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x52, 0x65, 0x73, 0x65, 0x74, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x65, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x72, 0x65, 0x73, 0x65,
+	0x74, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x72, 0x65, 0x73, 0x65, 0x74,
+	0x49, 0x44, 0x22, 0x57, 0x0a, 0x17, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x50, 0x61,
+	0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64, 0x12, 0x22, 0x0a,
+	0x0c, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x68, 0x61, 0x73, 0x68, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0c, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x68, 0x61, 0x73,
+	0x68, 0x12, 0x18, 0x0a, 0x07, 0x72, 0x65, 0x73, 0x65, 0x74, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x07, 0x72, 0x65, 0x73, 0x65, 0x74, 0x49, 0x44, 0x42, 0x1d, 0x5a, 0x1b, 0x2e,
+	0x2e, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x64, 0x6f, 0x6d, 0x61, 0x69,
+	0x6e, 0x2f, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
 }
 
 var (
@@ -212,15 +374,15 @@ func file_identity_events_proto_rawDescGZIP() []byte {
 	return file_identity_events_proto_rawDescData
 }
 
-var (
-	file_identity_events_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
-	file_identity_events_proto_goTypes  = []interface{}{
-		(*IdentityRegistered)(nil), // 0: identity.IdentityRegistered
-		(*IdentityLoggedIn)(nil),   // 1: identity.IdentityLoggedIn
-		(*IdentityLoggedOut)(nil),  // 2: identity.IdentityLoggedOut
-	}
-)
-
+var file_identity_events_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_identity_events_proto_goTypes = []interface{}{
+	(*IdentityRegistered)(nil),             // 0: identity.IdentityRegistered
+	(*IdentityLoggedIn)(nil),               // 1: identity.IdentityLoggedIn
+	(*IdentityLoggedOut)(nil),              // 2: identity.IdentityLoggedOut
+	(*IdentityEmailConfirmed)(nil),         // 3: identity.IdentityEmailConfirmed
+	(*IdentityPasswordResetRequested)(nil), // 4: identity.IdentityPasswordResetRequested
+	(*IdentityPasswordChanged)(nil),        // 5: identity.IdentityPasswordChanged
+}
 var file_identity_events_proto_depIdxs = []int32{
 	0, // [0:0] is the sub-list for method output_type
 	0, // [0:0] is the sub-list for method input_type
@@ -271,6 +433,42 @@ func file_identity_events_proto_init() {
 				return nil
 			}
 		}
+		file_identity_events_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IdentityEmailConfirmed); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_identity_events_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IdentityPasswordResetRequested); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_identity_events_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IdentityPasswordChanged); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -278,7 +476,7 @@ func file_identity_events_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_identity_events_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,26 @@
+package authentication
+
+import "github.com/cockroachdb/errors"
+
+// LoginPolicy decides which identities are allowed to log in.
+type LoginPolicy struct {
+	// Identities which have not confirmed their email cannot log in
+	RequireConfirmedEmail bool
+}
+
+var ErrEmailNotConfirmed = errors.New("email must be confirmed before logging in")
+
+// DefaultLoginPolicy allows identities to log in before they confirm their email.
+func DefaultLoginPolicy() LoginPolicy {
+	return LoginPolicy{
+		RequireConfirmedEmail: false,
+	}
+}
+
+func (policy LoginPolicy) allows(identity *Identity) error {
+	if policy.RequireConfirmedEmail && !identity.email.Confirmed() {
+		return ErrEmailNotConfirmed
+	}
+
+	return nil
+}
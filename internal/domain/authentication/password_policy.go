@@ -0,0 +1,194 @@
+package authentication
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/errors"
+)
+
+// BreachedPasswords tells whether a password is known from breaches
+// or lists of common passwords, in which case it must not be used.
+type BreachedPasswords interface {
+	Contains(password string) bool
+}
+
+// PasswordPolicy decides which passwords are strong enough to be set.
+type PasswordPolicy struct {
+	MinLength int
+	// bcrypt only uses the first 72 bytes of the password
+	MaxLength int
+	// The number of the character classes lower case, upper case,
+	// digits and symbols which the password must contain
+	MinCharacterClasses int
+	// The estimated entropy, see estimateEntropy
+	MinEntropyBits float64
+	// Nil means passwords are not checked against breaches
+	Breached BreachedPasswords
+}
+
+type PasswordViolationCode string
+
+const (
+	PasswordTooShort          = PasswordViolationCode("too_short")
+	PasswordTooLong           = PasswordViolationCode("too_long")
+	PasswordTooFewCharClasses = PasswordViolationCode("too_few_character_classes")
+	PasswordTooPredictable    = PasswordViolationCode("too_predictable")
+	PasswordBreached          = PasswordViolationCode("breached")
+)
+
+// PasswordViolation is a rule of the policy which the password breaks.
+// The message is meant to be shown to the user.
+type PasswordViolation struct {
+	Code    PasswordViolationCode `json:"code"`
+	Message string                `json:"message"`
+}
+
+// PasswordPolicyError has all the violations of the password, such
+// that the user can fix them at once. It is marked with ErrWeakPassword.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+const (
+	defaultMinPasswordLength      = 8
+	defaultMaxPasswordLength      = 72
+	defaultMinCharacterClasses    = 2
+	defaultMinPasswordEntropyBits = 40
+	lowerCaseClassSize            = 26
+	upperCaseClassSize            = 26
+	digitClassSize                = 10
+	symbolClassSize               = 33
+)
+
+var ErrWeakPassword = errors.New("password does not satisfy the password policy")
+
+// DefaultPasswordPolicy follows NIST SP 800-63B in checking the length and
+// the breaches, but also requires some variety as the breach list is small.
+func DefaultPasswordPolicy(breached BreachedPasswords) PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:           defaultMinPasswordLength,
+		MaxLength:           defaultMaxPasswordLength,
+		MinCharacterClasses: defaultMinCharacterClasses,
+		MinEntropyBits:      defaultMinPasswordEntropyBits,
+		Breached:            breached,
+	}
+}
+
+func (err *PasswordPolicyError) Error() string {
+	messages := make([]string, len(err.Violations))
+	for i, violation := range err.Violations {
+		messages[i] = violation.Message
+	}
+
+	return ErrWeakPassword.Error() + ": " + strings.Join(messages, "; ")
+}
+
+// Validate returns the violations of the password as a PasswordPolicyError.
+func (policy PasswordPolicy) Validate(password string) error {
+	violations := make([]PasswordViolation, 0)
+	violate := func(code PasswordViolationCode, format string, args ...interface{}) {
+		violations = append(violations, PasswordViolation{
+			Code:    code,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		violate(PasswordTooShort, "password must be at least %d characters", policy.MinLength)
+	}
+
+	if policy.MaxLength > 0 && len(password) > policy.MaxLength {
+		violate(PasswordTooLong, "password must be at most %d bytes", policy.MaxLength)
+	}
+
+	if classes, _ := characterClasses(password); classes < policy.MinCharacterClasses {
+		violate(
+			PasswordTooFewCharClasses,
+			"password must contain at least %d of lower case letters, upper case letters, digits and symbols",
+			policy.MinCharacterClasses,
+		)
+	}
+
+	if estimateEntropy(password) < policy.MinEntropyBits {
+		violate(PasswordTooPredictable, "password is too predictable, avoid repetitions and sequences")
+	}
+
+	if policy.Breached != nil &&
+		(policy.Breached.Contains(password) || policy.Breached.Contains(strings.ToLower(password))) {
+		violate(PasswordBreached, "password is too common or has appeared in a data breach")
+	}
+
+	if len(violations) > 0 {
+		return errors.Mark(&PasswordPolicyError{Violations: violations}, ErrWeakPassword)
+	}
+
+	return nil
+}
+
+// characterClasses returns the number of character classes in the
+// password, and the number of characters in those classes combined.
+func characterClasses(password string) (int, int) {
+	var lower, upper, digit, symbol bool
+
+	for _, char := range password {
+		switch {
+		case unicode.IsLower(char):
+			lower = true
+		case unicode.IsUpper(char):
+			upper = true
+		case unicode.IsDigit(char):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes, size := 0, 0
+
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{
+		{present: lower, size: lowerCaseClassSize},
+		{present: upper, size: upperCaseClassSize},
+		{present: digit, size: digitClassSize},
+		{present: symbol, size: symbolClassSize},
+	} {
+		if class.present {
+			classes++
+			size += class.size
+		}
+	}
+
+	return classes, size
+}
+
+// estimateEntropy estimates the bits of entropy of the password as if
+// its characters were picked at random from its character classes. The
+// characters which repeat or continue a sequence of the previous character,
+// such as in "aaaa" and "1234", are not counted as they are easily guessed.
+func estimateEntropy(password string) float64 {
+	_, size := characterClasses(password)
+	if size == 0 {
+		return 0
+	}
+
+	counted := 0
+	previous := rune(-1)
+
+	for _, char := range password {
+		difference := char - previous
+		if difference < -1 || difference > 1 {
+			counted++
+		}
+
+		previous = char
+	}
+
+	return float64(counted) * math.Log2(float64(size))
+}
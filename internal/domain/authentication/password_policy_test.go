@@ -0,0 +1,69 @@
+package authentication_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/domain/authentication"
+)
+
+type breachedList map[string]bool
+
+func (list breachedList) Contains(password string) bool {
+	return list[password]
+}
+
+func violationCodes(t *testing.T, err error) map[authentication.PasswordViolationCode]bool {
+	t.Helper()
+
+	codes := make(map[authentication.PasswordViolationCode]bool)
+	if err == nil {
+		return codes
+	}
+
+	if !errors.Is(err, authentication.ErrWeakPassword) {
+		t.Fatalf("expected %v but got %v", authentication.ErrWeakPassword, err)
+	}
+
+	var policyErr *authentication.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected a password policy error but got %v", err)
+	}
+
+	for _, violation := range policyErr.Violations {
+		codes[violation.Code] = true
+	}
+
+	return codes
+}
+
+func TestPasswordPolicyAcceptsStrongPassword(t *testing.T) {
+	t.Parallel()
+
+	policy := authentication.DefaultPasswordPolicy(breachedList{"password1": true})
+
+	if err := policy.Validate("correct-Horse-battery-9"); err != nil {
+		t.Error("expected the password to be strong but got err:", err)
+	}
+}
+
+func TestPasswordPolicyReportsAllViolations(t *testing.T) {
+	t.Parallel()
+
+	policy := authentication.DefaultPasswordPolicy(breachedList{"password1": true})
+	cases := map[string][]authentication.PasswordViolationCode{
+		"":          {authentication.PasswordTooShort, authentication.PasswordTooFewCharClasses},
+		"aaaaaaaa":  {authentication.PasswordTooFewCharClasses, authentication.PasswordTooPredictable},
+		"abcd1234":  {authentication.PasswordTooPredictable},
+		"Password1": {authentication.PasswordBreached},
+	}
+
+	for password, expected := range cases {
+		codes := violationCodes(t, policy.Validate(password))
+		for _, code := range expected {
+			if !codes[code] {
+				t.Errorf("expected %q to violate %q but got %v", password, code, codes)
+			}
+		}
+	}
+}
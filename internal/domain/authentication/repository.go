@@ -1,5 +1,8 @@
 package authentication
 
+// Repository finds the identities and tracks the identities it finds and
+// adds, such that the events they record are committed with the unit of work.
 type Repository interface {
-	FindIdentityByEmail(email string) (Identity, error)
+	FindIdentityByEmail(email string) (*Identity, error)
+	Add(identity *Identity)
 }
@@ -4,26 +4,58 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/google/uuid"
 	"github.com/hywmongous/example-service/pkg/es"
-	"github.com/hywmongous/example-service/pkg/es/mediator"
 )
 
 var (
 	ErrSessionNotFound              = errors.New("session could not be found")
 	ErrPasswordAuthenticationFailed = errors.New("authentication failed because of password validation")
+	ErrEventNotRecorded             = errors.New("identity event could not be recorded")
+	ErrIdentityHasNoEvents          = errors.New("identity cannot be recreated without events")
+	ErrEmailAlreadyConfirmed        = errors.New("email is already confirmed")
+	ErrEmailMismatch                = errors.New("email is not the email of the identity")
+	ErrPasswordResetInvalid         = errors.New("password reset is not the outstanding reset of the identity")
 )
 
 type (
-	IdentityID string
-	Identity   struct {
+	IdentityID      string
+	PasswordResetID string
+	// Identity is the aggregate root of the authentication context. The
+	// subject of its events is the canonical email, which is what it is found by.
+	Identity struct {
+		es.AggregateRoot
+
 		id       IdentityID
 		email    Email
 		password Password
 		sessions []Session
-		mediator *mediator.Mediator
+		// The reset which has been requested but not yet used, if any
+		resetID PasswordResetID
 	}
 )
 
-func (identity Identity) ID() IdentityID {
+var (
+	identityRegisteredTitle = es.CreateTitleForData(&IdentityRegistered{})
+	identityLoggedInTitle   = es.CreateTitleForData(&IdentityLoggedIn{})
+	identityLoggedOutTitle  = es.CreateTitleForData(&IdentityLoggedOut{})
+
+	identityEmailConfirmedTitle         = es.CreateTitleForData(&IdentityEmailConfirmed{})
+	identityPasswordResetRequestedTitle = es.CreateTitleForData(&IdentityPasswordResetRequested{})
+	identityPasswordChangedTitle        = es.CreateTitleForData(&IdentityPasswordChanged{})
+)
+
+// IdentityEvents returns the prototypes of the events of the identity, for registries.
+func IdentityEvents() []es.Data {
+	return []es.Data{
+		&IdentityRegistered{},
+		&IdentityLoggedIn{},
+		&IdentityLoggedOut{},
+		&IdentityEmailConfirmed{},
+		&IdentityPasswordResetRequested{},
+		&IdentityPasswordChanged{},
+	}
+}
+
+func (identity *Identity) ID() IdentityID {
 	return identity.id
 }
 
@@ -35,73 +67,232 @@ func (identity *Identity) Password() Password {
 	return identity.password
 }
 
-func RecreateIdentity(
-	id IdentityID,
-	email Email,
-	password Password,
-	sessions []Session,
-	mediator *mediator.Mediator,
-) Identity {
-	return Identity{
-		id:       id,
-		email:    email,
-		password: password,
-		sessions: sessions,
-		mediator: mediator,
+func (identity *Identity) Sessions() []Session {
+	return identity.sessions
+}
+
+// RecreateIdentity recreates the identity by replaying its events.
+func RecreateIdentity(subject es.SubjectID, events []es.Event) (*Identity, error) {
+	if len(events) == 0 {
+		return nil, errors.Wrap(ErrIdentityHasNoEvents, string(subject))
 	}
+
+	identity := createIdentity(subject)
+	if err := identity.Replay(identity, events); err != nil {
+		return nil, err
+	}
+
+	return identity, nil
 }
 
 func Register(
 	emailAddress string,
 	plainTextPassword string,
-	mediator *mediator.Mediator,
-) (Identity, error) {
-	email, err := CreateEmail(emailAddress)
+	emailPolicy EmailPolicy,
+	passwordPolicy PasswordPolicy,
+) (*Identity, error) {
+	email, err := CreateEmail(emailAddress, emailPolicy)
 	if err != nil {
-		return Identity{}, err
+		return nil, err
 	}
 
-	password, err := CreatePassword(plainTextPassword)
+	password, err := CreatePassword(plainTextPassword, passwordPolicy)
 	if err != nil {
-		return Identity{}, err
+		return nil, err
 	}
 
-	identity := Identity{
-		id:       IdentityID(uuid.NewString()),
-		email:    email,
-		password: password,
-		sessions: make([]Session, 0),
-		mediator: mediator,
-	}
+	identity := createIdentity(es.SubjectID(email.Address()))
 
-	identity.publishEvent(&IdentityRegistered{
-		ID:           string(identity.id),
-		Email:        emailAddress,
+	if err := identity.record(&IdentityRegistered{
+		ID:           uuid.NewString(),
+		Email:        email.Address(),
 		Passwordhash: password.hashedPassword,
-	})
+	}); err != nil {
+		return nil, err
+	}
 
 	return identity, nil
 }
 
-func (identity *Identity) Login(password string) (SessionID, error) {
+// Login opens a session. The password is verified before the policy, such
+// that only those who know the password learn whether the email is confirmed.
+func (identity *Identity) Login(password string, policy LoginPolicy) (SessionID, error) {
 	if err := identity.password.verify(password); err != nil {
 		return SessionID(""), errors.Wrap(err, ErrPasswordAuthenticationFailed.Error())
 	}
 
+	if err := policy.allows(identity); err != nil {
+		return SessionID(""), err
+	}
+
 	newSession, err := CreateSession()
 	if err != nil {
 		return SessionID(""), err
 	}
 
-	identity.sessions = append(identity.sessions, newSession)
-
-	identity.publishEvent(&IdentityLoggedIn{
+	if err := identity.record(&IdentityLoggedIn{
 		SessionID: string(newSession.ID()),
-	})
+	}); err != nil {
+		return SessionID(""), err
+	}
 
 	return newSession.ID(), nil
 }
 
+// Logout revokes the session. Logging out a session which is already revoked
+// has no effect, since the expiry of a session may race with logging it out.
+func (identity *Identity) Logout(sessionID SessionID) error {
+	session, err := identity.session(sessionID)
+	if err != nil {
+		return err
+	}
+
+	if session.Revoked() {
+		return nil
+	}
+
+	return identity.record(&IdentityLoggedOut{
+		SessionID: string(sessionID),
+	})
+}
+
+// ConfirmEmail confirms the email which the confirmation was sent to. It
+// must be the current email, as the email is what the confirmation proves.
+func (identity *Identity) ConfirmEmail(address string) error {
+	if address != identity.email.Address() {
+		return ErrEmailMismatch
+	}
+
+	if identity.email.Confirmed() {
+		return ErrEmailAlreadyConfirmed
+	}
+
+	return identity.record(&IdentityEmailConfirmed{
+		Email: address,
+	})
+}
+
+// ChangePassword replaces the password of an identity which knows its current
+// password. The sessions other than the one changing the password are revoked.
+func (identity *Identity) ChangePassword(
+	currentPassword string,
+	newPassword string,
+	policy PasswordPolicy,
+	sessionID SessionID,
+) ([]SessionID, error) {
+	if err := identity.password.verify(currentPassword); err != nil {
+		return nil, errors.Wrap(err, ErrPasswordAuthenticationFailed.Error())
+	}
+
+	session, err := identity.session(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Revoked() {
+		return nil, ErrSessionNotFound
+	}
+
+	return identity.changePassword(newPassword, policy, "", sessionID)
+}
+
+// RequestPasswordReset starts a reset for an identity which forgot its
+// password. Requesting another reset replaces the outstanding one.
+func (identity *Identity) RequestPasswordReset() (PasswordResetID, error) {
+	resetID := PasswordResetID(uuid.NewString())
+
+	if err := identity.record(&IdentityPasswordResetRequested{
+		ResetID: string(resetID),
+	}); err != nil {
+		return PasswordResetID(""), err
+	}
+
+	return resetID, nil
+}
+
+// ResetPassword sets the password without the current password. Only the
+// outstanding reset can be used, and only once, as changing the password ends
+// it. As whoever reset the password has no session, all sessions are revoked.
+func (identity *Identity) ResetPassword(
+	resetID PasswordResetID,
+	newPassword string,
+	policy PasswordPolicy,
+) ([]SessionID, error) {
+	if resetID == "" || resetID != identity.resetID {
+		return nil, ErrPasswordResetInvalid
+	}
+
+	return identity.changePassword(newPassword, policy, resetID, "")
+}
+
+// Apply applies both the recorded and the replayed events of the identity.
+func (identity *Identity) Apply(event es.Event) error {
+	switch event.Name {
+	case identityRegisteredTitle:
+		var data IdentityRegistered
+		if err := event.Unmarshal(&data); err != nil {
+			return err
+		}
+
+		identity.id = IdentityID(data.ID)
+		identity.email = RecreateEmail(data.Email, false)
+		identity.password = RecreatePassword(data.Passwordhash)
+	case identityLoggedInTitle:
+		var data IdentityLoggedIn
+		if err := event.Unmarshal(&data); err != nil {
+			return err
+		}
+
+		identity.sessions = append(identity.sessions, RecreateSession(SessionID(data.SessionID), false))
+	case identityLoggedOutTitle:
+		var data IdentityLoggedOut
+		if err := event.Unmarshal(&data); err != nil {
+			return err
+		}
+
+		for idx := range identity.sessions {
+			if identity.sessions[idx].id == SessionID(data.SessionID) {
+				identity.sessions[idx].revoke()
+			}
+		}
+	case identityEmailConfirmedTitle:
+		var data IdentityEmailConfirmed
+		if err := event.Unmarshal(&data); err != nil {
+			return err
+		}
+
+		identity.email = RecreateEmail(data.Email, true)
+	case identityPasswordResetRequestedTitle:
+		var data IdentityPasswordResetRequested
+		if err := event.Unmarshal(&data); err != nil {
+			return err
+		}
+
+		identity.resetID = PasswordResetID(data.ResetID)
+	case identityPasswordChangedTitle:
+		var data IdentityPasswordChanged
+		if err := event.Unmarshal(&data); err != nil {
+			return err
+		}
+
+		identity.password = RecreatePassword(data.Passwordhash)
+		identity.resetID = ""
+	}
+
+	return nil
+}
+
+func createIdentity(subject es.SubjectID) *Identity {
+	return &Identity{
+		AggregateRoot: es.CreateAggregateRoot(subject),
+		id:            "",
+		email:         Email{},
+		password:      DefaultPassword(),
+		sessions:      make([]Session, 0),
+		resetID:       "",
+	}
+}
+
 func (identity *Identity) session(sessionID SessionID) (Session, error) {
 	for _, session := range identity.sessions {
 		if session.id == sessionID {
@@ -112,21 +303,45 @@ func (identity *Identity) session(sessionID SessionID) (Session, error) {
 	return Session{}, ErrSessionNotFound
 }
 
-func (identity *Identity) Logout(sessionID SessionID) error {
-	session, err := identity.session(sessionID)
+// changePassword records the new password and then revokes the active
+// sessions, except the session to keep, such that a stolen session ends.
+func (identity *Identity) changePassword(
+	newPassword string,
+	policy PasswordPolicy,
+	resetID PasswordResetID,
+	keep SessionID,
+) ([]SessionID, error) {
+	password, err := CreatePassword(newPassword, policy)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	session.revoke()
+	revoked := make([]SessionID, 0, len(identity.sessions))
 
-	identity.publishEvent(&IdentityLoggedOut{
-		SessionID: string(sessionID),
-	})
+	for _, session := range identity.sessions {
+		if !session.Revoked() && session.ID() != keep {
+			revoked = append(revoked, session.ID())
+		}
+	}
 
-	return nil
+	if err := identity.record(&IdentityPasswordChanged{
+		Passwordhash: password.hashedPassword,
+		ResetID:      string(resetID),
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, sessionID := range revoked {
+		if err := identity.record(&IdentityLoggedOut{
+			SessionID: string(sessionID),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return revoked, nil
 }
 
-func (identity *Identity) publishEvent(event es.Data) {
-	identity.mediator.Publish(es.SubjectID(identity.Email().address), event)
+func (identity *Identity) record(data es.Data) error {
+	return errors.Wrap(identity.Record(identity, data), ErrEventNotRecorded.Error())
 }
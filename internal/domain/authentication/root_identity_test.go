@@ -0,0 +1,235 @@
+package authentication_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/hywmongous/example-service/internal/domain/authentication"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/estest"
+)
+
+const (
+	subject     = es.SubjectID("alice@example.com")
+	password    = "correct horse battery staple"
+	newPassword = "staple battery horse correct"
+)
+
+var (
+	registered     *authentication.IdentityRegistered
+	registeredOnce sync.Once
+)
+
+// registration returns the event of registering alice. Hashing the password is
+// slow, so the scenarios share the event rather than each registering alice.
+func registration(t *testing.T) *authentication.IdentityRegistered {
+	t.Helper()
+
+	registeredOnce.Do(func() {
+		identity, err := register("Alice@Example.com")
+		if err != nil {
+			t.Fatal("Register failed with err:", err)
+		}
+
+		event, _ := identity.Uncommitted()[0].Data.(*authentication.IdentityRegistered)
+		registered = event
+	})
+
+	return registered
+}
+
+func register(email string) (*authentication.Identity, error) {
+	return authentication.Register(
+		email,
+		password,
+		authentication.DefaultEmailPolicy(),
+		policy(),
+	)
+}
+
+func policy() authentication.PasswordPolicy {
+	return authentication.DefaultPasswordPolicy(breachedList{})
+}
+
+func createIdentityKit(t *testing.T) estest.Kit {
+	t.Helper()
+
+	registry := es.CreateRegistry()
+	if err := registry.Register(authentication.IdentityEvents()...); err != nil {
+		t.Fatal("Register failed with err:", err)
+	}
+
+	return estest.Kit{
+		Subject: subject,
+		Recreate: func(subject es.SubjectID, history []es.Event) (es.EventSourced, error) {
+			return authentication.RecreateIdentity(subject, history)
+		},
+		Registry: registry,
+	}
+}
+
+func login(password string, policy authentication.LoginPolicy) estest.Command {
+	return func(aggregate es.EventSourced) (es.EventSourced, error) {
+		_, err := aggregate.(*authentication.Identity).Login(password, policy)
+
+		return aggregate, err
+	}
+}
+
+func logout(sessionID authentication.SessionID) estest.Command {
+	return func(aggregate es.EventSourced) (es.EventSourced, error) {
+		return aggregate, aggregate.(*authentication.Identity).Logout(sessionID)
+	}
+}
+
+func confirmEmail(address string) estest.Command {
+	return func(aggregate es.EventSourced) (es.EventSourced, error) {
+		return aggregate, aggregate.(*authentication.Identity).ConfirmEmail(address)
+	}
+}
+
+func changePassword(current string, sessionID authentication.SessionID) estest.Command {
+	return func(aggregate es.EventSourced) (es.EventSourced, error) {
+		_, err := aggregate.(*authentication.Identity).ChangePassword(current, newPassword, policy(), sessionID)
+
+		return aggregate, err
+	}
+}
+
+func resetPassword(resetID authentication.PasswordResetID) estest.Command {
+	return func(aggregate es.EventSourced) (es.EventSourced, error) {
+		_, err := aggregate.(*authentication.Identity).ResetPassword(resetID, newPassword, policy())
+
+		return aggregate, err
+	}
+}
+
+func TestIdentityRegistration(t *testing.T) {
+	t.Parallel()
+
+	kit := createIdentityKit(t)
+
+	// The subject is the canonical email
+	kit.Given(t).
+		When(func(es.EventSourced) (es.EventSourced, error) {
+			return register("Alice@Example.com")
+		}).
+		Ignoring("ID", "passwordhash").
+		Then(&authentication.IdentityRegistered{Email: "alice@example.com"})
+
+	kit.Given(t).
+		When(func(es.EventSourced) (es.EventSourced, error) {
+			return register("alice")
+		}).
+		ThenError(authentication.ErrInvalidEmail)
+}
+
+func TestIdentitySessions(t *testing.T) {
+	t.Parallel()
+
+	kit := createIdentityKit(t)
+	registered := registration(t)
+
+	kit.Given(t, registered).
+		When(login(password, authentication.DefaultLoginPolicy())).
+		Ignoring("sessionID").
+		Then(&authentication.IdentityLoggedIn{})
+
+	kit.Given(t, registered).
+		When(login("incorrect horse battery staple", authentication.DefaultLoginPolicy())).
+		ThenError(authentication.ErrIncorrectPassword)
+
+	kit.Given(t, registered, &authentication.IdentityLoggedIn{SessionID: "1"}).
+		When(logout("1")).
+		Then(&authentication.IdentityLoggedOut{SessionID: "1"})
+
+	kit.Given(t, registered, &authentication.IdentityLoggedIn{SessionID: "1"}).
+		When(logout("2")).
+		ThenError(authentication.ErrSessionNotFound)
+
+	// Revoked sessions are not logged out again
+	kit.Given(t,
+		registered,
+		&authentication.IdentityLoggedIn{SessionID: "1"},
+		&authentication.IdentityLoggedOut{SessionID: "1"},
+	).
+		When(logout("1")).
+		Then()
+}
+
+func TestIdentityEmailConfirmation(t *testing.T) {
+	t.Parallel()
+
+	kit := createIdentityKit(t)
+	registered := registration(t)
+	confirmed := &authentication.IdentityEmailConfirmed{Email: "alice@example.com"}
+	requireConfirmation := authentication.LoginPolicy{RequireConfirmedEmail: true}
+
+	kit.Given(t, registered).
+		When(confirmEmail("alice@example.com")).
+		Then(confirmed)
+
+	kit.Given(t, registered, confirmed).
+		When(confirmEmail("alice@example.com")).
+		ThenError(authentication.ErrEmailAlreadyConfirmed)
+
+	kit.Given(t, registered).
+		When(confirmEmail("bob@example.com")).
+		ThenError(authentication.ErrEmailMismatch)
+
+	kit.Given(t, registered).
+		When(login(password, requireConfirmation)).
+		ThenError(authentication.ErrEmailNotConfirmed)
+
+	kit.Given(t, registered, confirmed).
+		When(login(password, requireConfirmation)).
+		Ignoring("sessionID").
+		Then(&authentication.IdentityLoggedIn{})
+}
+
+func TestIdentityPasswordChanges(t *testing.T) {
+	t.Parallel()
+
+	kit := createIdentityKit(t)
+	registered := registration(t)
+	resetRequested := &authentication.IdentityPasswordResetRequested{ResetID: "reset"}
+
+	// The other active sessions are revoked, but not the one changing the password
+	kit.Given(t,
+		registered,
+		&authentication.IdentityLoggedIn{SessionID: "1"},
+		&authentication.IdentityLoggedIn{SessionID: "2"},
+		&authentication.IdentityLoggedOut{SessionID: "2"},
+		&authentication.IdentityLoggedIn{SessionID: "3"},
+	).
+		When(changePassword(password, "1")).
+		Ignoring("passwordhash").
+		Then(
+			&authentication.IdentityPasswordChanged{},
+			&authentication.IdentityLoggedOut{SessionID: "3"},
+		)
+
+	kit.Given(t, registered, &authentication.IdentityLoggedIn{SessionID: "1"}).
+		When(changePassword(newPassword, "1")).
+		ThenError(authentication.ErrIncorrectPassword)
+
+	kit.Given(t, registered, resetRequested, &authentication.IdentityLoggedIn{SessionID: "1"}).
+		When(resetPassword("reset")).
+		Ignoring("passwordhash").
+		Then(
+			&authentication.IdentityPasswordChanged{ResetID: "reset"},
+			&authentication.IdentityLoggedOut{SessionID: "1"},
+		)
+
+	// Resets can only be used once, and only the latest reset can be used
+	kit.Given(t, registered, resetRequested, &authentication.IdentityPasswordChanged{
+		Passwordhash: registered.Passwordhash,
+		ResetID:      "reset",
+	}).
+		When(resetPassword("reset")).
+		ThenError(authentication.ErrPasswordResetInvalid)
+
+	kit.Given(t, registered, resetRequested, &authentication.IdentityPasswordResetRequested{ResetID: "latest"}).
+		When(resetPassword("reset")).
+		ThenError(authentication.ErrPasswordResetInvalid)
+}
@@ -1,11 +1,69 @@
 package authentication
 
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
 type Email struct {
 	address string
 
 	confirmed bool
 }
 
+// PlusAddressingPolicy decides what happens to the tag of
+// plus-addressed emails, such as the "news" in "bob+news@x.com".
+type PlusAddressingPolicy int
+
+const (
+	// PlusAddressingKeep treats tagged emails as different identities.
+	PlusAddressingKeep PlusAddressingPolicy = iota
+	// PlusAddressingStrip removes the tag, hence "bob+news@x.com" is "bob@x.com".
+	PlusAddressingStrip
+	// PlusAddressingReject does not accept tagged emails at all.
+	PlusAddressingReject
+)
+
+// EmailPolicy decides the canonical form of the emails. Emails are
+// compared by their canonical form, which is also the subject of the
+// events of the identity, so the policy must not change once identities exist.
+type EmailPolicy struct {
+	// The domain is always case folded, but the local part is
+	// case sensitive by RFC 5321 even though few servers treat it as such
+	FoldLocalPart  bool
+	PlusAddressing PlusAddressingPolicy
+}
+
+const (
+	plusTag = "+"
+	atSign  = "@"
+
+	// https://datatracker.ietf.org/doc/html/rfc5321#section-4.5.3.1
+	maxLocalPartLength = 64
+	maxAddressLength   = 254
+)
+
+var (
+	ErrInvalidEmail              = errors.New("email is not a valid address")
+	ErrQuotedLocalPart           = errors.New("email local part must not be quoted")
+	ErrEmailTooLong              = errors.New("email is longer than allowed")
+	ErrInvalidEmailDomain        = errors.New("email domain is not a valid domain name")
+	ErrPlusAddressingRejected    = errors.New("email must not be plus-addressed")
+	ErrUnsupportedPlusAddressing = errors.New("email plus-addressing policy is not supported")
+)
+
+func DefaultEmailPolicy() EmailPolicy {
+	return EmailPolicy{
+		FoldLocalPart:  true,
+		PlusAddressing: PlusAddressingKeep,
+	}
+}
+
 func (email Email) Address() string {
 	return email.address
 }
@@ -14,9 +72,15 @@ func (email Email) Confirmed() bool {
 	return email.confirmed
 }
 
-func CreateEmail(address string) (Email, error) {
+// CreateEmail validates the address and keeps it in its canonical form.
+func CreateEmail(address string, policy EmailPolicy) (Email, error) {
+	canonical, err := policy.Canonicalize(address)
+	if err != nil {
+		return Email{}, err
+	}
+
 	return Email{
-		address:   address,
+		address:   canonical,
 		confirmed: false,
 	}, nil
 }
@@ -30,3 +94,72 @@ func RecreateEmail(
 		confirmed: confirmed,
 	}
 }
+
+// Canonicalize returns the canonical form of the address. The address must
+// be a bare RFC 5322 address without a display name or a quoted local part,
+// since unquoting it could make a different or an invalid address. The local part is
+// normalised to NFC and the domain is converted to its ASCII form, such that
+// the different Unicode spellings of the same address are equal.
+func (policy EmailPolicy) Canonicalize(address string) (string, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", errors.Mark(errors.Wrap(err, ErrInvalidEmail.Error()), ErrInvalidEmail)
+	}
+
+	// The parser also accepts addresses such as "Bob <bob@x.com>"
+	if parsed.Name != "" || strings.ContainsAny(address, "<>") {
+		return "", ErrInvalidEmail
+	}
+
+	// Quotes are only allowed in the local part, such as "\"bob smith\"@x.com"
+	if strings.Contains(address, `"`) {
+		return "", errors.Mark(ErrQuotedLocalPart, ErrInvalidEmail)
+	}
+
+	at := strings.LastIndex(parsed.Address, atSign)
+	local := norm.NFC.String(parsed.Address[:at])
+
+	domain, err := idna.Lookup.ToASCII(parsed.Address[at+1:])
+	if err != nil {
+		return "", errors.Mark(errors.Wrap(err, ErrInvalidEmailDomain.Error()), ErrInvalidEmail)
+	}
+
+	local, err = policy.applyPlusAddressing(local)
+	if err != nil {
+		return "", err
+	}
+
+	if policy.FoldLocalPart {
+		local = cases.Fold().String(local)
+	}
+
+	canonical := local + atSign + strings.ToLower(domain)
+	if len(local) > maxLocalPartLength || len(canonical) > maxAddressLength {
+		return "", ErrEmailTooLong
+	}
+
+	return canonical, nil
+}
+
+func (policy EmailPolicy) applyPlusAddressing(local string) (string, error) {
+	tag := strings.Index(local, plusTag)
+
+	switch policy.PlusAddressing {
+	case PlusAddressingKeep:
+		return local, nil
+	case PlusAddressingStrip:
+		if tag > 0 {
+			return local[:tag], nil
+		}
+
+		return local, nil
+	case PlusAddressingReject:
+		if tag >= 0 {
+			return "", ErrPlusAddressingRejected
+		}
+
+		return local, nil
+	default:
+		return "", ErrUnsupportedPlusAddressing
+	}
+}
@@ -0,0 +1,97 @@
+package authentication_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/domain/authentication"
+)
+
+func TestCreateEmailCanonicalizes(t *testing.T) {
+	t.Parallel()
+
+	policy := authentication.DefaultEmailPolicy()
+	cases := map[string]string{
+		"bob@x.com":          "bob@x.com",
+		"Bob@X.com":          "bob@x.com",
+		"  bob@x.com ":       "bob@x.com",
+		"bob+news@x.com":     "bob+news@x.com",
+		"bob@bücher.example": "bob@xn--bcher-kva.example",
+		// The decomposed and the precomposed spelling of the same local part
+		"jose\u0301@x.com": "jos\u00e9@x.com",
+	}
+
+	for address, expected := range cases {
+		email, err := authentication.CreateEmail(address, policy)
+		if err != nil {
+			t.Errorf("CreateEmail of %q failed with err: %v", address, err)
+
+			continue
+		}
+
+		if email.Address() != expected {
+			t.Errorf("expected %q to be %q but got %q", address, expected, email.Address())
+		}
+
+		// The canonical form is the subject, so it must be canonical itself
+		again, err := authentication.CreateEmail(email.Address(), policy)
+		if err != nil || again.Address() != email.Address() {
+			t.Errorf("expected %q to be canonical but got %q and err: %v", email.Address(), again.Address(), err)
+		}
+	}
+}
+
+func TestCreateEmailRejectsInvalidAddresses(t *testing.T) {
+	t.Parallel()
+
+	policy := authentication.DefaultEmailPolicy()
+	addresses := []string{
+		"",
+		"bob",
+		"bob@",
+		"@x.com",
+		"Bob <bob@x.com>",
+		"bob@x..com",
+		`"bob smith"@x.com`,
+		`"a@b"@x.com`,
+	}
+
+	for _, address := range addresses {
+		if _, err := authentication.CreateEmail(address, policy); !errors.Is(err, authentication.ErrInvalidEmail) {
+			t.Errorf("expected %q to be invalid but got err: %v", address, err)
+		}
+	}
+}
+
+func TestCreateEmailPlusAddressingPolicies(t *testing.T) {
+	t.Parallel()
+
+	policy := authentication.DefaultEmailPolicy()
+	policy.PlusAddressing = authentication.PlusAddressingStrip
+
+	email, err := authentication.CreateEmail("Bob+News@x.com", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if email.Address() != "bob@x.com" {
+		t.Errorf("expected the tag to be stripped but got %q", email.Address())
+	}
+
+	policy.PlusAddressing = authentication.PlusAddressingReject
+
+	if _, err := authentication.CreateEmail("bob+news@x.com", policy); !errors.Is(err, authentication.ErrPlusAddressingRejected) {
+		t.Errorf("expected the tagged email to be rejected but got err: %v", err)
+	}
+
+	policy.FoldLocalPart = false
+
+	email, err = authentication.CreateEmail("Bob@X.com", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if email.Address() != "Bob@x.com" {
+		t.Errorf("expected only the domain to be folded but got %q", email.Address())
+	}
+}
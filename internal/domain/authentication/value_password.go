@@ -22,7 +22,13 @@ func (password Password) HashedPassword() string {
 	return password.hashedPassword
 }
 
-func CreatePassword(password string) (Password, error) {
+// CreatePassword hashes the password if it satisfies the policy.
+// Otherwise the error is a PasswordPolicyError with the violations.
+func CreatePassword(password string, policy PasswordPolicy) (Password, error) {
+	if err := policy.Validate(password); err != nil {
+		return DefaultPassword(), err
+	}
+
 	createdPassword := DefaultPassword()
 	if err := createdPassword.set(password); err != nil {
 		return DefaultPassword(), errors.Wrap(err, ErrInvalidPassword.Error())
@@ -57,9 +63,14 @@ func (password *Password) set(input string) error {
 	return nil
 }
 
+// The error is marked such that callers can tell an incorrect password
+// apart from the other reasons authentication fails.
 func (password Password) verify(input string) error {
-	return errors.Wrap(
-		bcrypt.CompareHashAndPassword([]byte(password.hashedPassword), []byte(input)),
-		ErrIncorrectPassword.Error(),
+	return errors.Mark(
+		errors.Wrap(
+			bcrypt.CompareHashAndPassword([]byte(password.hashedPassword), []byte(input)),
+			ErrIncorrectPassword.Error(),
+		),
+		ErrIncorrectPassword,
 	)
 }
@@ -0,0 +1,82 @@
+package infrastructure
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/infrastructure/jaeger"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+)
+
+var ErrRequestFailedCommitting = errors.New("request failed committing the unit of work")
+
+// TracingBehaviour handles the request within a span named after the request.
+func TracingBehaviour(
+	ctx context.Context,
+	request mediator.Request,
+	next mediator.RequestHandler,
+) (mediator.Response, error) {
+	span, ctx := jaeger.StartSpanFromSpanContext(ctx, mediator.RequestName(request))
+	defer span.Finish()
+
+	response, err := next(ctx, request)
+	if err != nil {
+		jaeger.SetError(span, err)
+	}
+
+	return response, err
+}
+
+func LoggingBehaviour(
+	ctx context.Context,
+	request mediator.Request,
+	next mediator.RequestHandler,
+) (mediator.Response, error) {
+	started := time.Now()
+	response, err := next(ctx, request)
+
+	if err != nil {
+		log.Println(mediator.RequestName(request), "failed after", time.Since(started), "with err:", err)
+	} else {
+		log.Println(mediator.RequestName(request), "succeeded after", time.Since(started))
+	}
+
+	return response, err
+}
+
+// UnitOfWorkBehaviour creates a unit of work for the request and passes it
+// to the handler through the context. The events staged by the handler are
+// committed if it succeeds, and the stage is always cleared afterwards.
+// Requests which do not stage any events, such as queries, are not committed.
+func UnitOfWorkBehaviour(createUnitOfWork UnitOfWorkCreator) mediator.Behaviour {
+	return func(
+		ctx context.Context,
+		request mediator.Request,
+		next mediator.RequestHandler,
+	) (mediator.Response, error) {
+		uow := createUnitOfWork()
+		defer uow.Clear()
+
+		response, err := next(WithUnitOfWork(ctx, uow), request)
+		if err != nil {
+			uow.Rollback(ctx, err)
+
+			return nil, err
+		}
+
+		err = uow.Commit(ctx)
+
+		switch {
+		case err == nil, errors.Is(err, ErrEmptyCommit):
+		case errors.Is(err, ErrCommittedHookFailed):
+			// The events are committed, so the request succeeded
+			log.Println(mediator.RequestName(request), "committed but a hook failed with err:", err)
+		default:
+			return nil, errors.Wrap(err, ErrRequestFailedCommitting.Error())
+		}
+
+		return response, nil
+	}
+}
@@ -0,0 +1,25 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+)
+
+type unitOfWorkKey struct{}
+
+var ErrUnitOfWorkNotFound = errors.New("unit of work was not found in context")
+
+// WithUnitOfWork returns a context which carries the unit of work to the use case.
+func WithUnitOfWork(ctx context.Context, uow *UnitOfWork) context.Context {
+	return context.WithValue(ctx, unitOfWorkKey{}, uow)
+}
+
+func UnitOfWorkFromContext(ctx context.Context) (*UnitOfWork, error) {
+	uow, ok := ctx.Value(unitOfWorkKey{}).(*UnitOfWork)
+	if !ok || uow == nil {
+		return nil, ErrUnitOfWorkNotFound
+	}
+
+	return uow, nil
+}
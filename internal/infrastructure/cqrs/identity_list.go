@@ -0,0 +1,372 @@
+package cqrs
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/domain/authentication"
+	"github.com/hywmongous/example-service/pkg/es"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IdentityList is the read model of the identities which backs listing and
+// finding identities. It is kept up to date by a projector, hence the queries
+// do not replay the events of the identities as the repository does.
+type IdentityList struct {
+	uri string
+}
+
+// IdentitySummary is an identity as listed by the read model.
+type IdentitySummary struct {
+	ID             string     `json:"id" bson:"_id"`
+	Email          string     `json:"email" bson:"email"`
+	Confirmed      bool       `json:"confirmed" bson:"confirmed"`
+	RegisteredAt   time.Time  `json:"registered_at" bson:"registeredat"`
+	LastLoginAt    *time.Time `json:"last_login_at" bson:"lastloginat"`
+	ActiveSessions int        `json:"active_sessions" bson:"-"`
+}
+
+// IdentitySort is the field which the identities are sorted by.
+// It is prefixed with a minus to sort in descending order.
+type IdentitySort string
+
+// IdentityListQuery filters, sorts and paginates the listed identities.
+type IdentityListQuery struct {
+	// Lists the identities with emails containing the text, ignoring case
+	Email string `form:"email"`
+	// Lists either the confirmed or the unconfirmed identities when set
+	Confirmed *bool        `form:"confirmed"`
+	Sort      IdentitySort `form:"sort"`
+	// The first page is 1
+	Page     int64 `form:"page"`
+	PageSize int64 `form:"page_size"`
+}
+
+// IdentityPage is a page of the listed identities.
+type IdentityPage struct {
+	Identities []IdentitySummary `json:"identities"`
+	Page       int64             `json:"page"`
+	PageSize   int64             `json:"page_size"`
+	// The number of identities matching the filters on all pages
+	Total int64 `json:"total"`
+}
+
+// identityDocument is the stored summary which additionally
+// holds the active sessions, such that logouts are idempotent.
+type identityDocument struct {
+	IdentitySummary `bson:",inline"`
+	Sessions        []string `bson:"sessions"`
+}
+
+const (
+	identityListName     = "identity_list"
+	readModelsDatabase   = "readmodels"
+	identitiesCollection = "identities"
+	readModelsURI        = "mongodb://root:root@ia_mongo:27017"
+	readModelsTimeout    = 10 * time.Second
+
+	emailKey        = "email"
+	confirmedKey    = "confirmed"
+	registeredAtKey = "registeredat"
+	lastLoginAtKey  = "lastloginat"
+	sessionsKey     = "sessions"
+
+	SortByEmail            = IdentitySort("email")
+	SortByRegisteredAt     = IdentitySort("registered_at")
+	SortByLastLoginAt      = IdentitySort("last_login_at")
+	descendingSortPrefix   = "-"
+	defaultIdentitySort    = SortByRegisteredAt
+	defaultIdentityPage    = 1
+	defaultIdentityPerPage = 20
+	maxIdentityPerPage     = 100
+)
+
+var (
+	ErrInvalidIdentitySort     = errors.New("identities cannot be sorted by the field")
+	ErrInvalidIdentityPage     = errors.New("identity page must be positive")
+	ErrInvalidIdentityPageSize = errors.New("identity page size must be between 1 and 100")
+	ErrIdentityNotFound        = errors.New("identity was not found in the read model")
+	ErrCouldNotQueryIdentities = errors.New("identities could not be queried from the read model")
+	ErrCouldNotApplyIdentity   = errors.New("identity event could not be applied to the read model")
+	ErrCouldNotResetIdentities = errors.New("identity read model could not be reset")
+	ErrCouldNotIndexIdentities = errors.New("identity read model could not be indexed")
+)
+
+var (
+	identityRegisteredTitle     = es.CreateTitleForData(&authentication.IdentityRegistered{})
+	identityLoggedInTitle       = es.CreateTitleForData(&authentication.IdentityLoggedIn{})
+	identityLoggedOutTitle      = es.CreateTitleForData(&authentication.IdentityLoggedOut{})
+	identityEmailConfirmedTitle = es.CreateTitleForData(&authentication.IdentityEmailConfirmed{})
+)
+
+var identitySortKeys = map[IdentitySort]string{
+	SortByEmail:        emailKey,
+	SortByRegisteredAt: registeredAtKey,
+	SortByLastLoginAt:  lastLoginAtKey,
+}
+
+func IdentityListFactory() *IdentityList {
+	return &IdentityList{
+		uri: readModelsURI,
+	}
+}
+
+// Normalize fills in the defaults of the omitted fields and validates the query.
+func (query IdentityListQuery) Normalize() (IdentityListQuery, error) {
+	if query.Sort == "" {
+		query.Sort = defaultIdentitySort
+	}
+
+	if query.Page == 0 {
+		query.Page = defaultIdentityPage
+	}
+
+	if query.PageSize == 0 {
+		query.PageSize = defaultIdentityPerPage
+	}
+
+	if _, _, err := query.Sort.key(); err != nil {
+		return IdentityListQuery{}, err
+	}
+
+	if query.Page < 1 {
+		return IdentityListQuery{}, ErrInvalidIdentityPage
+	}
+
+	if query.PageSize < 1 || query.PageSize > maxIdentityPerPage {
+		return IdentityListQuery{}, ErrInvalidIdentityPageSize
+	}
+
+	return query, nil
+}
+
+// key returns the document key and the direction the sort orders by.
+func (sort IdentitySort) key() (string, int, error) {
+	direction := 1
+	field := IdentitySort(strings.TrimPrefix(string(sort), descendingSortPrefix))
+
+	if field != sort {
+		direction = -1
+	}
+
+	key, found := identitySortKeys[field]
+	if !found {
+		return "", 0, errors.Wrap(ErrInvalidIdentitySort, string(sort))
+	}
+
+	return key, direction, nil
+}
+
+func (query IdentityListQuery) filter() bson.D {
+	filter := bson.D{}
+
+	if query.Email != "" {
+		filter = append(filter, bson.E{Key: emailKey, Value: containsIgnoringCase(query.Email)})
+	}
+
+	if query.Confirmed != nil {
+		filter = append(filter, bson.E{Key: confirmedKey, Value: *query.Confirmed})
+	}
+
+	return filter
+}
+
+// containsIgnoringCase matches the text anywhere in a value, ignoring case.
+func containsIgnoringCase(text string) bson.M {
+	return bson.M{"$regex": regexp.QuoteMeta(text), "$options": "i"}
+}
+
+// List returns the page of the identities matching the query.
+func (list *IdentityList) List(ctx context.Context, query IdentityListQuery) (IdentityPage, error) {
+	query, err := query.Normalize()
+	if err != nil {
+		return IdentityPage{}, err
+	}
+
+	key, direction, _ := query.Sort.key()
+	// The id breaks ties such that the pages do not overlap
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: key, Value: direction}, {Key: "_id", Value: 1}}).
+		SetSkip((query.Page - 1) * query.PageSize).
+		SetLimit(query.PageSize)
+
+	page := IdentityPage{
+		Identities: make([]IdentitySummary, 0),
+		Page:       query.Page,
+		PageSize:   query.PageSize,
+		Total:      0,
+	}
+
+	err = list.withCollection(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		filter := query.filter()
+
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		cursor, err := collection.Find(ctx, filter, findOptions)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var document identityDocument
+			if err := cursor.Decode(&document); err != nil {
+				return err
+			}
+
+			page.Identities = append(page.Identities, document.summary())
+		}
+
+		page.Total = total
+
+		return cursor.Err()
+	})
+	if err != nil {
+		return IdentityPage{}, errors.Wrap(err, ErrCouldNotQueryIdentities.Error())
+	}
+
+	return page, nil
+}
+
+// Find returns the identity with the id, or ErrIdentityNotFound.
+func (list *IdentityList) Find(ctx context.Context, id authentication.IdentityID) (IdentitySummary, error) {
+	var document identityDocument
+
+	err := list.withCollection(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		return collection.FindOne(ctx, bson.D{{Key: "_id", Value: string(id)}}).Decode(&document)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return IdentitySummary{}, errors.Mark(errors.Wrap(err, string(id)), ErrIdentityNotFound)
+	}
+
+	if err != nil {
+		return IdentitySummary{}, errors.Wrap(err, ErrCouldNotQueryIdentities.Error())
+	}
+
+	return document.summary(), nil
+}
+
+func (list *IdentityList) Name() string {
+	return identityListName
+}
+
+// Apply updates the identity of the event. The subject of the
+// events is the canonical email, which the updates are filtered by.
+func (list *IdentityList) Apply(ctx context.Context, event es.Event) error {
+	occurred := time.Unix(int64(event.Timestamp), 0).UTC()
+
+	var (
+		filter bson.D
+		update bson.D
+	)
+
+	switch event.Name {
+	case identityRegisteredTitle:
+		var data authentication.IdentityRegistered
+		if err := event.Unmarshal(&data); err != nil {
+			return errors.Wrap(err, ErrCouldNotApplyIdentity.Error())
+		}
+
+		filter = bson.D{{Key: "_id", Value: data.ID}}
+		update = bson.D{{Key: "$setOnInsert", Value: bson.D{
+			{Key: emailKey, Value: data.Email},
+			{Key: confirmedKey, Value: false},
+			{Key: registeredAtKey, Value: occurred},
+			{Key: lastLoginAtKey, Value: nil},
+			{Key: sessionsKey, Value: bson.A{}},
+		}}}
+	case identityLoggedInTitle:
+		var data authentication.IdentityLoggedIn
+		if err := event.Unmarshal(&data); err != nil {
+			return errors.Wrap(err, ErrCouldNotApplyIdentity.Error())
+		}
+
+		filter = bson.D{{Key: emailKey, Value: string(event.Subject)}}
+		update = bson.D{
+			{Key: "$max", Value: bson.D{{Key: lastLoginAtKey, Value: occurred}}},
+			{Key: "$addToSet", Value: bson.D{{Key: sessionsKey, Value: data.SessionID}}},
+		}
+	case identityLoggedOutTitle:
+		var data authentication.IdentityLoggedOut
+		if err := event.Unmarshal(&data); err != nil {
+			return errors.Wrap(err, ErrCouldNotApplyIdentity.Error())
+		}
+
+		filter = bson.D{{Key: emailKey, Value: string(event.Subject)}}
+		update = bson.D{{Key: "$pull", Value: bson.D{{Key: sessionsKey, Value: data.SessionID}}}}
+	case identityEmailConfirmedTitle:
+		filter = bson.D{{Key: emailKey, Value: string(event.Subject)}}
+		update = bson.D{{Key: "$set", Value: bson.D{{Key: confirmedKey, Value: true}}}}
+	default:
+		return nil
+	}
+
+	return errors.Wrap(
+		list.withCollection(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+			_, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(event.Name == identityRegisteredTitle))
+
+			return err
+		}),
+		ErrCouldNotApplyIdentity.Error(),
+	)
+}
+
+func (list *IdentityList) Reset(ctx context.Context) error {
+	err := list.withCollection(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		return collection.Drop(ctx)
+	})
+	if err != nil {
+		return errors.Wrap(err, ErrCouldNotResetIdentities.Error())
+	}
+
+	// Dropping the collection drops its indexes as well
+	return list.EnsureIndexes(ctx)
+}
+
+// EnsureIndexes creates the indexes of the read model unless they exist.
+// All the events but the registrations are applied by the email.
+func (list *IdentityList) EnsureIndexes(ctx context.Context) error {
+	return errors.Wrap(
+		list.withCollection(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+			_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: emailKey, Value: 1}},
+				Options: nil,
+			})
+
+			return err
+		}),
+		ErrCouldNotIndexIdentities.Error(),
+	)
+}
+
+func (document identityDocument) summary() IdentitySummary {
+	summary := document.IdentitySummary
+	summary.ActiveSessions = len(document.Sessions)
+
+	return summary
+}
+
+func (list *IdentityList) withCollection(
+	ctx context.Context,
+	action func(ctx context.Context, collection *mongo.Collection) error,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, readModelsTimeout)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(list.uri))
+	if err != nil {
+		return err
+	}
+
+	err = action(ctx, client.Database(readModelsDatabase).Collection(identitiesCollection))
+
+	return errors.CombineErrors(err, client.Disconnect(ctx))
+}
@@ -0,0 +1,42 @@
+package cqrs_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/infrastructure/cqrs"
+)
+
+func TestIdentityListQueryDefaults(t *testing.T) {
+	t.Parallel()
+
+	query, err := cqrs.IdentityListQuery{}.Normalize()
+	if err != nil {
+		t.Fatal("Normalize failed with err:", err)
+	}
+
+	if query.Sort != cqrs.SortByRegisteredAt || query.Page != 1 || query.PageSize != 20 {
+		t.Errorf("expected the first page of 20 identities by registration but got %+v", query)
+	}
+}
+
+func TestIdentityListQueryValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		query cqrs.IdentityListQuery
+		err   error
+	}{
+		{"descending sort", cqrs.IdentityListQuery{Sort: "-last_login_at"}, nil},
+		{"unknown sort", cqrs.IdentityListQuery{Sort: "password"}, cqrs.ErrInvalidIdentitySort},
+		{"negative page", cqrs.IdentityListQuery{Page: -1}, cqrs.ErrInvalidIdentityPage},
+		{"too large page", cqrs.IdentityListQuery{PageSize: 101}, cqrs.ErrInvalidIdentityPageSize},
+	}
+
+	for _, test := range tests {
+		if _, err := test.query.Normalize(); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v but got %v", test.name, test.err, err)
+		}
+	}
+}
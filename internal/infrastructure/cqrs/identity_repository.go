@@ -4,76 +4,70 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/hywmongous/example-service/internal/domain/authentication"
 	"github.com/hywmongous/example-service/pkg/es"
-	"github.com/hywmongous/example-service/pkg/es/mediator"
 )
 
+// Tracker is told about the aggregates which are found and added,
+// such that the events they record can be committed.
+type Tracker interface {
+	Track(aggregate es.EventSourced)
+}
+
 type IdentityRepository struct {
-	store    es.EventStore
-	mediator *mediator.Mediator
+	store       es.EventStore
+	tracker     Tracker
+	emailPolicy authentication.EmailPolicy
 }
 
 var (
-	ErrVisitForEventFailed       = errors.New("visiting event failed")
 	ErrCouldNotFindEntity        = errors.New("could not find entity in event store")
 	ErrCouldNotReconstructEntity = errors.New("could not construct entity")
 )
 
 func IdentityRepositoryFactory(
 	store es.EventStore,
-	mediator *mediator.Mediator,
+	tracker Tracker,
+	emailPolicy authentication.EmailPolicy,
 ) authentication.Repository {
 	return IdentityRepository{
-		store:    store,
-		mediator: mediator,
+		store:       store,
+		tracker:     tracker,
+		emailPolicy: emailPolicy,
 	}
 }
 
-func (repository IdentityRepository) FindIdentityByEmail(email string) (authentication.Identity, error) {
-	events, err := repository.store.Concerning(es.SubjectID(email))
+// FindIdentityByEmail finds the identity by the canonical form of the email,
+// which is the subject of its events, hence any spelling of the email finds it.
+// The identities which were registered before the emails were canonicalized
+// are the subject of the email as it was given, so they are found by it instead.
+func (repository IdentityRepository) FindIdentityByEmail(email string) (*authentication.Identity, error) {
+	canonical, err := repository.emailPolicy.Canonicalize(email)
 	if err != nil {
-		return authentication.Identity{}, errors.Wrap(err, ErrCouldNotFindEntity.Error())
+		return nil, err
 	}
 
-	model := identityModel{}
-	if err = visitEvents(events, &model); err != nil {
-		return authentication.Identity{}, errors.Wrap(err, ErrCouldNotReconstructEntity.Error())
-	}
+	subject := es.SubjectID(canonical)
 
-	return authentication.RecreateIdentity(
-		model.id,
-		model.email,
-		model.password,
-		model.sessions,
-		repository.mediator,
-	), nil
-}
+	// Only the emails without events fall back, the other errors of the store are returned
+	events, err := repository.store.Concerning(subject)
+	if ((err == nil && len(events) == 0) || errors.Is(err, es.ErrNoEvents)) && email != canonical {
+		subject = es.SubjectID(email)
+		events, err = repository.store.Concerning(subject)
+	}
 
-func visitEvents(events []es.Event, model readModel) error {
-	for _, event := range events {
-		switch event.Name {
-		case "IdentityRegistered":
-			var data authentication.IdentityRegistered
-			if err := event.Unmarshal(&data); err != nil {
-				return errors.Wrap(err, ErrVisitForEventFailed.Error())
-			}
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotFindEntity.Error())
+	}
 
-			model = model.ApplyIdentityRegistered(&data)
-		case "IdentityLoggedIn":
-			var data authentication.IdentityLoggedIn
-			if err := event.Unmarshal(&data); err != nil {
-				return errors.Wrap(err, ErrVisitForEventFailed.Error())
-			}
+	identity, err := authentication.RecreateIdentity(subject, events)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotReconstructEntity.Error())
+	}
 
-			model = model.ApplyIdentityLoggedIn(&data)
-		case "IdentityLoggedOut":
-			var data authentication.IdentityLoggedOut
-			if err := event.Unmarshal(&data); err != nil {
-				return errors.Wrap(err, ErrVisitForEventFailed.Error())
-			}
+	repository.tracker.Track(identity)
 
-			model = model.ApplyIdentityLoggedOut(&data)
-		}
-	}
+	return identity, nil
+}
 
-	return nil
+func (repository IdentityRepository) Add(identity *authentication.Identity) {
+	repository.tracker.Track(identity)
 }
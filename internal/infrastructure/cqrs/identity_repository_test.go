@@ -0,0 +1,74 @@
+package cqrs_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/hywmongous/example-service/internal/domain/authentication"
+	"github.com/hywmongous/example-service/internal/infrastructure/cqrs"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/file"
+)
+
+type tracker struct{}
+
+func (tracker) Track(aggregate es.EventSourced) {}
+
+func TestFindIdentityByEmailFindsLegacyIdentities(t *testing.T) {
+	t.Parallel()
+
+	store, err := file.CreateFileEventStore(file.DefaultOptions(t.TempDir()))
+	if err != nil {
+		t.Fatal("CreateFileEventStore failed with err:", err)
+	}
+	defer store.Close()
+
+	// Registered before the emails were canonicalized, hence the domain is not folded
+	legacy := "Bob@X.com"
+	if _, err := store.Send("identity", es.SubjectID(legacy), []es.Data{
+		&authentication.IdentityRegistered{ID: "id", Email: legacy, Passwordhash: ""},
+	}); err != nil {
+		t.Fatal("Send failed with err:", err)
+	}
+
+	repository := cqrs.IdentityRepositoryFactory(store, tracker{}, authentication.DefaultEmailPolicy())
+
+	identity, err := repository.FindIdentityByEmail(legacy)
+	if err != nil {
+		t.Fatal("FindIdentityByEmail failed with err:", err)
+	}
+
+	if identity.Email().Address() != legacy {
+		t.Errorf("expected the identity of %q but got %q", legacy, identity.Email().Address())
+	}
+}
+
+var errStoreUnavailable = errors.New("store is unavailable")
+
+// failingStore fails the queries of the subject, and
+// has no events for the other subjects.
+type failingStore struct {
+	es.EventStore
+	subject es.SubjectID
+}
+
+func (store failingStore) Concerning(subject es.SubjectID) ([]es.Event, error) {
+	if subject == store.subject {
+		return nil, errStoreUnavailable
+	}
+
+	return []es.Event{}, nil
+}
+
+func TestFindIdentityByEmailReturnsTheErrorsOfTheStore(t *testing.T) {
+	t.Parallel()
+
+	store := failingStore{EventStore: nil, subject: "bob@x.com"}
+	repository := cqrs.IdentityRepositoryFactory(store, tracker{}, authentication.DefaultEmailPolicy())
+
+	// The spelling is not canonical, which is when the legacy subject is tried
+	if _, err := repository.FindIdentityByEmail("Bob@X.com"); !errors.Is(err, errStoreUnavailable) {
+		t.Error("expected the error of the store but got", err)
+	}
+}
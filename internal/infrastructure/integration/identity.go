@@ -0,0 +1,79 @@
+package integration
+
+import (
+	"github.com/hywmongous/example-service/internal/domain/authentication"
+	"github.com/hywmongous/example-service/pkg/es"
+)
+
+// The integration events of identities. They never contain credentials.
+type (
+	IdentityRegistered struct {
+		IdentityID string `json:"identityId"`
+		Email      string `json:"email"`
+	}
+
+	SessionRevoked struct {
+		Email     string `json:"email"`
+		SessionID string `json:"sessionId"`
+	}
+
+	EmailConfirmed struct {
+		Email string `json:"email"`
+	}
+)
+
+func RegisterIdentityMappings(mapper *Mapper) error {
+	if err := mapper.Register(
+		es.CreateTitleForData(authentication.IdentityRegistered{}),
+		mapIdentityRegistered,
+	); err != nil {
+		return err
+	}
+
+	if err := mapper.Register(
+		es.CreateTitleForData(authentication.IdentityLoggedOut{}),
+		mapIdentityLoggedOut,
+	); err != nil {
+		return err
+	}
+
+	return mapper.Register(
+		es.CreateTitleForData(authentication.IdentityEmailConfirmed{}),
+		mapIdentityEmailConfirmed,
+	)
+}
+
+func mapIdentityRegistered(event es.Event) (es.Data, bool, error) {
+	var registered authentication.IdentityRegistered
+	if err := event.Unmarshal(&registered); err != nil {
+		return nil, false, err
+	}
+
+	return IdentityRegistered{
+		IdentityID: registered.ID,
+		Email:      registered.Email,
+	}, true, nil
+}
+
+func mapIdentityLoggedOut(event es.Event) (es.Data, bool, error) {
+	var loggedOut authentication.IdentityLoggedOut
+	if err := event.Unmarshal(&loggedOut); err != nil {
+		return nil, false, err
+	}
+
+	return SessionRevoked{
+		Email:     string(event.Subject),
+		SessionID: loggedOut.SessionID,
+	}, true, nil
+}
+
+func mapIdentityEmailConfirmed(event es.Event) (es.Data, bool, error) {
+	var confirmed authentication.IdentityEmailConfirmed
+	if err := event.Unmarshal(&confirmed); err != nil {
+		return nil, false, err
+	}
+
+	return EmailConfirmed{
+		Email: confirmed.Email,
+	}, true, nil
+}
@@ -0,0 +1,112 @@
+package integration
+
+import (
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+)
+
+// Mapping turns a domain event into the data of an integration event.
+// Returning false leaves the domain event out of the integration events.
+type Mapping func(event es.Event) (es.Data, bool, error)
+
+// Mapper selects the domain events which other services may depend on
+// and maps them to public integration events. Domain events change with
+// the model, whereas integration events are a contract, so domain events
+// are never published directly.
+type Mapper struct {
+	lock     sync.RWMutex
+	mappings map[es.Title]Mapping
+}
+
+const producer = es.ProducerID("ia")
+
+var (
+	ErrMappingAlreadyRegistered = errors.New("integration mapping is already registered for the domain event")
+	ErrMappingFailed            = errors.New("domain event could not be mapped to an integration event")
+	ErrPublishingFailed         = errors.New("integration events could not be published")
+)
+
+func CreateMapper() *Mapper {
+	return &Mapper{
+		lock:     sync.RWMutex{},
+		mappings: make(map[es.Title]Mapping),
+	}
+}
+
+// MapperFactory provides the mapper with the mappings of all the bounded contexts.
+func MapperFactory() (*Mapper, error) {
+	mapper := CreateMapper()
+	if err := RegisterIdentityMappings(mapper); err != nil {
+		return nil, err
+	}
+
+	return mapper, nil
+}
+
+func (mapper *Mapper) Register(name es.Title, mapping Mapping) error {
+	mapper.lock.Lock()
+	defer mapper.lock.Unlock()
+
+	if _, found := mapper.mappings[name]; found {
+		return errors.Wrap(ErrMappingAlreadyRegistered, string(name))
+	}
+
+	mapper.mappings[name] = mapping
+
+	return nil
+}
+
+// Map returns the integration events of the domain events in the same order.
+// The integration events keep the subject and version of their domain event.
+func (mapper *Mapper) Map(events []es.Event) ([]es.Event, error) {
+	mapper.lock.RLock()
+	defer mapper.lock.RUnlock()
+
+	integrationEvents := make([]es.Event, 0, len(events))
+
+	for _, event := range events {
+		mapping, found := mapper.mappings[event.Name]
+		if !found {
+			continue
+		}
+
+		data, ok, err := mapping(event)
+		if err != nil {
+			return nil, errors.Wrap(err, ErrMappingFailed.Error())
+		}
+
+		if !ok {
+			continue
+		}
+
+		integrationEvents = append(integrationEvents, es.RecreateEvent(
+			event.ID,
+			producer,
+			event.Subject,
+			event.Version,
+			es.InitialEventSchemaVersion,
+			event.SnapshotVersion,
+			es.CreateTitleForData(data),
+			event.Timestamp,
+			data,
+		))
+	}
+
+	return integrationEvents, nil
+}
+
+// Publish maps the domain events and publishes the integration events on the stream.
+func (mapper *Mapper) Publish(stream es.EventStream, events []es.Event) error {
+	integrationEvents, err := mapper.Map(events)
+	if err != nil {
+		return err
+	}
+
+	if len(integrationEvents) == 0 {
+		return nil
+	}
+
+	return errors.Wrap(stream.Publish(integrationEvents), ErrPublishingFailed.Error())
+}
@@ -0,0 +1,68 @@
+package integration_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hywmongous/example-service/internal/domain/authentication"
+	"github.com/hywmongous/example-service/internal/infrastructure/integration"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/memory"
+)
+
+const topic = es.Topic("ia")
+
+func TestPublishesOnlyMappedEvents(t *testing.T) {
+	t.Parallel()
+
+	mapper, err := integration.MapperFactory()
+	if err != nil {
+		t.Fatal("MapperFactory failed with err:", err)
+	}
+
+	stream, err := memory.CreateMemoryStream(memory.CreateBroker(), memory.DefaultOptions(topic))
+	if err != nil {
+		t.Fatal("CreateMemoryStream failed with err:", err)
+	}
+
+	events := []es.Event{
+		es.RecreateEvent("1", "ia", "me@example.com", 0, 0, 0, "IdentityRegistered", 0, &authentication.IdentityRegistered{
+			ID:           "identity",
+			Email:        "me@example.com",
+			Passwordhash: "hash",
+		}),
+		es.RecreateEvent("2", "ia", "me@example.com", 1, 0, 0, "IdentityLoggedIn", 0, &authentication.IdentityLoggedIn{
+			SessionID: "session",
+		}),
+	}
+
+	if err := mapper.Publish(stream, events); err != nil {
+		t.Fatal("Publish failed with err:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	deliveries, _ := stream.Subscribe(ctx, topic)
+	delivery := <-deliveries
+
+	var registered integration.IdentityRegistered
+	if err := delivery.Event.Unmarshal(&registered); err != nil {
+		t.Fatal("Unmarshal failed with err:", err)
+	}
+
+	if registered.IdentityID != "identity" || registered.Email != "me@example.com" {
+		t.Error("the integration event was mapped incorrectly", registered)
+	}
+
+	delivery.Ack()
+
+	select {
+	case delivery, ok := <-deliveries:
+		if ok {
+			t.Error("expected only the registration to be published but got", delivery.Event.Name)
+		}
+	case <-time.After(50 * time.Millisecond):
+	}
+}
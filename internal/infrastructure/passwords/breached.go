@@ -0,0 +1,41 @@
+package passwords
+
+import (
+	// Embeds the bloom filter of the common passwords.
+	_ "embed"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/domain/authentication"
+	"github.com/hywmongous/example-service/pkg/bloom"
+)
+
+// The filter is generated from the 139 most common passwords in tools/bloomgen,
+// hence it only rejects the most obvious passwords. bloomgen can build a filter
+// of a larger corpus with -url, such as the 100,000 most used passwords of the NCSC.
+//go:generate go run ../../../tools/bloomgen -in ../../../tools/bloomgen/common_passwords.txt -out common_passwords.bloom
+
+//go:embed common_passwords.bloom
+var commonPasswords []byte
+
+// BreachedList is the bundled list of common and breached passwords.
+// It is a bloom filter, so a few uncommon passwords are rejected as well.
+type BreachedList struct {
+	filter *bloom.Filter
+}
+
+var ErrCouldNotLoadBreachedList = errors.New("breached password list could not be loaded")
+
+func BreachedListFactory() (authentication.BreachedPasswords, error) {
+	filter, err := bloom.Load(commonPasswords)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotLoadBreachedList.Error())
+	}
+
+	return BreachedList{
+		filter: filter,
+	}, nil
+}
+
+func (list BreachedList) Contains(password string) bool {
+	return list.filter.Contains([]byte(password))
+}
@@ -0,0 +1,62 @@
+package infrastructure
+
+import (
+	"context"
+	"log"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/infrastructure/cqrs"
+	"github.com/hywmongous/example-service/pkg/es/mongo"
+	"github.com/hywmongous/example-service/pkg/es/projection"
+	"go.uber.org/fx"
+)
+
+var ErrCouldNotCreateProjector = errors.New("projector of the read models could not be created")
+
+// StartProjector starts the projector which keeps the read models up to
+// date with the shipped events. It runs for as long as the application does.
+func StartProjector(
+	lifecycle fx.Lifecycle,
+	identityList *cqrs.IdentityList,
+) error {
+	source := projection.CreateStoreSource(mongo.CreateMongoEventStore(), producer)
+
+	projector, err := projection.CreateProjector(
+		source,
+		mongo.CreateMongoCheckpointStore(),
+		projection.DefaultOptions(),
+	)
+	if err != nil {
+		return errors.Wrap(err, ErrCouldNotCreateProjector.Error())
+	}
+
+	if err := projector.Register(identityList); err != nil {
+		return errors.Wrap(err, ErrCouldNotCreateProjector.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				// The read model can be queried without the index, only slower
+				if err := identityList.EnsureIndexes(ctx); err != nil {
+					log.Println("indexing the read models failed with err:", err)
+				}
+
+				for err := range projector.Run(ctx) {
+					log.Println("projecting the read models failed with err:", err)
+				}
+			}()
+
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+
+			return nil
+		},
+	})
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package infrastructure
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/infrastructure/jaeger"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+type RetryOptions struct {
+	// The maximum number of times the request is handled
+	Attempts int
+	// The backoff doubles after every attempt up to the maximum,
+	// and a random jitter of up to the backoff itself is added
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+}
+
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryBackoffMin = 10 * time.Millisecond
+	defaultRetryBackoffMax = 200 * time.Millisecond
+)
+
+var ErrRetriesExhausted = errors.New("request kept conflicting with concurrent requests")
+
+func DefaultRetryOptions() RetryOptions {
+	return RetryOptions{
+		Attempts:   defaultRetryAttempts,
+		BackoffMin: defaultRetryBackoffMin,
+		BackoffMax: defaultRetryBackoffMax,
+	}
+}
+
+// RetryBehaviour handles the requests again when they fail because of
+// a concurrency conflict in the event store. It must be placed before
+// the UnitOfWorkBehaviour, such that every attempt gets a new unit of work
+// and the aggregates are loaded again with the concurrently shipped events.
+// Only requests of the same types as the given requests are retried, since
+// handling a request again must not record its effects twice.
+func RetryBehaviour(options RetryOptions, requests ...mediator.Request) mediator.Behaviour {
+	retryable := make(map[reflect.Type]bool, len(requests))
+	for _, request := range requests {
+		retryable[reflect.TypeOf(request)] = true
+	}
+
+	return func(
+		ctx context.Context,
+		request mediator.Request,
+		next mediator.RequestHandler,
+	) (mediator.Response, error) {
+		if !retryable[reflect.TypeOf(request)] {
+			return next(ctx, request)
+		}
+
+		var err error
+
+		for attempt := 1; attempt <= options.Attempts; attempt++ {
+			var response mediator.Response
+
+			response, err = handleAttempt(ctx, request, next, attempt)
+			if err == nil || !errors.Is(err, es.ErrConcurrencyConflict) {
+				return response, err
+			}
+
+			if attempt < options.Attempts {
+				if err := sleep(ctx, options.backoff(attempt)); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return nil, errors.Wrap(err, ErrRetriesExhausted.Error())
+	}
+}
+
+func handleAttempt(
+	ctx context.Context,
+	request mediator.Request,
+	next mediator.RequestHandler,
+	attempt int,
+) (mediator.Response, error) {
+	span, ctx := jaeger.StartSpanFromSpanContext(ctx, "Attempt")
+	defer span.Finish()
+
+	span.LogFields(log.Int("attempt", attempt))
+
+	response, err := next(ctx, request)
+	if err != nil {
+		jaeger.SetError(span, err)
+	}
+
+	return response, err
+}
+
+func (options RetryOptions) backoff(attempt int) time.Duration {
+	backoff := options.BackoffMin
+
+	for idx := 1; idx < attempt && backoff < options.BackoffMax; idx++ {
+		backoff *= 2
+	}
+
+	if backoff > options.BackoffMax {
+		backoff = options.BackoffMax
+	}
+
+	// The jitter spreads out the requests which conflicted with each other
+	/* #nosec */
+	return backoff + time.Duration(rand.Int63n(int64(backoff)+1))
+}
+
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), ErrRetriesExhausted.Error())
+	}
+}
@@ -0,0 +1,70 @@
+package infrastructure
+
+import (
+	"context"
+	"log"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/infrastructure/jaeger"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+	"github.com/hywmongous/example-service/pkg/es/mongo"
+	"github.com/hywmongous/example-service/pkg/es/scheduler"
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/fx"
+)
+
+var ErrCouldNotCreateScheduler = errors.New("scheduler could not be created")
+
+// SchedulerFactory provides the scheduler, which keeps the schedules in
+// the event store database with a store of its own, since it uses the stage.
+func SchedulerFactory() (*scheduler.Scheduler, error) {
+	created, err := scheduler.CreateScheduler(mongo.CreateMongoEventStore(), scheduler.DefaultOptions())
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotCreateScheduler.Error())
+	}
+
+	return created, nil
+}
+
+// StartScheduler fires the schedules, which send their commands through the
+// bus, for as long as the application runs. The use cases register the types
+// of the commands they schedule, and the bus depends on the use cases, hence
+// the scheduler is given the bus when it starts rather than when it is created.
+func StartScheduler(
+	lifecycle fx.Lifecycle,
+	scheduler *scheduler.Scheduler,
+	bus *mediator.Bus,
+) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tracer, closer := jaeger.Create()
+
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				for err := range scheduler.Run(ctx, busDispatcher(tracer, bus)) {
+					log.Println("firing the schedules failed with err:", err)
+				}
+			}()
+
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+
+			return closer.Close()
+		},
+	})
+}
+
+// busDispatcher sends every command within a span of its own,
+// since the use cases expect their requests to be traced.
+func busDispatcher(tracer opentracing.Tracer, bus *mediator.Bus) scheduler.Dispatcher {
+	return func(ctx context.Context, command mediator.Request) error {
+		span := tracer.StartSpan("Scheduled" + mediator.RequestName(command))
+		defer span.Finish()
+
+		_, err := bus.Send(opentracing.ContextWithSpan(ctx, span), command)
+
+		return err
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/google/uuid"
+)
+
+// ConfirmationSender delivers the confirmation token to the email it confirms.
+type ConfirmationSender func(ctx context.Context, email string, token string) error
+
+const (
+	EmailConfirmationTimeoutHours    = 24
+	EmailConfirmationTimeoutDuration = EmailConfirmationTimeoutHours * time.Hour
+
+	// The audience tells confirmation tokens apart from the session tokens
+	EmailConfirmationAudience = "email-confirmation"
+)
+
+var ErrInvalidConfirmationToken = errors.New("email confirmation token is invalid or expired")
+
+// UnavailableConfirmationSenderFactory provides a sender which fails,
+// since the service is not connected to a mail server.
+func UnavailableConfirmationSenderFactory() ConfirmationSender {
+	return func(ctx context.Context, email string, token string) error {
+		return ErrNoMailServer
+	}
+}
+
+// DropConfirmationSender writes the confirmations to files in the directory
+// instead of sending them. It is meant for development only.
+func DropConfirmationSender(directory string) ConfirmationSender {
+	return func(ctx context.Context, email string, token string) error {
+		return dropMessage(directory, "confirmation", email, token)
+	}
+}
+
+// SignEmailConfirmation issues a token which proves that whoever
+// holds it can read the email. The token expires after a day.
+func (jwtService JWTService) SignEmailConfirmation(email string) (string, error) {
+	return jwtService.signPurpose(
+		email,
+		uuid.NewString(),
+		EmailConfirmationAudience,
+		EmailConfirmationTimeoutDuration,
+	)
+}
+
+// VerifyEmailConfirmation returns the email which the token confirms.
+func (jwtService JWTService) VerifyEmailConfirmation(token string) (string, error) {
+	claims, err := jwtService.verifyPurpose(token, EmailConfirmationAudience)
+	if err != nil {
+		return "", errors.Mark(errors.Wrap(err, ErrInvalidConfirmationToken.Error()), ErrInvalidConfirmationToken)
+	}
+
+	return claims.Subject, nil
+}
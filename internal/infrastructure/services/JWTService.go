@@ -183,10 +183,71 @@ func (jwtService JWTService) Verify(token string, csrf string) (*Claims, error)
 		return nil, errors.Wrap(parsedToken.Claims.Valid(), ErrJwtInvalidToken.Error())
 	}
 
-	// Verify claims
+	// Verify claims, the tokens of other purposes are signed by the same key
+	if claims.Audience != "" {
+		return nil, ErrJwtInvalidToken
+	}
+
 	if claims.Csrf != csrf {
 		return nil, ErrVerificationIncorrectCsrf
 	}
 
 	return &claims, nil
 }
+
+// signPurpose issues a token which can only be used for the purpose
+// of the audience. Session tokens are issued without an audience.
+func (jwtService JWTService) signPurpose(
+	subject string,
+	id string,
+	audience string,
+	timeout time.Duration,
+) (string, error) {
+	now := time.Now()
+
+	token := jwt.NewWithClaims(jwtService.alg, jwt.StandardClaims{
+		Id:        id,
+		Subject:   subject,
+		Issuer:    Issuer,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(timeout).Unix(),
+		Audience:  audience,
+	})
+
+	signed, err := token.SignedString(jwtService.privateKey)
+	if err != nil {
+		return "", errors.Wrap(err, ErrSigningToken.Error())
+	}
+
+	return signed, nil
+}
+
+func (jwtService JWTService) verifyPurpose(token string, audience string) (jwt.StandardClaims, error) {
+	claims := jwt.StandardClaims{}
+
+	parsedToken, err := jwt.ParseWithClaims(
+		token,
+		&claims,
+		func(t *jwt.Token) (interface{}, error) {
+			if t.Method != jwtService.alg {
+				return nil, ErrJwtInvalidKeyType
+			}
+
+			return jwtService.privateKey, nil
+		},
+	)
+	if err != nil {
+		return jwt.StandardClaims{}, errors.Wrap(err, ErrJwtInvalidToken.Error())
+	}
+
+	if !parsedToken.Valid ||
+		!claims.VerifyAudience(audience, true) ||
+		!claims.VerifyIssuer(Issuer, true) ||
+		claims.Subject == "" ||
+		claims.Id == "" {
+		return jwt.StandardClaims{}, ErrJwtInvalidToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/cockroachdb/errors"
+)
+
+var (
+	ErrNoMailServer        = errors.New("no mail server is configured to send the email")
+	ErrCouldNotDropMessage = errors.New("email could not be dropped in the mail directory")
+)
+
+// dropMessage writes the message to a file in the directory, which only the
+// owner can read, instead of sending it. The token is not logged, since it is
+// a credential which anyone who can read the logs could otherwise use.
+func dropMessage(directory string, kind string, email string, token string) error {
+	file, err := os.CreateTemp(directory, kind+"-*.txt")
+	if err != nil {
+		return errors.Wrap(err, ErrCouldNotDropMessage.Error())
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintf(file, "To: %s\nToken: %s\n", email, token); err != nil {
+		return errors.Wrap(err, ErrCouldNotDropMessage.Error())
+	}
+
+	log.Println("Dropped the", kind, "email for", email, "in", file.Name())
+
+	return nil
+}
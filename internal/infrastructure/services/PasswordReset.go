@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// PasswordResetSender delivers the reset token to the email of the identity.
+type PasswordResetSender func(ctx context.Context, email string, token string) error
+
+const (
+	PasswordResetTimeoutMinutes  = 60
+	PasswordResetTimeoutDuration = PasswordResetTimeoutMinutes * time.Minute
+
+	PasswordResetAudience = "password-reset"
+)
+
+var ErrInvalidPasswordResetToken = errors.New("password reset token is invalid or expired")
+
+// UnavailablePasswordResetSenderFactory provides a sender which fails,
+// since the service is not connected to a mail server.
+func UnavailablePasswordResetSenderFactory() PasswordResetSender {
+	return func(ctx context.Context, email string, token string) error {
+		return ErrNoMailServer
+	}
+}
+
+// DropPasswordResetSender writes the resets to files in the directory
+// instead of sending them. It is meant for development only.
+func DropPasswordResetSender(directory string) PasswordResetSender {
+	return func(ctx context.Context, email string, token string) error {
+		return dropMessage(directory, "password-reset", email, token)
+	}
+}
+
+// SignPasswordReset issues a token for the reset of the identity with the
+// email. The token expires after an hour, and the identity only accepts it
+// once, since the id of the token is the id of the reset.
+func (jwtService JWTService) SignPasswordReset(email string, resetID string) (string, error) {
+	return jwtService.signPurpose(
+		email,
+		resetID,
+		PasswordResetAudience,
+		PasswordResetTimeoutDuration,
+	)
+}
+
+// VerifyPasswordReset returns the email and the reset id of the token.
+func (jwtService JWTService) VerifyPasswordReset(token string) (string, string, error) {
+	claims, err := jwtService.verifyPurpose(token, PasswordResetAudience)
+	if err != nil {
+		return "", "", errors.Mark(errors.Wrap(err, ErrInvalidPasswordResetToken.Error()), ErrInvalidPasswordResetToken)
+	}
+
+	return claims.Subject, claims.Id, nil
+}
@@ -5,83 +5,235 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/hywmongous/example-service/internal/domain/authentication"
+	"github.com/hywmongous/example-service/internal/infrastructure/cqrs"
+	"github.com/hywmongous/example-service/internal/infrastructure/integration"
 	"github.com/hywmongous/example-service/internal/infrastructure/jaeger"
 	"github.com/hywmongous/example-service/pkg/es"
 	"github.com/hywmongous/example-service/pkg/es/kafka"
-	"github.com/hywmongous/example-service/pkg/es/mediator"
 	"github.com/hywmongous/example-service/pkg/es/mongo"
+	"go.uber.org/fx"
 )
 
+// UnitOfWork is scoped to a single use case invocation. It owns the store,
+// and thereby the stage, and tracks the aggregates which the repositories
+// find and add. Hence concurrent invocations never see each other's events.
 type UnitOfWork struct {
-	store    es.EventStore
-	stream   es.EventStream
-	mediator *mediator.Mediator
+	store   es.EventStore
+	stream  es.EventStream
+	tracked []es.EventSourced
 
+	emailPolicy        authentication.EmailPolicy
 	identityRepository authentication.Repository
+
+	committedHooks  []CommittedHook
+	rolledBackHooks []RolledBackHook
 }
 
+type (
+	StoreCreator      func() es.EventStore
+	UnitOfWorkCreator func() *UnitOfWork
+
+	// CommittedHook is called with the events once they are shipped.
+	CommittedHook func(ctx context.Context, events []es.Event) error
+	// RolledBackHook is called with the cause when the staged events are discarded.
+	RolledBackHook func(ctx context.Context, cause error)
+)
+
 const (
 	producer = es.ProducerID("ia")
 	topic    = es.Topic("ia")
 )
 
-var ErrEmptyCommit = errors.New("attempting to commit an empty stage")
+var (
+	ErrEmptyCommit          = errors.New("attempting to commit an empty stage")
+	ErrCouldNotCreateStream = errors.New("event stream could not be created")
+	ErrCouldNotLoadEvent    = errors.New("event could not be loaded onto the stage")
+	ErrAggregateOutdated    = errors.New("aggregate is based on outdated events")
+	ErrCommittedHookFailed  = errors.New("events were committed but a committed hook failed")
+)
 
 func (uow *UnitOfWork) IdentityRepository() authentication.Repository {
 	return uow.identityRepository
 }
 
-func MongoStoreFactory() es.EventStore {
-	return mongo.CreateMongoEventStore()
+func (uow *UnitOfWork) EmailPolicy() authentication.EmailPolicy {
+	return uow.emailPolicy
+}
+
+// MongoStoreCreatorFactory provides the stores of the units of work.
+// Each store has its own stage and connects to mongo per operation.
+func MongoStoreCreatorFactory() StoreCreator {
+	return func() es.EventStore {
+		return mongo.CreateMongoEventStore()
+	}
 }
 
-func KafkaStreamFactory() es.EventStream {
-	return kafka.CreateKafkaStream(topic)
+// IndexMongoStore indexes the events before the application starts, since
+// the stores only reject concurrently shipped versions with the indexes.
+func IndexMongoStore(lifecycle fx.Lifecycle) {
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			return mongo.CreateMongoEventStore().EnsureIndexes()
+		},
+		OnStop: nil,
+	})
 }
 
-func UnitOfWorkFactory(
-	store es.EventStore,
-	stream es.EventStream,
-	mediator *mediator.Mediator,
-	identityRepository authentication.Repository,
-) UnitOfWork {
-	uow := UnitOfWork{
-		store:              store,
-		stream:             stream,
-		mediator:           mediator,
-		identityRepository: identityRepository,
+func KafkaStreamFactory(lifecycle fx.Lifecycle) (es.EventStream, error) {
+	stream, err := kafka.CreateKafkaStream(kafka.DefaultOptions(topic))
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotCreateStream.Error())
 	}
 
-	mediator.Listen(uow.receiveEvent)
+	// The writer of the stream lives as long as the application
+	lifecycle.Append(fx.Hook{
+		OnStart: nil,
+		OnStop: func(ctx context.Context) error {
+			return stream.Close()
+		},
+	})
 
-	return uow
+	return stream, nil
+}
+
+// UnitOfWorkCreatorFactory provides the creator of the units of work,
+// which is called once for every use case invocation.
+func UnitOfWorkCreatorFactory(
+	createStore StoreCreator,
+	stream es.EventStream,
+	mapper *integration.Mapper,
+	emailPolicy authentication.EmailPolicy,
+) UnitOfWorkCreator {
+	return func() *UnitOfWork {
+		store := createStore()
+
+		uow := &UnitOfWork{
+			store:              store,
+			stream:             stream,
+			tracked:            make([]es.EventSourced, 0),
+			emailPolicy:        emailPolicy,
+			identityRepository: nil,
+			committedHooks:     make([]CommittedHook, 0),
+			rolledBackHooks:    make([]RolledBackHook, 0),
+		}
+		uow.identityRepository = cqrs.IdentityRepositoryFactory(store, uow, emailPolicy)
+
+		// Other services only learn about the events which are durably shipped
+		uow.OnCommitted(func(ctx context.Context, events []es.Event) error {
+			return mapper.Publish(stream, events)
+		})
+
+		return uow
+	}
 }
 
-func (uow *UnitOfWork) receiveEvent(subject es.SubjectID, data es.Data) {
-	if err := uow.store.Load(
-		producer,
-		subject,
-		data,
-	); err != nil {
-		panic(err)
+// Track makes the events which the aggregate records part of the commit.
+func (uow *UnitOfWork) Track(aggregate es.EventSourced) {
+	for _, tracked := range uow.tracked {
+		if tracked == aggregate {
+			return
+		}
 	}
+
+	uow.tracked = append(uow.tracked, aggregate)
 }
 
 func (uow *UnitOfWork) Commit(ctx context.Context) error {
 	span, ctx := jaeger.StartSpanFromSpanContext(ctx, "UnitOfWork commit")
 	defer span.Finish()
 
+	if err := uow.stageEvents(); err != nil {
+		uow.Rollback(ctx, err)
+
+		return err
+	}
+
 	events := uow.store.Stage().Events()
 	if len(events) == 0 {
 		return ErrEmptyCommit
 	}
 
 	if err := uow.shipEvents(ctx); err != nil {
+		uow.Rollback(ctx, err)
+
 		return err
 	}
-	// if err := uow.stream.Publish(events); err != nil {
-	// 	return errors.Wrap(err, "UnitOfWork stream failed publishing the events")
-	// }
+
+	for _, aggregate := range uow.tracked {
+		aggregate.MarkCommitted()
+	}
+
+	return uow.runCommittedHooks(ctx, events)
+}
+
+// stageEvents loads the uncommitted events of the tracked aggregates onto the
+// stage. The store versions the staged events after its latest events, hence the
+// events of aggregates which were replayed from fewer events are a conflict.
+func (uow *UnitOfWork) stageEvents() error {
+	for _, aggregate := range uow.tracked {
+		uncommitted := aggregate.Uncommitted()
+		if len(uncommitted) == 0 {
+			continue
+		}
+
+		for _, event := range uncommitted {
+			if err := uow.store.Load(producer, aggregate.Subject(), event.Data); err != nil {
+				return errors.Wrap(err, ErrCouldNotLoadEvent.Error())
+			}
+		}
+
+		stage := uow.store.Stage()
+		if staged, _ := stage.FirstEvent(aggregate.Subject()); staged.Version != aggregate.Version() {
+			return errors.Mark(
+				errors.Wrap(ErrAggregateOutdated, string(aggregate.Subject())),
+				es.ErrConcurrencyConflict,
+			)
+		}
+	}
+
+	return nil
+}
+
+// OnCommitted registers a hook which is called after the events are shipped.
+// The hooks are called in the order they are registered, and all of them are
+// called even if some fail, as the events are shipped regardless.
+func (uow *UnitOfWork) OnCommitted(hook CommittedHook) {
+	uow.committedHooks = append(uow.committedHooks, hook)
+}
+
+// OnRolledBack registers a hook which is called when the staged events are
+// discarded, either because the use case failed or because shipping failed.
+func (uow *UnitOfWork) OnRolledBack(hook RolledBackHook) {
+	uow.rolledBackHooks = append(uow.rolledBackHooks, hook)
+}
+
+// Rollback discards the staged events and calls the rolled back hooks.
+func (uow *UnitOfWork) Rollback(ctx context.Context, cause error) {
+	uow.Clear()
+
+	for _, hook := range uow.rolledBackHooks {
+		hook(ctx, cause)
+	}
+}
+
+// The error of the committed hooks is marked with ErrCommittedHookFailed,
+// such that callers can tell that the events were committed nonetheless.
+func (uow *UnitOfWork) runCommittedHooks(ctx context.Context, events []es.Event) error {
+	span, ctx := jaeger.StartSpanFromSpanContext(ctx, "UnitOfWork committed hooks")
+	defer span.Finish()
+
+	var err error
+
+	for _, hook := range uow.committedHooks {
+		err = errors.CombineErrors(err, hook(ctx, events))
+	}
+
+	if err != nil {
+		jaeger.SetError(span, err)
+
+		return errors.Mark(errors.Wrap(err, ErrCommittedHookFailed.Error()), ErrCommittedHookFailed)
+	}
+
 	return nil
 }
 
@@ -97,7 +249,3 @@ func (uow *UnitOfWork) shipEvents(ctx context.Context) error {
 func (uow *UnitOfWork) Clear() {
 	uow.store.Clear()
 }
-
-func (uow *UnitOfWork) Mediator() *mediator.Mediator {
-	return uow.mediator
-}
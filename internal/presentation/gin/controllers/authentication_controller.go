@@ -7,15 +7,17 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/hywmongous/example-service/internal/application"
+	"github.com/hywmongous/example-service/internal/domain/authentication"
 	"github.com/hywmongous/example-service/internal/infrastructure/jaeger"
 	"github.com/hywmongous/example-service/internal/infrastructure/services"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/log"
 )
 
 type AuthenticationController struct {
-	jwtService     services.JWTService
-	registeredUser application.RegisteredUser
+	jwtService services.JWTService
+	bus        *mediator.Bus
 }
 
 const (
@@ -31,11 +33,11 @@ var ErrCouldNotWriteSessionToResponse = errors.New("session could not be written
 
 func AuthenticationControllerFactory(
 	jwtService services.JWTService,
-	registeredUser application.RegisteredUser,
+	bus *mediator.Bus,
 ) AuthenticationController {
 	return AuthenticationController{
-		jwtService:     jwtService,
-		registeredUser: registeredUser,
+		jwtService: jwtService,
+		bus:        bus,
 	}
 }
 
@@ -59,16 +61,16 @@ func (controller AuthenticationController) Login(context *gin.Context) {
 		Password: password,
 	}
 
-	response, err := controller.registeredUser.Login(ctx, request)
-	if err != nil {
+	result, err := controller.bus.Send(ctx, request)
+	if errors.Is(err, authentication.ErrEmailNotConfirmed) {
+		// The password is correct, so the user may learn what is missing
 		jaeger.SetError(span, err)
-		// log.Println("Login endpoint error", err)
-		context.Writer.WriteHeader(http.StatusUnauthorized)
+		context.String(http.StatusForbidden, authentication.ErrEmailNotConfirmed.Error())
 
 		return
 	}
 
-	if err = controller.writeSessionToResponse(context, email, response.SessionID); err != nil {
+	if err != nil {
 		jaeger.SetError(span, err)
 		// log.Println("Login endpoint error", err)
 		context.Writer.WriteHeader(http.StatusUnauthorized)
@@ -76,9 +78,17 @@ func (controller AuthenticationController) Login(context *gin.Context) {
 		return
 	}
 
-	if response == nil {
+	response, ok := result.(*application.LoginIdentityResponse)
+	if !ok || response == nil {
+		jaeger.SetError(span, ErrUnexpectedResponse)
+		context.Writer.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	if err = controller.writeSessionToResponse(context, email, response.SessionID); err != nil {
 		jaeger.SetError(span, err)
-		// log.Println("Login response was nil")
+		// log.Println("Login endpoint error", err)
 		context.Writer.WriteHeader(http.StatusUnauthorized)
 
 		return
@@ -115,7 +125,7 @@ func (controller AuthenticationController) Logout(context *gin.Context) {
 		SessionID: claims.SessionID,
 	}
 
-	response, err := controller.registeredUser.Logout(ctx, request)
+	result, err := controller.bus.Send(ctx, request)
 	if err != nil {
 		// log.Println(err)
 		context.String(http.StatusUnauthorized, err.Error())
@@ -123,6 +133,13 @@ func (controller AuthenticationController) Logout(context *gin.Context) {
 		return
 	}
 
+	response, ok := result.(*application.LogoutIdentityResponse)
+	if !ok {
+		context.String(http.StatusInternalServerError, ErrUnexpectedResponse.Error())
+
+		return
+	}
+
 	context.JSON(http.StatusOK, response)
 }
 
@@ -1,32 +1,77 @@
 package controllers
 
 import (
-	"errors"
 	"net/http"
 
+	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/hywmongous/example-service/internal/application"
+	"github.com/hywmongous/example-service/internal/domain/authentication"
+	"github.com/hywmongous/example-service/internal/infrastructure/cqrs"
 	"github.com/hywmongous/example-service/internal/infrastructure/jaeger"
+	"github.com/hywmongous/example-service/internal/infrastructure/services"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/log"
 )
 
 type IdentityController struct {
-	unregisteredUser application.UnregisteredUser
+	bus        *mediator.Bus
+	identities *cqrs.IdentityList
 }
 
-var ErrInvalidBasicAuth = errors.New("basic auth does not have email and password")
+// changePasswordBody is the body of Change, the rest is in the path and the session.
+type changePasswordBody struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required"`
+}
+
+var (
+	ErrInvalidBasicAuth   = errors.New("basic auth does not have email and password")
+	ErrUnexpectedResponse = errors.New("use case responded with an unexpected type")
+)
 
 func AccountControllerFactory(
-	unregisteredUser application.UnregisteredUser,
+	bus *mediator.Bus,
+	identities *cqrs.IdentityList,
 ) IdentityController {
 	return IdentityController{
-		unregisteredUser: unregisteredUser,
+		bus:        bus,
+		identities: identities,
 	}
 }
 
+// GetAll lists a page of the identities, which can be filtered by
+// ?email= and ?confirmed=, sorted by ?sort= and paginated by ?page= and ?page_size=.
 func (controller IdentityController) GetAll(context *gin.Context) {
-	context.String(http.StatusOK, "Retrieving all accounts")
+	ctx := context.Request.Context()
+	span := opentracing.SpanFromContext(ctx)
+
+	var query cqrs.IdentityListQuery
+	if err := context.ShouldBindQuery(&query); err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	query, err := query.Normalize()
+	if err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	page, err := controller.identities.List(ctx, query)
+	if err != nil {
+		context.String(http.StatusInternalServerError, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	context.JSON(http.StatusOK, page)
 }
 
 func (controller IdentityController) Create(context *gin.Context) {
@@ -48,7 +93,20 @@ func (controller IdentityController) Create(context *gin.Context) {
 		Password: password,
 	}
 
-	response, err := controller.unregisteredUser.Register(ctx, request)
+	result, err := controller.bus.Send(ctx, request)
+
+	var policyErr *authentication.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		// The violations tell the user how to choose a stronger password
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error":      authentication.ErrWeakPassword.Error(),
+			"violations": policyErr.Violations,
+		})
+		jaeger.SetError(span, err)
+
+		return
+	}
+
 	if err != nil {
 		context.String(http.StatusInternalServerError, err.Error())
 		jaeger.SetError(span, err)
@@ -56,17 +114,235 @@ func (controller IdentityController) Create(context *gin.Context) {
 		return
 	}
 
+	response, ok := result.(*application.RegisterIdentityResponse)
+	if !ok {
+		context.String(http.StatusInternalServerError, ErrUnexpectedResponse.Error())
+		jaeger.SetError(span, ErrUnexpectedResponse)
+
+		return
+	}
+
 	context.JSON(http.StatusCreated, response)
 }
 
+// Confirm confirms the email of the identity with the token which was sent to it.
+func (controller IdentityController) Confirm(context *gin.Context) {
+	ctx := context.Request.Context()
+	span := opentracing.SpanFromContext(ctx)
+
+	var request application.ConfirmIdentityEmailRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	result, err := controller.bus.Send(ctx, &request)
+
+	switch {
+	case errors.IsAny(err, services.ErrInvalidConfirmationToken, application.ErrMissingToken):
+		context.String(http.StatusBadRequest, services.ErrInvalidConfirmationToken.Error())
+		jaeger.SetError(span, err)
+
+		return
+	case errors.Is(err, authentication.ErrEmailAlreadyConfirmed):
+		context.String(http.StatusConflict, authentication.ErrEmailAlreadyConfirmed.Error())
+
+		return
+	case err != nil:
+		context.String(http.StatusInternalServerError, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	response, ok := result.(*application.ConfirmIdentityEmailResponse)
+	if !ok {
+		context.String(http.StatusInternalServerError, ErrUnexpectedResponse.Error())
+		jaeger.SetError(span, ErrUnexpectedResponse)
+
+		return
+	}
+
+	context.JSON(http.StatusOK, response)
+}
+
 func (controller IdentityController) Get(context *gin.Context) {
-	// accountId := context.Param("aid")
-	context.String(http.StatusOK, "Retrieving the account")
+	ctx := context.Request.Context()
+	span := opentracing.SpanFromContext(ctx)
+
+	identity, err := controller.identities.Find(ctx, authentication.IdentityID(context.Param("aid")))
+	if errors.Is(err, cqrs.ErrIdentityNotFound) {
+		context.String(http.StatusNotFound, cqrs.ErrIdentityNotFound.Error())
+
+		return
+	}
+
+	if err != nil {
+		context.String(http.StatusInternalServerError, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	context.JSON(http.StatusOK, identity)
 }
 
+// Change changes the password of the identity of the session. The current
+// password is required as well, such that a stolen session cannot take over the identity.
 func (controller IdentityController) Change(context *gin.Context) {
-	// accountId := context.Param("aid")
-	context.String(http.StatusOK, "Changing the account information")
+	ctx := context.Request.Context()
+	span := opentracing.SpanFromContext(ctx)
+
+	claims, err := claimsOf(context)
+	if err != nil {
+		context.String(http.StatusUnauthorized, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	var body changePasswordBody
+	if err := context.ShouldBindJSON(&body); err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	span.LogFields(log.String("subject", claims.Subject))
+
+	request := &application.ChangeIdentityPasswordRequest{
+		IdentityID:      context.Param("aid"),
+		Email:           claims.Subject,
+		SessionID:       claims.SessionID,
+		CurrentPassword: body.CurrentPassword,
+		NewPassword:     body.NewPassword,
+	}
+
+	result, err := controller.bus.Send(ctx, request)
+	if controller.writePasswordError(context, err) {
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	response, ok := result.(*application.ChangeIdentityPasswordResponse)
+	if !ok {
+		context.String(http.StatusInternalServerError, ErrUnexpectedResponse.Error())
+		jaeger.SetError(span, ErrUnexpectedResponse)
+
+		return
+	}
+
+	context.JSON(http.StatusOK, response)
+}
+
+// ForgotPassword sends a password reset token to the email. It is accepted
+// whether or not the email is registered, which the response does not reveal.
+func (controller IdentityController) ForgotPassword(context *gin.Context) {
+	ctx := context.Request.Context()
+	span := opentracing.SpanFromContext(ctx)
+
+	var request application.ForgotIdentityPasswordRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	result, err := controller.bus.Send(ctx, &request)
+	if errors.IsAny(err, mediator.ErrInvalidRequest, authentication.ErrInvalidEmail) {
+		context.String(http.StatusBadRequest, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	if err != nil {
+		context.String(http.StatusInternalServerError, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	response, ok := result.(*application.ForgotIdentityPasswordResponse)
+	if !ok {
+		context.String(http.StatusInternalServerError, ErrUnexpectedResponse.Error())
+		jaeger.SetError(span, ErrUnexpectedResponse)
+
+		return
+	}
+
+	context.JSON(http.StatusAccepted, response)
+}
+
+// ResetPassword sets the password with the token which was sent by ForgotPassword.
+func (controller IdentityController) ResetPassword(context *gin.Context) {
+	ctx := context.Request.Context()
+	span := opentracing.SpanFromContext(ctx)
+
+	var request application.ResetIdentityPasswordRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	result, err := controller.bus.Send(ctx, &request)
+	if errors.IsAny(err, services.ErrInvalidPasswordResetToken, authentication.ErrPasswordResetInvalid) {
+		// Used, replaced and expired tokens are all equally invalid
+		context.String(http.StatusBadRequest, services.ErrInvalidPasswordResetToken.Error())
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	if controller.writePasswordError(context, err) {
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	response, ok := result.(*application.ResetIdentityPasswordResponse)
+	if !ok {
+		context.String(http.StatusInternalServerError, ErrUnexpectedResponse.Error())
+		jaeger.SetError(span, ErrUnexpectedResponse)
+
+		return
+	}
+
+	context.JSON(http.StatusOK, response)
+}
+
+// writePasswordError writes the response of the errors of setting a
+// password and reports whether there was an error to respond with.
+func (controller IdentityController) writePasswordError(context *gin.Context, err error) bool {
+	var policyErr *authentication.PasswordPolicyError
+
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &policyErr):
+		// The violations tell the user how to choose a stronger password
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error":      authentication.ErrWeakPassword.Error(),
+			"violations": policyErr.Violations,
+		})
+	case errors.Is(err, mediator.ErrInvalidRequest):
+		context.String(http.StatusBadRequest, err.Error())
+	case errors.IsAny(err, authentication.ErrIncorrectPassword, application.ErrIdentityMismatch):
+		context.String(http.StatusForbidden, err.Error())
+	case errors.Is(err, authentication.ErrSessionNotFound):
+		context.String(http.StatusUnauthorized, err.Error())
+	default:
+		context.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return true
 }
 
 func (controller IdentityController) Delete(context *gin.Context) {
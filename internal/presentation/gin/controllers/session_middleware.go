@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/hywmongous/example-service/internal/infrastructure/jaeger"
+	"github.com/hywmongous/example-service/internal/infrastructure/services"
+	"github.com/opentracing/opentracing-go"
+)
+
+// SessionMiddleware only lets the requests of signed in identities through,
+// which send the access token cookie along with the CSRF token header.
+type SessionMiddleware struct {
+	jwtService services.JWTService
+}
+
+const claimsContextKey = "claims"
+
+var ErrClaimsNotFound = errors.New("request context does not have the claims of a session")
+
+func SessionMiddlewareFactory(
+	jwtService services.JWTService,
+) SessionMiddleware {
+	return SessionMiddleware{
+		jwtService: jwtService,
+	}
+}
+
+// RequireSession verifies the session of the request and passes its claims
+// to the handlers after it, or aborts the request if it is not signed in.
+func (middleware SessionMiddleware) RequireSession(context *gin.Context) {
+	span := opentracing.SpanFromContext(context.Request.Context())
+
+	accessToken, err := context.Cookie(jwtAccessTokenCookieName)
+	if err != nil {
+		context.String(http.StatusUnauthorized, err.Error())
+		context.Abort()
+
+		return
+	}
+
+	claims, err := middleware.jwtService.Verify(accessToken, context.Request.Header.Get(csrfHeaderKey))
+	if err != nil {
+		context.String(http.StatusUnauthorized, err.Error())
+		context.Abort()
+		jaeger.SetError(span, err)
+
+		return
+	}
+
+	context.Set(claimsContextKey, claims)
+	context.Next()
+}
+
+// claimsOf returns the claims which RequireSession passed to the handler.
+func claimsOf(context *gin.Context) (*services.Claims, error) {
+	value, found := context.Get(claimsContextKey)
+	if !found {
+		return nil, ErrClaimsNotFound
+	}
+
+	claims, ok := value.(*services.Claims)
+	if !ok {
+		return nil, ErrClaimsNotFound
+	}
+
+	return claims, nil
+}
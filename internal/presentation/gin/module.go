@@ -3,32 +3,72 @@ package gin
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/hywmongous/example-service/internal/application"
+	"github.com/hywmongous/example-service/internal/domain/authentication"
 	"github.com/hywmongous/example-service/internal/infrastructure"
 	"github.com/hywmongous/example-service/internal/infrastructure/cqrs"
+	"github.com/hywmongous/example-service/internal/infrastructure/integration"
+	"github.com/hywmongous/example-service/internal/infrastructure/passwords"
 	"github.com/hywmongous/example-service/internal/infrastructure/services"
 	"github.com/hywmongous/example-service/internal/presentation/gin/controllers"
 	"github.com/hywmongous/example-service/internal/presentation/gin/routes"
-	"github.com/hywmongous/example-service/pkg/es/mediator"
+	"github.com/hywmongous/example-service/internal/presentation/grpc"
 	"go.uber.org/fx"
 )
 
 func Run() {
+	fx.New(module(senderOptions())).Run()
+}
+
+// RunDevelopment runs the service with the emails, which hold credentials
+// such as password reset tokens, written to the directory instead of sent.
+func RunDevelopment(mailDirectory string) {
+	fx.New(module(developmentSenderOptions(mailDirectory))).Run()
+}
+
+// senderOptions fails sending the emails, since
+// the service is not connected to a mail server.
+func senderOptions() fx.Option {
+	return fx.Options(
+		fx.Provide(services.UnavailableConfirmationSenderFactory),
+		fx.Provide(services.UnavailablePasswordResetSenderFactory),
+	)
+}
+
+func developmentSenderOptions(mailDirectory string) fx.Option {
+	return fx.Options(
+		fx.Provide(func() services.ConfirmationSender {
+			return services.DropConfirmationSender(mailDirectory)
+		}),
+		fx.Provide(func() services.PasswordResetSender {
+			return services.DropPasswordResetSender(mailDirectory)
+		}),
+	)
+}
+
+func module(senders fx.Option) fx.Option {
 	engineOptions := fx.Provide(gin.New)
 
 	actorOptions := fx.Options(
 		fx.Provide(application.UnregisteredUserFactory),
 		fx.Provide(application.RegisteredUserFactory),
+		fx.Provide(application.BusFactory),
 	)
 
 	infrastructureOptions := fx.Options(
 		fx.Provide(services.JWTServiceFactory),
-		fx.Provide(
-			mediator.Create,
-			infrastructure.UnitOfWorkFactory,
-			cqrs.IdentityRepositoryFactory,
-		),
+		fx.Provide(infrastructure.UnitOfWorkCreatorFactory),
+		fx.Provide(integration.MapperFactory),
 		fx.Provide(infrastructure.KafkaStreamFactory),
-		fx.Provide(infrastructure.MongoStoreFactory),
+		fx.Provide(infrastructure.MongoStoreCreatorFactory),
+		fx.Invoke(infrastructure.IndexMongoStore),
+		fx.Provide(authentication.DefaultEmailPolicy),
+		fx.Provide(authentication.DefaultPasswordPolicy),
+		fx.Provide(authentication.DefaultLoginPolicy),
+		fx.Provide(passwords.BreachedListFactory),
+		fx.Provide(cqrs.IdentityListFactory),
+		fx.Invoke(infrastructure.StartProjector),
+		fx.Provide(infrastructure.SchedulerFactory),
+		fx.Invoke(infrastructure.StartScheduler),
 	)
 
 	controllerOptions := fx.Options(
@@ -36,6 +76,7 @@ func Run() {
 		fx.Provide(controllers.AuthenticationControllerFactory),
 		fx.Provide(controllers.SessionControllerFactory),
 		fx.Provide(controllers.TicketControllerFactory),
+		fx.Provide(controllers.SessionMiddlewareFactory),
 	)
 
 	routeOptions := fx.Options(
@@ -46,14 +87,14 @@ func Run() {
 		fx.Provide(routes.CreateTicketRoutes),
 	)
 
-	module := fx.Options(
+	return fx.Options(
 		controllerOptions,
 		routeOptions,
 		infrastructureOptions,
+		senders,
 		engineOptions,
 		actorOptions,
+		grpc.Module(),
 		fx.Invoke(bootstrap),
 	)
-
-	fx.New(module).Run()
 }
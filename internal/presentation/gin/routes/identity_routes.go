@@ -8,28 +8,37 @@ import (
 type AccountRoutes struct {
 	engine     *gin.Engine
 	controller controllers.IdentityController
+	middleware controllers.SessionMiddleware
 }
 
 func CreateAccountRoutes(
 	engine *gin.Engine,
 	controller controllers.IdentityController,
+	middleware controllers.SessionMiddleware,
 ) AccountRoutes {
 	return AccountRoutes{
 		engine:     engine,
 		controller: controller,
+		middleware: middleware,
 	}
 }
 
 func (routes AccountRoutes) Setup() {
 	group := routes.engine.Group("/api/v1")
-	// GET since we are reading all accounts
-	group.GET("/identities", routes.controller.GetAll)
+	// GET since we are reading all accounts, which only signed in identities may
+	group.GET("/identities", routes.middleware.RequireSession, routes.controller.GetAll)
 	// POST since we are creating an account
 	group.POST("/identities", routes.controller.Create)
-	// GET since we read a single account
-	group.GET("/identities/:aid", routes.controller.Get)
+	// POST since we are creating the confirmation of the email in the token
+	group.POST("/identities/confirmations", routes.controller.Confirm)
+	// POST since we are creating a reset of the password of the email
+	group.POST("/identities/password-resets", routes.controller.ForgotPassword)
+	// POST since the password is set with the token of a reset, which is used up
+	group.POST("/identities/passwords", routes.controller.ResetPassword)
+	// GET since we read a single account, which only signed in identities may
+	group.GET("/identities/:aid", routes.middleware.RequireSession, routes.controller.Get)
 	// PATCH since we are patiallying updating an account
-	group.PATCH("/identities/:aid", routes.controller.Change)
+	group.PATCH("/identities/:aid", routes.middleware.RequireSession, routes.controller.Change)
 	// DELETE since we are deleting the account (Aggregate root)
 	group.DELETE("/identities/:aid", routes.controller.Delete)
 }
@@ -0,0 +1,26 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/infrastructure/services"
+)
+
+type claimsKey struct{}
+
+var ErrClaimsNotFound = errors.New("claims were not found in context")
+
+// WithClaims returns a context which carries the verified claims to the server.
+func WithClaims(ctx context.Context, claims *services.Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func ClaimsFromContext(ctx context.Context) (*services.Claims, error) {
+	claims, ok := ctx.Value(claimsKey{}).(*services.Claims)
+	if !ok || claims == nil {
+		return nil, ErrClaimsNotFound
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,201 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	"github.com/google/uuid"
+	"github.com/hywmongous/example-service/internal/application"
+	"github.com/hywmongous/example-service/internal/infrastructure/services"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// IdentityServer serves the identity use cases by sending
+// the requests through the same bus as the gin controllers.
+type IdentityServer struct {
+	application.UnimplementedIdentityUseCasesServer
+	jwtService services.JWTService
+	bus        *mediator.Bus
+}
+
+var (
+	ErrUnexpectedResponse         = errors.New("use case responded with an unexpected type")
+	ErrClaimsMismatch             = errors.New("request does not concern the authenticated session")
+	ErrCouldNotWriteSessionTokens = errors.New("session tokens could not be written to the response headers")
+)
+
+func IdentityServerFactory(
+	jwtService services.JWTService,
+	bus *mediator.Bus,
+) application.IdentityUseCasesServer {
+	return &IdentityServer{
+		UnimplementedIdentityUseCasesServer: application.UnimplementedIdentityUseCasesServer{},
+		jwtService:                          jwtService,
+		bus:                                 bus,
+	}
+}
+
+func (server *IdentityServer) RegisterIdentity(
+	ctx context.Context,
+	request *application.RegisterIdentityRequest,
+) (*application.RegisterIdentityResponse, error) {
+	result, err := server.bus.Send(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, ok := result.(*application.RegisterIdentityResponse)
+	if !ok {
+		return nil, ErrUnexpectedResponse
+	}
+
+	return response, nil
+}
+
+func (server *IdentityServer) LoginIdentity(
+	ctx context.Context,
+	request *application.LoginIdentityRequest,
+) (*application.LoginIdentityResponse, error) {
+	result, err := server.bus.Send(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, ok := result.(*application.LoginIdentityResponse)
+	if !ok {
+		return nil, ErrUnexpectedResponse
+	}
+
+	if err := server.writeSessionTokens(ctx, request.Email, response.SessionID); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (server *IdentityServer) LogoutIdentity(
+	ctx context.Context,
+	request *application.LogoutIdentityRequest,
+) (*application.LogoutIdentityResponse, error) {
+	// The auth interceptor has verified the token, but only
+	// the owner of the session is allowed to revoke it
+	claims, err := ClaimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject != request.Email || claims.SessionID != request.SessionID {
+		return nil, ErrClaimsMismatch
+	}
+
+	result, err := server.bus.Send(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, ok := result.(*application.LogoutIdentityResponse)
+	if !ok {
+		return nil, ErrUnexpectedResponse
+	}
+
+	return response, nil
+}
+
+func (server *IdentityServer) ConfirmIdentityEmail(
+	ctx context.Context,
+	request *application.ConfirmIdentityEmailRequest,
+) (*application.ConfirmIdentityEmailResponse, error) {
+	result, err := server.bus.Send(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, ok := result.(*application.ConfirmIdentityEmailResponse)
+	if !ok {
+		return nil, ErrUnexpectedResponse
+	}
+
+	return response, nil
+}
+
+func (server *IdentityServer) ChangeIdentityPassword(
+	ctx context.Context,
+	request *application.ChangeIdentityPasswordRequest,
+) (*application.ChangeIdentityPasswordResponse, error) {
+	// Only the session of the identity may change its password
+	claims, err := ClaimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject != request.Email || claims.SessionID != request.SessionID {
+		return nil, ErrClaimsMismatch
+	}
+
+	result, err := server.bus.Send(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, ok := result.(*application.ChangeIdentityPasswordResponse)
+	if !ok {
+		return nil, ErrUnexpectedResponse
+	}
+
+	return response, nil
+}
+
+func (server *IdentityServer) ForgotIdentityPassword(
+	ctx context.Context,
+	request *application.ForgotIdentityPasswordRequest,
+) (*application.ForgotIdentityPasswordResponse, error) {
+	result, err := server.bus.Send(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, ok := result.(*application.ForgotIdentityPasswordResponse)
+	if !ok {
+		return nil, ErrUnexpectedResponse
+	}
+
+	return response, nil
+}
+
+func (server *IdentityServer) ResetIdentityPassword(
+	ctx context.Context,
+	request *application.ResetIdentityPasswordRequest,
+) (*application.ResetIdentityPasswordResponse, error) {
+	result, err := server.bus.Send(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, ok := result.(*application.ResetIdentityPasswordResponse)
+	if !ok {
+		return nil, ErrUnexpectedResponse
+	}
+
+	return response, nil
+}
+
+// writeSessionTokens sends the access token and the CSRF token in the
+// response headers, under the same keys as the auth interceptor reads
+// them from, such that the clients can send them with the secured calls.
+func (server *IdentityServer) writeSessionTokens(ctx context.Context, subject string, sid string) error {
+	csrf := uuid.NewString()
+
+	tokens, err := server.jwtService.Sign(subject, sid, csrf)
+	if err != nil {
+		return errors.Wrap(err, ErrCouldNotWriteSessionTokens.Error())
+	}
+
+	header := metadata.Pairs(
+		authorizationMetadataKey, bearerPrefix+tokens.AccessToken,
+		csrfMetadataKey, csrf,
+	)
+
+	return errors.Wrap(grpc.SetHeader(ctx, header), ErrCouldNotWriteSessionTokens.Error())
+}
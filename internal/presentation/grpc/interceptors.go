@@ -0,0 +1,204 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/application"
+	"github.com/hywmongous/example-service/internal/domain/authentication"
+	"github.com/hywmongous/example-service/internal/infrastructure/jaeger"
+	"github.com/hywmongous/example-service/internal/infrastructure/services"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	authorizationMetadataKey = "authorization"
+	// The same header as the gin controllers use for the CSRF token
+	csrfMetadataKey = "csrf"
+	bearerPrefix    = "Bearer "
+)
+
+var (
+	ErrUnauthenticated    = errors.New("call could not be authenticated")
+	ErrMissingToken       = errors.New("call metadata does not have a bearer token")
+	ErrInvalidCredentials = errors.New("email or password is incorrect")
+	ErrInternal           = errors.New("internal error")
+)
+
+// The first matching error determines the code, hence
+// the more specific errors must come before the general ones.
+// Errors with a message are sent with it instead of their own,
+// such that the clients cannot tell whether an email is registered.
+var errorCodes = []struct {
+	err     error
+	code    codes.Code
+	message string
+}{
+	{err: context.Canceled, code: codes.Canceled, message: ""},
+	{err: context.DeadlineExceeded, code: codes.DeadlineExceeded, message: ""},
+	{err: mediator.ErrInvalidRequest, code: codes.InvalidArgument, message: ""},
+	{err: authentication.ErrInvalidEmail, code: codes.InvalidArgument, message: ""},
+	{err: authentication.ErrEmailTooLong, code: codes.InvalidArgument, message: ""},
+	{err: authentication.ErrPlusAddressingRejected, code: codes.InvalidArgument, message: ""},
+	{err: authentication.ErrWeakPassword, code: codes.InvalidArgument, message: ""},
+	{err: services.ErrInvalidConfirmationToken, code: codes.InvalidArgument, message: ""},
+	{err: services.ErrInvalidPasswordResetToken, code: codes.InvalidArgument, message: ""},
+	{err: authentication.ErrPasswordResetInvalid, code: codes.InvalidArgument, message: ""},
+	{err: mediator.ErrHandlerNotFound, code: codes.Unimplemented, message: ""},
+	{err: ErrUnauthenticated, code: codes.Unauthenticated, message: ""},
+	{err: ErrClaimsNotFound, code: codes.Unauthenticated, message: ""},
+	{err: authentication.ErrIncorrectPassword, code: codes.Unauthenticated, message: ErrInvalidCredentials.Error()},
+	{err: authentication.ErrIdentityHasNoEvents, code: codes.Unauthenticated, message: ErrInvalidCredentials.Error()},
+	{err: es.ErrNoEvents, code: codes.Unauthenticated, message: ErrInvalidCredentials.Error()},
+	{err: ErrClaimsMismatch, code: codes.PermissionDenied, message: ""},
+	{err: application.ErrIdentityMismatch, code: codes.PermissionDenied, message: ""},
+	{err: authentication.ErrEmailNotConfirmed, code: codes.FailedPrecondition, message: ""},
+	{err: authentication.ErrEmailAlreadyConfirmed, code: codes.FailedPrecondition, message: ""},
+	{err: authentication.ErrSessionNotFound, code: codes.NotFound, message: ""},
+	{err: es.ErrConcurrencyConflict, code: codes.Aborted, message: ""},
+}
+
+// TracingInterceptor handles the call within a server span named after the method.
+// The span continues the trace of the client if its context is in the metadata.
+func TracingInterceptor(tracer opentracing.Tracer) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		request interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		// A missing or malformed client context starts a new trace
+		client, _ := tracer.Extract(opentracing.HTTPHeaders, metadataCarrier(md))
+
+		span := tracer.StartSpan(
+			info.FullMethod,
+			ext.RPCServerOption(client),
+			opentracing.Tag{Key: string(ext.Component), Value: "gRPC"},
+		)
+		defer span.Finish()
+
+		response, err := handler(opentracing.ContextWithSpan(ctx, span), request)
+		if err != nil {
+			jaeger.SetError(span, err)
+		}
+
+		return response, err
+	}
+}
+
+// AuthInterceptor verifies the bearer token of calls to the given methods
+// and passes the claims to the server through the context. The CSRF token
+// is required as well, since the tokens are signed together with it.
+func AuthInterceptor(jwtService services.JWTService, methods ...string) grpc.UnaryServerInterceptor {
+	authenticated := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		authenticated[method] = true
+	}
+
+	return func(
+		ctx context.Context,
+		request interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if !authenticated[info.FullMethod] {
+			return handler(ctx, request)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		token := firstValue(md, authorizationMetadataKey)
+		if !strings.HasPrefix(token, bearerPrefix) {
+			return nil, errors.Mark(ErrMissingToken, ErrUnauthenticated)
+		}
+
+		claims, err := jwtService.Verify(
+			strings.TrimPrefix(token, bearerPrefix),
+			firstValue(md, csrfMetadataKey),
+		)
+		if err != nil {
+			return nil, errors.Mark(errors.Wrap(err, ErrUnauthenticated.Error()), ErrUnauthenticated)
+		}
+
+		return handler(WithClaims(ctx, claims), request)
+	}
+}
+
+// ErrorInterceptor maps the errors of the server to status codes,
+// such that clients can tell why the call failed. Errors which
+// already carry a status are passed through unchanged. Unknown
+// errors are sent as internal without their details, which are
+// logged on the span of the call instead.
+func ErrorInterceptor(
+	ctx context.Context,
+	request interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	response, err := handler(ctx, request)
+	if err != nil {
+		known := statusOf(err)
+		if span := opentracing.SpanFromContext(ctx); span != nil && known.Code() == codes.Internal {
+			span.LogFields(log.Error(err))
+		}
+
+		return nil, known.Err()
+	}
+
+	return response, nil
+}
+
+func statusOf(err error) *status.Status {
+	if known, ok := status.FromError(err); ok {
+		return known
+	}
+
+	for _, errorCode := range errorCodes {
+		if !errors.Is(err, errorCode.err) {
+			continue
+		}
+
+		if errorCode.message != "" {
+			return status.New(errorCode.code, errorCode.message)
+		}
+
+		return status.New(errorCode.code, err.Error())
+	}
+
+	return status.New(codes.Internal, ErrInternal.Error())
+}
+
+func firstValue(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// metadataCarrier lets the tracer read the span context from the call metadata.
+type metadataCarrier metadata.MD
+
+func (carrier metadataCarrier) ForeachKey(handler func(key, val string) error) error {
+	for key, values := range carrier {
+		for _, value := range values {
+			if err := handler(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package grpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/domain/authentication"
+	"github.com/hywmongous/example-service/internal/infrastructure/services"
+	server "github.com/hywmongous/example-service/internal/presentation/grpc"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func failingHandler(err error) grpc.UnaryHandler {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, err
+	}
+}
+
+func TestErrorInterceptorMapsErrorsToCodes(t *testing.T) {
+	t.Parallel()
+
+	info := &grpc.UnaryServerInfo{Server: nil, FullMethod: "/test"}
+	cases := map[error]codes.Code{
+		errors.Mark(errors.New("email is missing"), mediator.ErrInvalidRequest): codes.InvalidArgument,
+		errors.Wrap(es.ErrConcurrencyConflict, "retries exhausted"):             codes.Aborted,
+		server.ErrClaimsMismatch:                            codes.PermissionDenied,
+		status.Error(codes.Unavailable, "already a status"): codes.Unavailable,
+		errors.New("anything else"):                         codes.Internal,
+	}
+
+	for err, expected := range cases {
+		_, actual := server.ErrorInterceptor(context.Background(), nil, info, failingHandler(err))
+		if status.Code(actual) != expected {
+			t.Errorf("expected %v for %q but got %v", expected, err, status.Code(actual))
+		}
+	}
+}
+
+func TestErrorInterceptorDoesNotRevealRegisteredEmails(t *testing.T) {
+	t.Parallel()
+
+	info := &grpc.UnaryServerInfo{Server: nil, FullMethod: "/test"}
+
+	_, unknownEmail := server.ErrorInterceptor(context.Background(), nil, info, failingHandler(
+		errors.Wrap(es.ErrNoEvents, "unknown@example.com"),
+	))
+	_, incorrectPassword := server.ErrorInterceptor(context.Background(), nil, info, failingHandler(
+		errors.Wrap(authentication.ErrIncorrectPassword, "login failed"),
+	))
+
+	if status.Code(unknownEmail) != codes.Unauthenticated || status.Code(incorrectPassword) != codes.Unauthenticated {
+		t.Error("expected both to be unauthenticated but got", unknownEmail, incorrectPassword)
+	}
+
+	if status.Convert(unknownEmail).Message() != status.Convert(incorrectPassword).Message() {
+		t.Error("expected the same message but got", unknownEmail, incorrectPassword)
+	}
+}
+
+func TestErrorInterceptorHidesInternalErrors(t *testing.T) {
+	t.Parallel()
+
+	info := &grpc.UnaryServerInfo{Server: nil, FullMethod: "/test"}
+
+	_, err := server.ErrorInterceptor(context.Background(), nil, info, failingHandler(
+		errors.Wrap(errors.New("connection refused"), "mongo"),
+	))
+
+	if status.Code(err) != codes.Internal || status.Convert(err).Message() != server.ErrInternal.Error() {
+		t.Error("expected an internal error without its details but got", err)
+	}
+}
+
+func TestAuthInterceptorPassesClaimsOfValidToken(t *testing.T) {
+	t.Parallel()
+
+	jwtService := services.JWTServiceFactory()
+
+	tokens, err := jwtService.Sign("me@example.com", "session", "csrf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "Bearer "+tokens.AccessToken,
+		"csrf", "csrf",
+	))
+	info := &grpc.UnaryServerInfo{Server: nil, FullMethod: "/secured"}
+	interceptor := server.AuthInterceptor(jwtService, info.FullMethod)
+
+	_, err = interceptor(ctx, nil, info, func(ctx context.Context, request interface{}) (interface{}, error) {
+		claims, err := server.ClaimsFromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if claims.Subject != "me@example.com" || claims.SessionID != "session" {
+			t.Errorf("unexpected claims %v", claims)
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthInterceptorRejectsMissingToken(t *testing.T) {
+	t.Parallel()
+
+	info := &grpc.UnaryServerInfo{Server: nil, FullMethod: "/secured"}
+	interceptor := server.AuthInterceptor(services.JWTServiceFactory(), info.FullMethod)
+	handler := func(ctx context.Context, request interface{}) (interface{}, error) {
+		t.Error("handler must not be called without a token")
+
+		return nil, nil
+	}
+
+	_, err := interceptor(context.Background(), nil, info, handler)
+	if !errors.Is(err, server.ErrUnauthenticated) {
+		t.Fatalf("expected %v but got %v", server.ErrUnauthenticated, err)
+	}
+
+	// Calls to other methods are not authenticated
+	info.FullMethod = "/public"
+
+	if _, err := interceptor(context.Background(), nil, info, failingHandler(nil)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"context"
+	"net"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/internal/application"
+	"github.com/hywmongous/example-service/internal/infrastructure/jaeger"
+	"github.com/hywmongous/example-service/internal/infrastructure/services"
+	"go.uber.org/fx"
+	"google.golang.org/grpc"
+)
+
+const (
+	address = ":5001"
+
+	logoutIdentityMethod         = "/application.IdentityUseCases/LogoutIdentity"
+	changeIdentityPasswordMethod = "/application.IdentityUseCases/ChangeIdentityPassword"
+)
+
+var ErrCouldNotListen = errors.New("gRPC server could not listen on its address")
+
+// Module provides the gRPC server, which serves
+// the use cases next to the gin engine.
+func Module() fx.Option {
+	return fx.Options(
+		fx.Provide(IdentityServerFactory),
+		fx.Provide(ServerFactory),
+		fx.Invoke(bootstrap),
+	)
+}
+
+func ServerFactory(
+	lifecycle fx.Lifecycle,
+	jwtService services.JWTService,
+	identityServer application.IdentityUseCasesServer,
+) *grpc.Server {
+	tracer, closer := jaeger.Create()
+
+	lifecycle.Append(fx.Hook{
+		OnStart: nil,
+		OnStop: func(ctx context.Context) error {
+			return closer.Close()
+		},
+	})
+
+	// The error interceptor is inside the tracing interceptor,
+	// such that the spans record the status codes sent to the clients
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		TracingInterceptor(tracer),
+		ErrorInterceptor,
+		AuthInterceptor(jwtService, logoutIdentityMethod, changeIdentityPasswordMethod),
+	))
+
+	application.RegisterIdentityUseCasesServer(server, identityServer)
+
+	return server
+}
+
+func bootstrap(
+	lifecycle fx.Lifecycle,
+	server *grpc.Server,
+) {
+	lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			listener, err := net.Listen("tcp", address)
+			if err != nil {
+				return errors.Wrap(err, ErrCouldNotListen.Error())
+			}
+
+			go func() {
+				if err := server.Serve(listener); err != nil {
+					panic(err)
+				}
+			}()
+
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			server.GracefulStop()
+
+			return nil
+		},
+	})
+}
@@ -0,0 +1,127 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Filter is a bloom filter, which tells whether it might contain
+// some data or whether it definitely does not. It trades the chance
+// of false positives for being far smaller than the data itself.
+// Adding data is not safe for concurrent use, but checking it is.
+type Filter struct {
+	bits   []uint64
+	hashes uint32
+}
+
+const (
+	wordSize = 64
+	// The marshalled filter starts with the magic, the number of hashes and the number of words
+	magic      = "BLM1"
+	headerSize = len(magic) + 4 + 8
+)
+
+var (
+	ErrInvalidExpectedCount   = errors.New("bloom filter must expect at least one element")
+	ErrInvalidFalsePositives  = errors.New("bloom filter false positive rate must be between zero and one")
+	ErrInvalidMarshalledBloom = errors.New("bloom filter could not be loaded from invalid data")
+)
+
+// Create returns an empty filter which is sized such that it has the
+// false positive rate when the expected number of elements are added.
+func Create(expected int, falsePositiveRate float64) (*Filter, error) {
+	if expected < 1 {
+		return nil, ErrInvalidExpectedCount
+	}
+
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, ErrInvalidFalsePositives
+	}
+
+	// https://en.wikipedia.org/wiki/Bloom_filter#Optimal_number_of_hash_functions
+	bits := math.Ceil(-float64(expected) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	hashes := math.Max(1, math.Round(bits/float64(expected)*math.Ln2))
+
+	return &Filter{
+		bits:   make([]uint64, int(math.Ceil(bits/wordSize))),
+		hashes: uint32(hashes),
+	}, nil
+}
+
+// Load returns the filter which was marshalled into the data.
+func Load(data []byte) (*Filter, error) {
+	if len(data) < headerSize || string(data[:len(magic)]) != magic {
+		return nil, ErrInvalidMarshalledBloom
+	}
+
+	hashes := binary.LittleEndian.Uint32(data[len(magic):])
+	words := binary.LittleEndian.Uint64(data[len(magic)+4:])
+	body := data[headerSize:]
+
+	if hashes == 0 || words == 0 || uint64(len(body)) != words*8 {
+		return nil, ErrInvalidMarshalledBloom
+	}
+
+	bits := make([]uint64, words)
+	for i := range bits {
+		bits[i] = binary.LittleEndian.Uint64(body[i*8:])
+	}
+
+	return &Filter{
+		bits:   bits,
+		hashes: hashes,
+	}, nil
+}
+
+func (filter *Filter) Add(data []byte) {
+	filter.locate(data, func(word int, mask uint64) bool {
+		filter.bits[word] |= mask
+
+		return true
+	})
+}
+
+// Contains returns false if the data was definitely not added,
+// and true if it probably was.
+func (filter *Filter) Contains(data []byte) bool {
+	return filter.locate(data, func(word int, mask uint64) bool {
+		return filter.bits[word]&mask != 0
+	})
+}
+
+func (filter *Filter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, headerSize+len(filter.bits)*8)
+	copy(data, magic)
+	binary.LittleEndian.PutUint32(data[len(magic):], filter.hashes)
+	binary.LittleEndian.PutUint64(data[len(magic)+4:], uint64(len(filter.bits)))
+
+	for i, word := range filter.bits {
+		binary.LittleEndian.PutUint64(data[headerSize+i*8:], word)
+	}
+
+	return data, nil
+}
+
+// locate visits the bits of the data until the visitor returns false.
+// The bits are derived from two halves of a single hash, which is as
+// good as using independent hashes (Kirsch and Mitzenmacher, 2006).
+func (filter *Filter) locate(data []byte, visit func(word int, mask uint64) bool) bool {
+	hash := fnv.New64a()
+	_, _ = hash.Write(data)
+	sum := hash.Sum64()
+
+	lower, upper := sum&math.MaxUint32, sum>>32
+	size := uint64(len(filter.bits)) * wordSize
+
+	for i := uint64(0); i < uint64(filter.hashes); i++ {
+		bit := (lower + i*upper) % size
+		if !visit(int(bit/wordSize), 1<<(bit%wordSize)) {
+			return false
+		}
+	}
+
+	return true
+}
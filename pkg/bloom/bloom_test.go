@@ -0,0 +1,69 @@
+package bloom_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hywmongous/example-service/pkg/bloom"
+)
+
+func TestFilterContainsAddedData(t *testing.T) {
+	t.Parallel()
+
+	filter, err := bloom.Create(100, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		filter.Add([]byte(strconv.Itoa(i)))
+	}
+
+	for i := 0; i < 100; i++ {
+		if !filter.Contains([]byte(strconv.Itoa(i))) {
+			t.Errorf("expected the filter to contain %d", i)
+		}
+	}
+
+	falsePositives := 0
+
+	for i := 100; i < 10100; i++ {
+		if filter.Contains([]byte(strconv.Itoa(i))) {
+			falsePositives++
+		}
+	}
+
+	// The rate is 1% on average, so 3% is very unlikely
+	if falsePositives > 300 {
+		t.Errorf("expected around 100 false positives but got %d", falsePositives)
+	}
+}
+
+func TestFilterMarshalsAndLoads(t *testing.T) {
+	t.Parallel()
+
+	filter, err := bloom.Create(10, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter.Add([]byte("password"))
+
+	data, err := filter.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := bloom.Load(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !loaded.Contains([]byte("password")) {
+		t.Error("expected the loaded filter to contain the added data")
+	}
+
+	if _, err := bloom.Load(data[:len(data)-1]); err == nil {
+		t.Error("expected truncated data to be invalid")
+	}
+}
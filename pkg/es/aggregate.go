@@ -0,0 +1,110 @@
+package es
+
+import (
+	"github.com/cockroachdb/errors"
+)
+
+type (
+	// Aggregate is an aggregate whose state is derived from its events.
+	Aggregate interface {
+		// Apply changes the state by the event. Both the events which the aggregate
+		// records and the events which are replayed from the store are applied with
+		// it, so the data must be read with event.Unmarshal rather than a type switch.
+		Apply(event Event) error
+	}
+
+	// EventSourced is an aggregate which embeds an AggregateRoot.
+	// It is what units of work commit the recorded events of.
+	EventSourced interface {
+		Subject() SubjectID
+		Version() Version
+		Uncommitted() []Event
+		MarkCommitted()
+	}
+)
+
+// AggregateRoot tracks the version and the uncommitted events of an aggregate.
+// Aggregates embed it and record their events through it, such that the events
+// change the state in the same way whether they are new or replayed.
+type AggregateRoot struct {
+	subject SubjectID
+	// The version of the next event which is committed
+	version     Version
+	uncommitted []Event
+}
+
+var (
+	ErrCouldNotApplyEvent = errors.New("aggregate could not apply the event")
+	ErrSubjectMismatch    = errors.New("replayed event concerns another subject than the aggregate")
+)
+
+// CreateAggregateRoot creates the root of an aggregate without any events.
+func CreateAggregateRoot(subject SubjectID) AggregateRoot {
+	return AggregateRoot{
+		subject:     subject,
+		version:     InitialEventVersion,
+		uncommitted: make([]Event, 0),
+	}
+}
+
+func (root *AggregateRoot) Subject() SubjectID {
+	return root.subject
+}
+
+// Version is the version which the next committed event must have, which
+// is the number of committed events. Committing fails if the store has more.
+func (root *AggregateRoot) Version() Version {
+	return root.version
+}
+
+func (root *AggregateRoot) Uncommitted() []Event {
+	return root.uncommitted
+}
+
+// MarkCommitted is called by the unit of work once the uncommitted events are shipped.
+func (root *AggregateRoot) MarkCommitted() {
+	root.version += Version(len(root.uncommitted))
+	root.uncommitted = make([]Event, 0)
+}
+
+// Record applies the new event to the aggregate and tracks it as uncommitted.
+// The event is not recorded if the aggregate fails to apply it.
+func (root *AggregateRoot) Record(aggregate Aggregate, data Data) error {
+	if data == nil {
+		return ErrEventDataIsNil
+	}
+
+	event := createEvent(
+		"",
+		root.subject,
+		root.version+Version(len(root.uncommitted)),
+		InitialEventSchemaVersion,
+		InitialSnapshotVersion,
+		data,
+	)
+
+	if err := aggregate.Apply(event); err != nil {
+		return errors.Wrap(err, ErrCouldNotApplyEvent.Error())
+	}
+
+	root.uncommitted = append(root.uncommitted, event)
+
+	return nil
+}
+
+// Replay applies the committed events of the aggregate, in ascending versions.
+func (root *AggregateRoot) Replay(aggregate Aggregate, events []Event) error {
+	for _, event := range events {
+		if event.Subject != root.subject {
+			return errors.Wrap(ErrSubjectMismatch, string(event.Subject))
+		}
+
+		if err := aggregate.Apply(event); err != nil {
+			return errors.Wrap(err, ErrCouldNotApplyEvent.Error())
+		}
+
+		root.version = event.Version + 1
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package es
+
+import (
+	"sync"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Delivery is an event received through a subscription.
+// The event is only considered consumed once it is acknowledged,
+// and a negative acknowledgement makes the stream redeliver it.
+// Only the first call to either Ack or Nack has an effect.
+type Delivery struct {
+	Event Event
+
+	// The number of times the event has been delivered, starting at one
+	Attempt int
+
+	ack     func()
+	nack    func(err error)
+	settled *sync.Once
+}
+
+var ErrDeliveryNacked = errors.New("delivery was negatively acknowledged")
+
+func CreateDelivery(event Event, attempt int, ack func(), nack func(err error)) Delivery {
+	return Delivery{
+		Event:   event,
+		Attempt: attempt,
+		ack:     ack,
+		nack:    nack,
+		settled: &sync.Once{},
+	}
+}
+
+// Ack marks the event as processed.
+func (delivery Delivery) Ack() {
+	delivery.settled.Do(delivery.ack)
+}
+
+// Nack marks the event as failed, the error is the reason.
+func (delivery Delivery) Nack(err error) {
+	if err == nil {
+		err = ErrDeliveryNacked
+	}
+
+	delivery.settled.Do(func() {
+		delivery.nack(err)
+	})
+}
@@ -0,0 +1,296 @@
+package estest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+)
+
+type (
+	// Recreate recreates the aggregate by replaying its history.
+	Recreate func(subject es.SubjectID, history []es.Event) (es.EventSourced, error)
+
+	// Command acts on the aggregate and returns the aggregate which recorded
+	// the events. The aggregate is nil if the scenario has no history, in
+	// which case the command is expected to create the aggregate.
+	Command func(aggregate es.EventSourced) (es.EventSourced, error)
+)
+
+// Kit describes the aggregate which the scenarios test. In a scenario, given
+// the history of the aggregate, when a command is run, then the aggregate
+// records the expected events or fails with the expected error:
+//
+//	kit.Given(t, &IdentityRegistered{...}).
+//		When(func(aggregate es.EventSourced) (es.EventSourced, error) {
+//			return aggregate, aggregate.(*Identity).Logout("session")
+//		}).
+//		Then(&IdentityLoggedOut{SessionID: "session"})
+type Kit struct {
+	Subject  es.SubjectID
+	Recreate Recreate
+	// The events of the history and the recorded events must be registered,
+	// and the recorded events are compared as they are decoded from a store.
+	Registry *es.Registry
+}
+
+// Scenario is a single test of an aggregate.
+type Scenario struct {
+	t       testing.TB
+	kit     Kit
+	history []es.Event
+	ignored map[string]bool
+
+	ran       bool
+	aggregate es.EventSourced
+	err       error
+}
+
+const producer = es.ProducerID("estest")
+
+// Given starts a scenario where the aggregate has the history. The events are
+// encoded as a store would encode them, such that the aggregate must decode
+// their data with event.Unmarshal, exactly as when they are loaded from a store.
+func (kit Kit) Given(t testing.TB, history ...es.Data) *Scenario {
+	t.Helper()
+
+	events := make([]es.Event, len(history))
+
+	for idx, data := range history {
+		event, err := kit.encode(data, es.Version(idx))
+		if err != nil {
+			t.Fatalf("history event %d: %v", idx, err)
+		}
+
+		events[idx] = event
+	}
+
+	return &Scenario{
+		t:         t,
+		kit:       kit,
+		history:   events,
+		ignored:   make(map[string]bool),
+		ran:       false,
+		aggregate: nil,
+		err:       nil,
+	}
+}
+
+// Ignoring leaves the fields with the JSON names out of the comparison of the
+// events. It is meant for the fields which differ on every run, such as ids.
+func (scenario *Scenario) Ignoring(fields ...string) *Scenario {
+	for _, field := range fields {
+		scenario.ignored[field] = true
+	}
+
+	return scenario
+}
+
+// When recreates the aggregate from the history and runs the command on it.
+func (scenario *Scenario) When(command Command) *Scenario {
+	scenario.t.Helper()
+
+	var aggregate es.EventSourced
+
+	if len(scenario.history) > 0 {
+		recreated, err := scenario.kit.Recreate(scenario.kit.Subject, scenario.history)
+		if err != nil {
+			scenario.t.Fatalf("recreating the aggregate from the history failed with err: %v", err)
+		}
+
+		if recreated.Version() != es.Version(len(scenario.history)) || len(recreated.Uncommitted()) != 0 {
+			scenario.t.Fatalf("expected the recreated aggregate to be at version %d without uncommitted events", len(scenario.history))
+		}
+
+		aggregate = recreated
+	}
+
+	scenario.aggregate, scenario.err = command(aggregate)
+	scenario.ran = true
+
+	return scenario
+}
+
+// Then expects the command to succeed and the aggregate to record the events.
+func (scenario *Scenario) Then(expected ...es.Data) {
+	scenario.t.Helper()
+
+	if !scenario.ran {
+		scenario.t.Fatalf("Then must be called after When")
+	}
+
+	if scenario.err != nil {
+		scenario.t.Errorf("expected the command to succeed but it failed with err: %v", scenario.err)
+
+		return
+	}
+
+	actualLines := scenario.renderRecorded()
+	expectedLines := make([]string, len(expected))
+
+	for idx, data := range expected {
+		event, err := scenario.kit.encode(data, es.Version(idx))
+		if err != nil {
+			scenario.t.Fatalf("expected event %d: %v", idx, err)
+		}
+
+		expectedLines[idx] = scenario.render(event.Name, data)
+	}
+
+	if report, differ := diff(expectedLines, actualLines); differ {
+		scenario.t.Errorf("recorded events differ (- expected, + actual):\n%s", report)
+	}
+}
+
+// ThenError expects the command to fail with the error, without recording events.
+func (scenario *Scenario) ThenError(target error) {
+	scenario.t.Helper()
+
+	if !scenario.ran {
+		scenario.t.Fatalf("ThenError must be called after When")
+	}
+
+	recorded := scenario.renderRecorded()
+
+	if scenario.err == nil {
+		scenario.t.Errorf(
+			"expected the command to fail with %v but it succeeded and recorded:\n%s",
+			target,
+			strings.Join(recorded, "\n"),
+		)
+
+		return
+	}
+
+	if !errors.Is(scenario.err, target) {
+		scenario.t.Errorf("expected the command to fail with %v but it failed with %v", target, scenario.err)
+	}
+
+	if len(recorded) > 0 {
+		scenario.t.Errorf("expected the failed command not to record events but it recorded:\n%s", strings.Join(recorded, "\n"))
+	}
+}
+
+func (scenario *Scenario) renderRecorded() []string {
+	scenario.t.Helper()
+
+	// Constructors return a nil aggregate along with their error
+	if scenario.aggregate == nil || reflect.ValueOf(scenario.aggregate).IsNil() {
+		return []string{}
+	}
+
+	recorded := scenario.aggregate.Uncommitted()
+	lines := make([]string, len(recorded))
+
+	for idx, event := range recorded {
+		if scenario.kit.Subject != "" && event.Subject != scenario.kit.Subject {
+			scenario.t.Errorf("recorded event %d concerns %q rather than %q", idx, event.Subject, scenario.kit.Subject)
+		}
+
+		data := event.Data
+
+		if scenario.kit.Registry != nil {
+			decoded, err := scenario.kit.Registry.Decode(event)
+			if err != nil {
+				scenario.t.Errorf("recorded event %d: %v", idx, err)
+			} else {
+				data = decoded
+			}
+		}
+
+		lines[idx] = scenario.render(event.Name, data)
+	}
+
+	return lines
+}
+
+// render returns the title and the JSON encoded data without the ignored fields.
+// The fields of the JSON objects are sorted, so equal data renders equally.
+func (scenario *Scenario) render(title es.Title, data es.Data) string {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Sprintf("%s <%v>", title, err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return fmt.Sprintf("%s %s", title, encoded)
+	}
+
+	for field := range scenario.ignored {
+		delete(fields, field)
+	}
+
+	encoded, _ = json.Marshal(fields)
+
+	return fmt.Sprintf("%s %s", title, encoded)
+}
+
+// encode returns the event of the data as it would be loaded from a store.
+func (kit Kit) encode(data es.Data, version es.Version) (es.Event, error) {
+	title := es.CreateTitleForData(data)
+
+	if kit.Registry != nil && !kit.Registry.Registered(title) {
+		return es.Event{}, errors.Wrap(es.ErrUnregisteredData, string(title))
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return es.Event{}, errors.Wrap(err, es.ErrCouldNotEncodeData.Error())
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return es.Event{}, errors.Wrap(err, es.ErrCouldNotEncodeData.Error())
+	}
+
+	return es.RecreateEvent(
+		es.Ident(fmt.Sprintf("%s/%d", kit.Subject, version)),
+		producer,
+		kit.Subject,
+		version,
+		es.InitialEventSchemaVersion,
+		es.InitialSnapshotVersion,
+		title,
+		es.Timestamp(time.Now().Unix()),
+		decoded,
+	), nil
+}
+
+// diff aligns the lines by their positions and marks the lines which differ.
+func diff(expected []string, actual []string) (string, bool) {
+	lines := len(expected)
+	if len(actual) > lines {
+		lines = len(actual)
+	}
+
+	var (
+		report strings.Builder
+		differ bool
+	)
+
+	for idx := 0; idx < lines; idx++ {
+		if idx < len(expected) && idx < len(actual) && expected[idx] == actual[idx] {
+			report.WriteString("  " + expected[idx] + "\n")
+
+			continue
+		}
+
+		differ = true
+
+		if idx < len(expected) {
+			report.WriteString("- " + expected[idx] + "\n")
+		}
+
+		if idx < len(actual) {
+			report.WriteString("+ " + actual[idx] + "\n")
+		}
+	}
+
+	return report.String(), differ
+}
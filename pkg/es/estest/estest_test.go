@@ -0,0 +1,155 @@
+package estest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/estest"
+)
+
+type (
+	Opened struct {
+		Owner string
+	}
+	Deposited struct {
+		Amount int
+	}
+)
+
+var ErrInsufficientAmount = errors.New("amount must be positive")
+
+// account is an aggregate which applies its events with event.Unmarshal.
+type account struct {
+	es.AggregateRoot
+
+	owner   string
+	balance int
+}
+
+func (account *account) Apply(event es.Event) error {
+	switch event.Name {
+	case es.CreateTitleForData(Opened{}):
+		var opened Opened
+		if err := event.Unmarshal(&opened); err != nil {
+			return err
+		}
+
+		account.owner = opened.Owner
+	case es.CreateTitleForData(Deposited{}):
+		var deposited Deposited
+		if err := event.Unmarshal(&deposited); err != nil {
+			return err
+		}
+
+		account.balance += deposited.Amount
+	}
+
+	return nil
+}
+
+func (account *account) deposit(amount int) error {
+	if amount < 1 {
+		return ErrInsufficientAmount
+	}
+
+	return account.Record(account, Deposited{Amount: amount})
+}
+
+// failures records the failures of a scenario rather than failing the test.
+type failures struct {
+	testing.TB
+	messages []string
+}
+
+func (recorder *failures) Helper() {}
+
+func (recorder *failures) Errorf(format string, args ...interface{}) {
+	recorder.messages = append(recorder.messages, fmt.Sprintf(format, args...))
+}
+
+func createKit(t *testing.T) estest.Kit {
+	t.Helper()
+
+	registry := es.CreateRegistry()
+	if err := registry.Register(Opened{}, Deposited{}); err != nil {
+		t.Fatal("Register failed with err:", err)
+	}
+
+	return estest.Kit{
+		Subject: "alice",
+		Recreate: func(subject es.SubjectID, history []es.Event) (es.EventSourced, error) {
+			account := &account{AggregateRoot: es.CreateAggregateRoot(subject), owner: "", balance: 0}
+
+			return account, account.Replay(account, history)
+		},
+		Registry: registry,
+	}
+}
+
+func deposit(amount int) estest.Command {
+	return func(aggregate es.EventSourced) (es.EventSourced, error) {
+		return aggregate, aggregate.(*account).deposit(amount)
+	}
+}
+
+func TestScenarios(t *testing.T) {
+	t.Parallel()
+
+	kit := createKit(t)
+
+	kit.Given(t).
+		When(func(es.EventSourced) (es.EventSourced, error) {
+			account := &account{AggregateRoot: es.CreateAggregateRoot("alice"), owner: "", balance: 0}
+
+			return account, account.Record(account, Opened{Owner: "alice"})
+		}).
+		Then(Opened{Owner: "alice"})
+
+	kit.Given(t, Opened{Owner: "alice"}, Deposited{Amount: 5}).
+		When(deposit(10)).
+		Then(Deposited{Amount: 10})
+
+	kit.Given(t, Opened{Owner: "alice"}).
+		When(deposit(0)).
+		ThenError(ErrInsufficientAmount)
+
+	kit.Given(t, Opened{Owner: "alice"}).
+		When(deposit(10)).
+		Ignoring("Amount").
+		Then(Deposited{Amount: 20})
+}
+
+func TestScenarioReportsDifferences(t *testing.T) {
+	t.Parallel()
+
+	recorder := &failures{TB: t, messages: make([]string, 0)}
+	kit := createKit(t)
+
+	kit.Given(recorder, Opened{Owner: "alice"}).
+		When(deposit(10)).
+		Then(Deposited{Amount: 20}, Deposited{Amount: 5})
+
+	kit.Given(recorder, Opened{Owner: "alice"}).
+		When(deposit(10)).
+		ThenError(ErrInsufficientAmount)
+
+	if len(recorder.messages) != 2 {
+		t.Fatalf("expected 2 failures but got %d: %v", len(recorder.messages), recorder.messages)
+	}
+
+	expected := strings.Join([]string{
+		`- Deposited {"Amount":20}`,
+		`+ Deposited {"Amount":10}`,
+		`- Deposited {"Amount":5}`,
+	}, "\n")
+	if !strings.Contains(recorder.messages[0], expected) {
+		t.Errorf("expected the difference to be reported but got:\n%s", recorder.messages[0])
+	}
+
+	if !strings.Contains(recorder.messages[1], `Deposited {"Amount":10}`) {
+		t.Errorf("expected the recorded event to be reported but got:\n%s", recorder.messages[1])
+	}
+}
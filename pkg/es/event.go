@@ -44,6 +44,13 @@ type Event struct {
 	Data Data
 }
 
+// SequencedEvent is an event along with its sequence, which numbers the
+// events of its producer in the order they are shipped, starting from one.
+type SequencedEvent struct {
+	Sequence Sequence
+	Event    Event
+}
+
 var (
 	ErrEventDataIsNil       = errors.New("data cannot be nil")
 	ErrNoEventData          = errors.New("event data array is length 0")
@@ -107,7 +114,7 @@ func CreateEventBatch(
 		events[idx] = createEvent(
 			producer,
 			subject,
-			nextEventVersion,
+			nextEventVersion+Version(idx),
 			schemaVersion,
 			snapshotVersion,
 			elem,
@@ -0,0 +1,918 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+)
+
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs the segment and the index every time events are written.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs the segment and the index in the background
+	// with a fixed interval. A crash can lose the latest interval of events.
+	SyncInterval
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+type Options struct {
+	// The directory holding the segments and the index
+	Directory string
+	// A segment is rolled when appending would make it exceed this size
+	SegmentSize int64
+	Sync        SyncPolicy
+	// Only used with the SyncInterval policy
+	SyncInterval time.Duration
+}
+
+// EventStore is a dependency-free es.EventStore which appends events
+// to segment files and keeps an on-disk index of their subjects,
+// producers and versions. All queries are answered from the index.
+type EventStore struct {
+	mutex   sync.Mutex
+	options Options
+	stage   es.Stage
+
+	index    *eventIndex
+	indexLog *logFile
+	segments map[uint64]*logFile
+	active   *logFile
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// checkpoint is the state of the files before an append,
+// which is used to undo the append if it fails half way.
+type checkpoint struct {
+	segment     uint64
+	segmentSize int64
+	indexSize   int64
+}
+
+type pendingRecord struct {
+	record []byte
+	entry  indexEntry
+}
+
+const (
+	defaultSegmentSize  = 64 << 20 // 64MB
+	defaultSyncInterval = 1 * time.Second
+
+	directoryPermissions = 0o755
+	indexFileName        = "index.log"
+	segmentExtension     = ".seg"
+	segmentNameFormat    = "%020d" + segmentExtension
+	initialSegmentID     = 1
+)
+
+var (
+	ErrMissingDirectory          = errors.New("file event store requires a directory")
+	ErrFailedCreatingDirectory   = errors.New("file event store directory could not be created")
+	ErrFailedListingSegments     = errors.New("segments could not be listed")
+	ErrFailedRecovery            = errors.New("file event store could not recover")
+	ErrStageOutOfSync            = errors.New("stage is out of sync with the log")
+	ErrEventCreationFailedOnLoad = errors.New("event could not be created and loaded")
+	ErrEventBatchCreationFailed  = errors.New("event batch could not be created and sent")
+	ErrSnapshotCreationFailed    = errors.New("snapshot could not be created")
+	ErrRecordEncodingFailed      = errors.New("record could not be encoded")
+	ErrRecordDecodingFailed      = errors.New("record could not be decoded")
+	ErrIndexReferencesNoRecord   = errors.New("index entry references a missing segment")
+	ErrAppendFailed              = errors.New("appending the records failed")
+	ErrRollbackFailed            = errors.New("rollback of the append failed")
+	ErrStoreClosed               = errors.New("file event store is closed")
+)
+
+func DefaultOptions(directory string) Options {
+	return Options{
+		Directory:    directory,
+		SegmentSize:  defaultSegmentSize,
+		Sync:         SyncAlways,
+		SyncInterval: defaultSyncInterval,
+	}
+}
+
+// CreateFileEventStore opens the store in the directory of the options.
+// Torn writes at the end of the log, from a crash in the middle of
+// an append, are truncated before the store is returned.
+func CreateFileEventStore(options Options) (*EventStore, error) {
+	if options.Directory == "" {
+		return nil, ErrMissingDirectory
+	}
+
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = defaultSegmentSize
+	}
+
+	if options.SyncInterval <= 0 {
+		options.SyncInterval = defaultSyncInterval
+	}
+
+	if err := os.MkdirAll(options.Directory, directoryPermissions); err != nil {
+		return nil, errors.Wrap(err, ErrFailedCreatingDirectory.Error())
+	}
+
+	store := &EventStore{
+		options:  options,
+		stage:    es.CreateStage(),
+		index:    createEventIndex(),
+		segments: make(map[uint64]*logFile),
+	}
+
+	if err := store.recover(); err != nil {
+		store.closeFiles()
+
+		return nil, errors.Wrap(err, ErrFailedRecovery.Error())
+	}
+
+	if options.Sync == SyncInterval {
+		store.stop = make(chan struct{})
+		store.done = make(chan struct{})
+
+		go store.syncPeriodically()
+	}
+
+	return store, nil
+}
+
+func (store *EventStore) Stage() es.Stage {
+	return store.stage
+}
+
+// Close flushes and closes all files of the store. Closing it again
+// returns ErrStoreClosed, as both fx and deferred cleanups may close it.
+func (store *EventStore) Close() error {
+	if store.stop != nil {
+		store.stopOnce.Do(func() {
+			close(store.stop)
+		})
+		<-store.done
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.active == nil {
+		return ErrStoreClosed
+	}
+
+	err := store.syncFiles()
+	store.closeFiles()
+
+	return err
+}
+
+func (store *EventStore) segmentPath(id uint64) string {
+	return filepath.Join(store.options.Directory, fmt.Sprintf(segmentNameFormat, id))
+}
+
+func (store *EventStore) listSegments() ([]uint64, error) {
+	paths, err := filepath.Glob(filepath.Join(store.options.Directory, "*"+segmentExtension))
+	if err != nil {
+		return nil, errors.Wrap(err, ErrFailedListingSegments.Error())
+	}
+
+	ids := make([]uint64, 0, len(paths))
+
+	for _, path := range paths {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), segmentExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+func (store *EventStore) recover() error {
+	ids, err := store.listSegments()
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		ids = append(ids, initialSegmentID)
+	}
+
+	for _, id := range ids {
+		segment, err := openLogFile(id, store.segmentPath(id))
+		if err != nil {
+			return err
+		}
+
+		store.segments[id] = segment
+		store.active = segment
+	}
+
+	store.indexLog, err = openLogFile(0, filepath.Join(store.options.Directory, indexFileName))
+	if err != nil {
+		return err
+	}
+
+	if err := store.loadIndex(); err != nil {
+		return err
+	}
+
+	if err := store.reindexSegments(ids); err != nil {
+		return err
+	}
+
+	return store.syncFiles()
+}
+
+// loadIndex reads the on-disk index into memory. The index is cut
+// at the first torn entry or the first entry referencing a record
+// which did not make it into the segments, since every entry after
+// it was appended by the same or a later write.
+func (store *EventStore) loadIndex() error {
+	offset := int64(0)
+
+	for {
+		_, payload, size, err := store.indexLog.read(offset)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if isTorn(err) {
+			return store.indexLog.truncate(offset)
+		} else if err != nil {
+			return err
+		}
+
+		var entry indexEntry
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			return store.indexLog.truncate(offset)
+		}
+
+		segment, found := store.segments[entry.Segment]
+		if !found || entry.Offset+entry.Size > segment.size {
+			return store.indexLog.truncate(offset)
+		}
+
+		store.index.add(entry)
+		offset += size
+	}
+}
+
+// reindexSegments indexes the records written to the segments after the
+// last indexed record and truncates the segments at the first torn record.
+func (store *EventStore) reindexSegments(ids []uint64) error {
+	lastIndexed := ids[0]
+
+	for segment := range store.index.ends {
+		if segment > lastIndexed {
+			lastIndexed = segment
+		}
+	}
+
+	for position, id := range ids {
+		if id < lastIndexed {
+			continue
+		}
+
+		torn, err := store.reindexSegment(store.segments[id])
+		if err != nil {
+			return err
+		}
+
+		if torn {
+			return store.removeSegments(ids[position+1:])
+		}
+	}
+
+	return nil
+}
+
+func (store *EventStore) reindexSegment(segment *logFile) (bool, error) {
+	offset := store.index.ends[segment.id]
+
+	for {
+		kind, payload, size, err := segment.read(offset)
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+
+		if isTorn(err) {
+			return true, segment.truncate(offset)
+		} else if err != nil {
+			return false, err
+		}
+
+		entry, err := decodeIndexEntry(kind, payload)
+		if err != nil {
+			return true, segment.truncate(offset)
+		}
+
+		entry.Segment = segment.id
+		entry.Offset = offset
+		entry.Size = size
+
+		if err := store.appendIndexEntries([]indexEntry{entry}); err != nil {
+			return false, err
+		}
+
+		offset += size
+	}
+}
+
+func (store *EventStore) removeSegments(ids []uint64) error {
+	for _, id := range ids {
+		if err := store.segments[id].remove(); err != nil {
+			return err
+		}
+
+		delete(store.segments, id)
+	}
+
+	store.active = nil
+
+	for _, segment := range store.segments {
+		if store.active == nil || store.active.id < segment.id {
+			store.active = segment
+		}
+	}
+
+	return nil
+}
+
+func decodeIndexEntry(kind recordKind, payload []byte) (indexEntry, error) {
+	switch kind {
+	case eventRecord:
+		event, err := es.UnmarshalEvent(payload)
+		if err != nil {
+			return indexEntry{}, errors.Wrap(err, ErrRecordDecodingFailed.Error())
+		}
+
+		return eventIndexEntry(event), nil
+	case snapshotRecord:
+		var snapshot es.Snapshot
+		if err := json.Unmarshal(payload, &snapshot); err != nil {
+			return indexEntry{}, errors.Wrap(err, ErrRecordDecodingFailed.Error())
+		}
+
+		return snapshotIndexEntry(snapshot), nil
+	case indexRecord:
+	}
+
+	return indexEntry{}, ErrRecordDecodingFailed
+}
+
+func eventIndexEntry(event es.Event) indexEntry {
+	return indexEntry{
+		Kind:            eventRecord,
+		Subject:         event.Subject,
+		Producer:        event.Producer,
+		Version:         event.Version,
+		SnapshotVersion: event.SnapshotVersion,
+		Timestamp:       event.Timestamp,
+	}
+}
+
+func snapshotIndexEntry(snapshot es.Snapshot) indexEntry {
+	return indexEntry{
+		Kind:      snapshotRecord,
+		Subject:   snapshot.Subject,
+		Producer:  snapshot.Producer,
+		Version:   snapshot.Version,
+		Timestamp: snapshot.Timestamp,
+	}
+}
+
+func encodeEvent(event es.Event) (pendingRecord, error) {
+	payload, err := event.Marshall()
+	if err != nil {
+		return pendingRecord{}, errors.Wrap(err, ErrRecordEncodingFailed.Error())
+	}
+
+	return createPendingRecord(eventRecord, payload, eventIndexEntry(event))
+}
+
+func encodeSnapshot(snapshot es.Snapshot) (pendingRecord, error) {
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return pendingRecord{}, errors.Wrap(err, ErrRecordEncodingFailed.Error())
+	}
+
+	return createPendingRecord(snapshotRecord, payload, snapshotIndexEntry(snapshot))
+}
+
+func createPendingRecord(kind recordKind, payload []byte, entry indexEntry) (pendingRecord, error) {
+	if len(payload) > maxPayloadSize {
+		return pendingRecord{}, ErrRecordTooLarge
+	}
+
+	return pendingRecord{
+		record: encodeRecord(kind, payload),
+		entry:  entry,
+	}, nil
+}
+
+func (store *EventStore) checkpoint() checkpoint {
+	return checkpoint{
+		segment:     store.active.id,
+		segmentSize: store.active.size,
+		indexSize:   store.indexLog.size,
+	}
+}
+
+// segmentFor returns the segment the record should be appended to,
+// rolling to a new segment when the active one would grow too large.
+// The active segment is always synced before rolling such that only
+// the last segment can ever contain torn writes.
+func (store *EventStore) segmentFor(record []byte) (*logFile, error) {
+	if store.active.size == 0 || store.active.size+int64(len(record)) <= store.options.SegmentSize {
+		return store.active, nil
+	}
+
+	if err := store.active.sync(); err != nil {
+		return nil, err
+	}
+
+	id := store.active.id + 1
+
+	segment, err := openLogFile(id, store.segmentPath(id))
+	if err != nil {
+		return nil, err
+	}
+
+	store.segments[id] = segment
+	store.active = segment
+
+	return segment, nil
+}
+
+func (store *EventStore) append(records []pendingRecord) error {
+	before := store.checkpoint()
+
+	if err := store.appendRecords(records); err != nil {
+		if rollbackErr := store.rollback(before); rollbackErr != nil {
+			return errors.Wrap(err, errors.Wrap(rollbackErr, ErrRollbackFailed.Error()).Error())
+		}
+
+		return errors.Wrap(err, ErrAppendFailed.Error())
+	}
+
+	return nil
+}
+
+func (store *EventStore) appendRecords(records []pendingRecord) error {
+	entries := make([]indexEntry, len(records))
+
+	for idx, pending := range records {
+		segment, err := store.segmentFor(pending.record)
+		if err != nil {
+			return err
+		}
+
+		offset, err := segment.append(pending.record)
+		if err != nil {
+			return err
+		}
+
+		entries[idx] = pending.entry
+		entries[idx].Segment = segment.id
+		entries[idx].Offset = offset
+		entries[idx].Size = int64(len(pending.record))
+	}
+
+	// The segment is synced before the index such that the
+	// index never references records which are not durable
+	if store.options.Sync == SyncAlways {
+		if err := store.active.sync(); err != nil {
+			return err
+		}
+	}
+
+	return store.appendIndexEntries(entries)
+}
+
+func (store *EventStore) appendIndexEntries(entries []indexEntry) error {
+	for _, entry := range entries {
+		payload, err := json.Marshal(entry)
+		if err != nil {
+			return errors.Wrap(err, ErrRecordEncodingFailed.Error())
+		}
+
+		if _, err := store.indexLog.append(encodeRecord(indexRecord, payload)); err != nil {
+			return err
+		}
+	}
+
+	if store.options.Sync == SyncAlways {
+		if err := store.indexLog.sync(); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		store.index.add(entry)
+	}
+
+	return nil
+}
+
+func (store *EventStore) rollback(before checkpoint) error {
+	for id, segment := range store.segments {
+		if id <= before.segment {
+			continue
+		}
+
+		if err := segment.remove(); err != nil {
+			return err
+		}
+
+		delete(store.segments, id)
+	}
+
+	store.active = store.segments[before.segment]
+
+	if err := store.active.truncate(before.segmentSize); err != nil {
+		return err
+	}
+
+	return store.indexLog.truncate(before.indexSize)
+}
+
+func (store *EventStore) syncFiles() error {
+	if err := store.active.sync(); err != nil {
+		return err
+	}
+
+	return store.indexLog.sync()
+}
+
+func (store *EventStore) closeFiles() {
+	for _, segment := range store.segments {
+		segment.close()
+	}
+
+	if store.indexLog != nil {
+		store.indexLog.close()
+	}
+
+	store.active = nil
+}
+
+func (store *EventStore) syncPeriodically() {
+	defer close(store.done)
+
+	ticker := time.NewTicker(store.options.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-store.stop:
+			return
+		case <-ticker.C:
+			store.mutex.Lock()
+			if store.active != nil {
+				if err := store.syncFiles(); err != nil {
+					log.Println("File store failed syncing", err)
+				}
+			}
+			store.mutex.Unlock()
+		}
+	}
+}
+
+func (store *EventStore) read(entry indexEntry) ([]byte, error) {
+	segment, found := store.segments[entry.Segment]
+	if !found {
+		return nil, ErrIndexReferencesNoRecord
+	}
+
+	_, payload, _, err := segment.read(entry.Offset)
+
+	return payload, errors.Wrap(err, ErrRecordDecodingFailed.Error())
+}
+
+func (store *EventStore) readEvents(entries []indexEntry) ([]es.Event, error) {
+	events := make([]es.Event, len(entries))
+
+	for idx, entry := range entries {
+		payload, err := store.read(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		if events[idx], err = es.UnmarshalEvent(payload); err != nil {
+			return nil, errors.Wrap(err, ErrRecordDecodingFailed.Error())
+		}
+	}
+
+	return events, nil
+}
+
+func (store *EventStore) readSnapshot(entry indexEntry) (es.Snapshot, error) {
+	payload, err := store.read(entry)
+	if err != nil {
+		return es.Snapshot{}, err
+	}
+
+	var snapshot es.Snapshot
+	if err := json.Unmarshal(payload, &snapshot); err != nil {
+		return es.Snapshot{}, errors.Wrap(err, ErrRecordDecodingFailed.Error())
+	}
+
+	return snapshot, nil
+}
+
+func (store *EventStore) Send(producer es.ProducerID, subject es.SubjectID, data []es.Data) ([]es.Event, error) {
+	events, err := es.CreateEventBatch(producer, subject, es.Version(1), data, store)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrEventBatchCreationFailed.Error())
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.active == nil {
+		return nil, ErrStoreClosed
+	}
+
+	// Sent events bypass the stage, so their versions continue
+	// the log rather than the staged events of the subject
+	records := make([]pendingRecord, len(events))
+	nextVersion, snapshotVersion := store.nextVersions(subject)
+
+	for idx := range events {
+		events[idx].Version = nextVersion + es.Version(idx)
+		events[idx].SnapshotVersion = snapshotVersion
+
+		if records[idx], err = encodeEvent(events[idx]); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, store.append(records)
+}
+
+func (store *EventStore) Load(producer es.ProducerID, subject es.SubjectID, data es.Data) error {
+	event, err := es.CreateEvent(producer, subject, es.Version(1), data, store)
+	if err != nil {
+		return errors.Wrap(err, ErrEventCreationFailedOnLoad.Error())
+	}
+
+	store.stage.AddEvent(event)
+
+	return nil
+}
+
+func (store *EventStore) Clear() {
+	for _, subject := range store.stage.Subjects() {
+		store.stage.Clear(subject)
+	}
+}
+
+func (store *EventStore) nextVersions(subject es.SubjectID) (es.Version, es.Version) {
+	nextVersion := es.InitialEventVersion
+	if latest, found := store.index.latestEvent(subject); found {
+		nextVersion = latest.Version + 1
+	}
+
+	snapshotVersion := es.InitialSnapshotVersion
+	if latest, found := store.index.latestSnapshot(subject); found {
+		snapshotVersion = latest.Version
+	}
+
+	return nextVersion, snapshotVersion
+}
+
+func (store *EventStore) isStageInSync(subject es.SubjectID) bool {
+	if store.stage.IsEmpty(subject) {
+		return true
+	}
+
+	firstStagedEvent, _ := store.stage.FirstEvent(subject)
+	nextVersion, _ := store.nextVersions(subject)
+
+	return firstStagedEvent.Version == nextVersion
+}
+
+func (store *EventStore) stagedRecords(subject es.SubjectID) ([]pendingRecord, error) {
+	records := make([]pendingRecord, 0)
+
+	for _, stage := range store.stage.EventStages(subject) {
+		for _, event := range stage.Events() {
+			record, err := encodeEvent(event)
+			if err != nil {
+				return nil, err
+			}
+
+			records = append(records, record)
+		}
+
+		if stage.Snapshot() != nil {
+			record, err := encodeSnapshot(*stage.Snapshot())
+			if err != nil {
+				return nil, err
+			}
+
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+// Ship appends every staged subject in a single append, so
+// either all of the staged events become durable or none of them.
+func (store *EventStore) Ship(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, ErrAppendFailed.Error())
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.active == nil {
+		return ErrStoreClosed
+	}
+
+	subjects := store.stage.Subjects()
+	records := make([]pendingRecord, 0)
+
+	for _, subject := range subjects {
+		if !store.isStageInSync(subject) {
+			return errors.Mark(ErrStageOutOfSync, es.ErrConcurrencyConflict)
+		}
+
+		subjectRecords, err := store.stagedRecords(subject)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, subjectRecords...)
+	}
+
+	if len(records) > 0 {
+		if err := store.append(records); err != nil {
+			return err
+		}
+	}
+
+	for _, subject := range subjects {
+		store.stage.Clear(subject)
+	}
+
+	return nil
+}
+
+func (store *EventStore) Snapshot(producer es.ProducerID, subject es.SubjectID, data es.Data) error {
+	snapshot, err := es.CreateSnapshot(producer, subject, es.Version(1), data, store)
+	if err != nil {
+		return errors.Wrap(err, ErrSnapshotCreationFailed.Error())
+	}
+
+	store.stage.AddSnapshot(snapshot)
+
+	return nil
+}
+
+func (store *EventStore) query(entries func(index *eventIndex) []indexEntry) ([]es.Event, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.active == nil {
+		return nil, ErrStoreClosed
+	}
+
+	return store.readEvents(entries(store.index))
+}
+
+func (store *EventStore) Concerning(subject es.SubjectID) ([]es.Event, error) {
+	return store.query(func(index *eventIndex) []indexEntry {
+		return index.events(subject)
+	})
+}
+
+func (store *EventStore) By(producer es.ProducerID) ([]es.Event, error) {
+	return store.query(func(index *eventIndex) []indexEntry {
+		return index.by(producer)
+	})
+}
+
+// Log returns at most limit events of the producer after the sequence,
+// in the order they were shipped. The sequence of an event is its place
+// in the log, since the events are appended one shipment at a time.
+func (store *EventStore) Log(producer es.ProducerID, after es.Sequence, limit int) ([]es.SequencedEvent, error) {
+	events, err := store.query(func(index *eventIndex) []indexEntry {
+		return index.log(producer, uint64(after), limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sequenced := make([]es.SequencedEvent, len(events))
+	for idx, event := range events {
+		sequenced[idx] = es.SequencedEvent{
+			Sequence: after + es.Sequence(idx) + 1,
+			Event:    event,
+		}
+	}
+
+	return sequenced, nil
+}
+
+// LogHead returns the sequence of the latest event of the producer, or zero.
+func (store *EventStore) LogHead(producer es.ProducerID) (es.Sequence, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.active == nil {
+		return 0, ErrStoreClosed
+	}
+
+	return es.Sequence(len(store.index.producers[producer])), nil
+}
+
+func (store *EventStore) Between(subject es.SubjectID, from es.Version, to es.Version) ([]es.Event, error) {
+	return store.query(func(index *eventIndex) []indexEntry {
+		return index.between(subject, from, to)
+	})
+}
+
+func (store *EventStore) With(subject es.SubjectID, snapshot es.Version) ([]es.Event, error) {
+	return store.query(func(index *eventIndex) []indexEntry {
+		return index.with(subject, snapshot)
+	})
+}
+
+func (store *EventStore) After(subject es.SubjectID, pointInTime es.Timestamp) ([]es.Event, error) {
+	return store.Temporal(subject, pointInTime, es.EndOfTime)
+}
+
+func (store *EventStore) Before(subject es.SubjectID, pointInTime es.Timestamp) ([]es.Event, error) {
+	return store.Temporal(subject, es.BeginningOfTime, pointInTime)
+}
+
+func (store *EventStore) Temporal(subject es.SubjectID, from es.Timestamp, to es.Timestamp) ([]es.Event, error) {
+	return store.query(func(index *eventIndex) []indexEntry {
+		return index.temporal(subject, from, to)
+	})
+}
+
+func (store *EventStore) LatestEvent(subject es.SubjectID) (es.Event, error) {
+	if latestStagedEvent, found := store.stage.LatestEvent(subject); found {
+		return latestStagedEvent, nil
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.active == nil {
+		return es.Event{}, ErrStoreClosed
+	}
+
+	entry, found := store.index.latestEvent(subject)
+	if !found {
+		return es.Event{}, es.ErrNoEvents
+	}
+
+	events, err := store.readEvents([]indexEntry{entry})
+	if err != nil {
+		return es.Event{}, err
+	}
+
+	return events[0], nil
+}
+
+func (store *EventStore) LatestSnapshot(subject es.SubjectID) (es.Snapshot, error) {
+	if latestStagedSnapshot, found := store.stage.LatestSnapshot(subject); found {
+		return latestStagedSnapshot, nil
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.active == nil {
+		return es.Snapshot{}, ErrStoreClosed
+	}
+
+	entry, found := store.index.latestSnapshot(subject)
+	if !found {
+		return es.Snapshot{}, es.ErrNoSnapshots
+	}
+
+	return store.readSnapshot(entry)
+}
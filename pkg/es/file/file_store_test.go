@@ -0,0 +1,166 @@
+package file_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/file"
+)
+
+type Deposited struct {
+	Amount int
+}
+
+const (
+	producer = es.ProducerID("producer")
+	subject  = es.SubjectID("subject")
+)
+
+func openStore(t *testing.T, directory string) *file.EventStore {
+	t.Helper()
+
+	options := file.DefaultOptions(directory)
+	// Small segments such that the tests roll segments, and
+	// syncing in the background such that closing stops the syncer
+	options.SegmentSize = 256
+	options.Sync = file.SyncInterval
+
+	store, err := file.CreateFileEventStore(options)
+	if err != nil {
+		t.Fatal("CreateFileEventStore failed with err:", err)
+	}
+
+	return store
+}
+
+func shipDeposits(t *testing.T, store *file.EventStore, amounts ...int) {
+	t.Helper()
+
+	for _, amount := range amounts {
+		if err := store.Load(producer, subject, Deposited{Amount: amount}); err != nil {
+			t.Fatal("Load failed with err:", err)
+		}
+	}
+
+	if err := store.Ship(context.Background()); err != nil {
+		t.Fatal("Ship failed with err:", err)
+	}
+}
+
+func TestShipAndQuery(t *testing.T) {
+	t.Parallel()
+
+	store := openStore(t, t.TempDir())
+	defer store.Close()
+
+	shipDeposits(t, store, 1, 2, 3, 4, 5)
+
+	events, err := store.Concerning(subject)
+	if err != nil {
+		t.Fatal("Concerning failed with err:", err)
+	}
+
+	if len(events) != 5 {
+		t.Fatal("expected 5 events but got", len(events))
+	}
+
+	for idx, event := range events {
+		if event.Version != es.Version(idx) {
+			t.Error("expected version", idx, "but got", event.Version)
+		}
+	}
+
+	between, err := store.Between(subject, 1, 2)
+	if err != nil {
+		t.Fatal("Between failed with err:", err)
+	}
+
+	if len(between) != 2 || between[0].Version != 1 || between[1].Version != 2 {
+		t.Error("Between returned the wrong events", between)
+	}
+
+	latest, err := store.LatestEvent(subject)
+	if err != nil {
+		t.Fatal("LatestEvent failed with err:", err)
+	}
+
+	if latest.Version != 4 {
+		t.Error("expected latest version 4 but got", latest.Version)
+	}
+}
+
+func TestRecoveryTruncatesTornWrites(t *testing.T) {
+	t.Parallel()
+
+	directory := t.TempDir()
+
+	store := openStore(t, directory)
+	shipDeposits(t, store, 1, 2, 3)
+
+	if err := store.Close(); err != nil {
+		t.Fatal("Close failed with err:", err)
+	}
+
+	if err := store.Close(); !errors.Is(err, file.ErrStoreClosed) {
+		t.Fatal("expected closing again to fail but got", err)
+	}
+
+	// Simulate a crash in the middle of appending a record
+	segments, _ := filepath.Glob(filepath.Join(directory, "*.seg"))
+	latestSegment := segments[len(segments)-1]
+
+	segment, err := os.OpenFile(latestSegment, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal("opening the segment failed with err:", err)
+	}
+
+	if _, err = segment.Write([]byte{0, 0, 0, 42, 1, 2}); err != nil {
+		t.Fatal("writing the torn record failed with err:", err)
+	}
+
+	segment.Close()
+
+	store = openStore(t, directory)
+	defer store.Close()
+
+	shipDeposits(t, store, 4)
+
+	events, err := store.Concerning(subject)
+	if err != nil {
+		t.Fatal("Concerning failed with err:", err)
+	}
+
+	if len(events) != 4 {
+		t.Fatal("expected 4 events but got", len(events))
+	}
+
+	var data Deposited
+	if err := events[3].Unmarshal(&data); err != nil || data.Amount != 4 {
+		t.Error("the event appended after recovery is incorrect", events[3])
+	}
+}
+
+func TestShipRejectsStageOutOfSync(t *testing.T) {
+	t.Parallel()
+
+	directory := t.TempDir()
+
+	store := openStore(t, directory)
+	defer store.Close()
+
+	if err := store.Load(producer, subject, Deposited{Amount: 1}); err != nil {
+		t.Fatal("Load failed with err:", err)
+	}
+
+	if _, err := store.Send(producer, subject, []es.Data{Deposited{Amount: 2}}); err != nil {
+		t.Fatal("Send failed with err:", err)
+	}
+
+	if err := store.Ship(context.Background()); !errors.Is(err, es.ErrConcurrencyConflict) {
+		t.Error("expected Ship to fail with a concurrency conflict but got", err)
+	}
+}
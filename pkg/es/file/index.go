@@ -0,0 +1,173 @@
+package file
+
+import (
+	"sort"
+
+	"github.com/hywmongous/example-service/pkg/es"
+)
+
+// indexEntry is the on-disk description of a record in a segment.
+// It holds everything the queries filter on, so only the records
+// matching a query have to be read from the segments.
+type indexEntry struct {
+	Kind            recordKind    `json:"k"`
+	Subject         es.SubjectID  `json:"s"`
+	Producer        es.ProducerID `json:"p"`
+	Version         es.Version    `json:"v"`
+	SnapshotVersion es.Version    `json:"sv"`
+	Timestamp       es.Timestamp  `json:"t"`
+	Segment         uint64        `json:"seg"`
+	Offset          int64         `json:"off"`
+	Size            int64         `json:"n"`
+}
+
+type subjectIndex struct {
+	// Both are sorted with ascending versions because shipping
+	// rejects stages which are not in sync with the latest version
+	events    []indexEntry
+	snapshots []indexEntry
+}
+
+type eventIndex struct {
+	subjects  map[es.SubjectID]*subjectIndex
+	producers map[es.ProducerID][]indexEntry
+	// The offset just after the last indexed record of each segment
+	ends map[uint64]int64
+}
+
+func createEventIndex() *eventIndex {
+	return &eventIndex{
+		subjects:  make(map[es.SubjectID]*subjectIndex),
+		producers: make(map[es.ProducerID][]indexEntry),
+		ends:      make(map[uint64]int64),
+	}
+}
+
+func (index *eventIndex) add(entry indexEntry) {
+	subject, found := index.subjects[entry.Subject]
+	if !found {
+		subject = &subjectIndex{}
+		index.subjects[entry.Subject] = subject
+	}
+
+	switch entry.Kind {
+	case eventRecord:
+		subject.events = append(subject.events, entry)
+		index.producers[entry.Producer] = append(index.producers[entry.Producer], entry)
+	case snapshotRecord:
+		subject.snapshots = append(subject.snapshots, entry)
+	case indexRecord:
+		return
+	}
+
+	if end := entry.Offset + entry.Size; end > index.ends[entry.Segment] {
+		index.ends[entry.Segment] = end
+	}
+}
+
+func (index *eventIndex) events(subject es.SubjectID) []indexEntry {
+	if entries, found := index.subjects[subject]; found {
+		return entries.events
+	}
+
+	return nil
+}
+
+func (index *eventIndex) snapshots(subject es.SubjectID) []indexEntry {
+	if entries, found := index.subjects[subject]; found {
+		return entries.snapshots
+	}
+
+	return nil
+}
+
+// log returns at most limit events of the producer, after the first ones
+// which are skipped, in the order they were appended.
+func (index *eventIndex) log(producer es.ProducerID, skip uint64, limit int) []indexEntry {
+	events := index.producers[producer]
+	if skip >= uint64(len(events)) {
+		return nil
+	}
+
+	events = events[skip:]
+	if len(events) > limit {
+		events = events[:limit]
+	}
+
+	entries := make([]indexEntry, len(events))
+	copy(entries, events)
+
+	return entries
+}
+
+func (index *eventIndex) by(producer es.ProducerID) []indexEntry {
+	entries := make([]indexEntry, len(index.producers[producer]))
+	copy(entries, index.producers[producer])
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Version < entries[j].Version
+	})
+
+	return entries
+}
+
+// between returns the events with versions in the inclusive range [from; to].
+func (index *eventIndex) between(subject es.SubjectID, from es.Version, to es.Version) []indexEntry {
+	events := index.events(subject)
+
+	lower := sort.Search(len(events), func(i int) bool {
+		return events[i].Version >= from
+	})
+	upper := sort.Search(len(events), func(i int) bool {
+		return events[i].Version > to
+	})
+
+	if lower >= upper {
+		return nil
+	}
+
+	return events[lower:upper]
+}
+
+func (index *eventIndex) with(subject es.SubjectID, snapshot es.Version) []indexEntry {
+	return filterEntries(index.events(subject), func(entry indexEntry) bool {
+		return entry.SnapshotVersion == snapshot
+	})
+}
+
+// temporal returns the events with timestamps in the exclusive range ]from; to[.
+func (index *eventIndex) temporal(subject es.SubjectID, from es.Timestamp, to es.Timestamp) []indexEntry {
+	return filterEntries(index.events(subject), func(entry indexEntry) bool {
+		return entry.Timestamp > from && entry.Timestamp < to
+	})
+}
+
+func (index *eventIndex) latestEvent(subject es.SubjectID) (indexEntry, bool) {
+	events := index.events(subject)
+	if len(events) == 0 {
+		return indexEntry{}, false
+	}
+
+	return events[len(events)-1], true
+}
+
+func (index *eventIndex) latestSnapshot(subject es.SubjectID) (indexEntry, bool) {
+	snapshots := index.snapshots(subject)
+	if len(snapshots) == 0 {
+		return indexEntry{}, false
+	}
+
+	return snapshots[len(snapshots)-1], true
+}
+
+func filterEntries(entries []indexEntry, predicate func(entry indexEntry) bool) []indexEntry {
+	filtered := make([]indexEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		if predicate(entry) {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,168 @@
+package file
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Every record, both in the segments and in the index, is framed as:
+//   [length uint32][crc uint32][kind uint8][payload]
+// The length is the size of the payload and the crc is the
+// Castagnoli checksum of the kind and the payload. A record which
+// is cut short or fails its checksum is treated as a torn write.
+
+type recordKind byte
+
+const (
+	eventRecord recordKind = iota + 1
+	snapshotRecord
+	indexRecord
+)
+
+const (
+	recordHeaderSize = 9
+	maxPayloadSize   = 64 << 20 // 64MB
+
+	filePermissions = 0o644
+)
+
+var (
+	ErrTornRecord       = errors.New("record is incomplete")
+	ErrCorruptRecord    = errors.New("record checksum does not match its content")
+	ErrRecordTooLarge   = errors.New("record exceeds the maximum payload size")
+	ErrFailedOpenFile   = errors.New("log file could not be opened")
+	ErrFailedWriteFile  = errors.New("log file could not be written")
+	ErrFailedReadFile   = errors.New("log file could not be read")
+	ErrFailedSyncFile   = errors.New("log file could not be synced")
+	ErrFailedTruncation = errors.New("log file could not be truncated")
+	ErrFailedCloseFile  = errors.New("log file could not be closed")
+	ErrFailedRemoveFile = errors.New("log file could not be removed")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type logFile struct {
+	id   uint64
+	path string
+	file *os.File
+	size int64
+}
+
+func openLogFile(id uint64, path string) (*logFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, filePermissions)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrFailedOpenFile.Error())
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+
+		return nil, errors.Wrap(err, ErrFailedOpenFile.Error())
+	}
+
+	return &logFile{
+		id:   id,
+		path: path,
+		file: file,
+		size: info.Size(),
+	}, nil
+}
+
+func encodeRecord(kind recordKind, payload []byte) []byte {
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	record[8] = byte(kind)
+	copy(record[recordHeaderSize:], payload)
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(record[8:], crcTable))
+
+	return record
+}
+
+// append writes the record at the end of the file and
+// returns the offset at which the record begins.
+func (log *logFile) append(record []byte) (int64, error) {
+	offset := log.size
+
+	written, err := log.file.WriteAt(record, offset)
+	log.size += int64(written)
+
+	if err != nil {
+		return offset, errors.Wrap(err, ErrFailedWriteFile.Error())
+	}
+
+	return offset, nil
+}
+
+// read returns the kind and payload of the record at offset together
+// with the total size of the record. io.EOF is returned when offset is
+// exactly the end of the file, ErrTornRecord when the record is cut
+// short, and ErrCorruptRecord when the checksum does not match.
+func (log *logFile) read(offset int64) (recordKind, []byte, int64, error) {
+	if offset >= log.size {
+		return 0, nil, 0, io.EOF
+	}
+
+	header := make([]byte, recordHeaderSize)
+	if read, err := log.file.ReadAt(header, offset); read < recordHeaderSize {
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, nil, 0, errors.Wrap(err, ErrFailedReadFile.Error())
+		}
+
+		return 0, nil, 0, ErrTornRecord
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxPayloadSize {
+		return 0, nil, 0, ErrCorruptRecord
+	}
+
+	size := int64(recordHeaderSize) + int64(length)
+	if offset+size > log.size {
+		return 0, nil, 0, ErrTornRecord
+	}
+
+	payload := make([]byte, length)
+	if _, err := log.file.ReadAt(payload, offset+recordHeaderSize); err != nil {
+		return 0, nil, 0, errors.Wrap(err, ErrFailedReadFile.Error())
+	}
+
+	checksum := crc32.Update(crc32.Checksum(header[8:9], crcTable), crcTable, payload)
+	if checksum != binary.BigEndian.Uint32(header[4:8]) {
+		return 0, nil, 0, ErrCorruptRecord
+	}
+
+	return recordKind(header[8]), payload, size, nil
+}
+
+func (log *logFile) truncate(size int64) error {
+	if err := log.file.Truncate(size); err != nil {
+		return errors.Wrap(err, ErrFailedTruncation.Error())
+	}
+
+	log.size = size
+
+	return nil
+}
+
+func (log *logFile) sync() error {
+	return errors.Wrap(log.file.Sync(), ErrFailedSyncFile.Error())
+}
+
+func (log *logFile) close() error {
+	return errors.Wrap(log.file.Close(), ErrFailedCloseFile.Error())
+}
+
+func (log *logFile) remove() error {
+	log.file.Close()
+
+	return errors.Wrap(os.Remove(log.path), ErrFailedRemoveFile.Error())
+}
+
+func isTorn(err error) bool {
+	return errors.Is(err, ErrTornRecord) || errors.Is(err, ErrCorruptRecord)
+}
@@ -0,0 +1,551 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	HeaderDeadLetterError     = "dead-letter-error"
+	HeaderDeadLetterTopic     = "dead-letter-topic"
+	HeaderDeadLetterPartition = "dead-letter-partition"
+	HeaderDeadLetterOffset    = "dead-letter-offset"
+)
+
+var (
+	ErrKafkaCouldNotReadMessage     = errors.New("kafka reader failed reading the message")
+	ErrKafkaCouldNotDecodeMessage   = errors.New("kafka message could not be decoded as an event")
+	ErrKafkaCouldNotProcessMessage  = errors.New("kafka message could not be processed")
+	ErrKafkaCouldNotCommitMessage   = errors.New("kafka reader failed committing the message")
+	ErrKafkaCouldNotDeadLetter      = errors.New("kafka writer failed writing the message to the dead letter topic")
+	ErrKafkaNoDeadLetterTopic       = errors.New("kafka consumer stopped as the failed message has no dead letter topic")
+	ErrKafkaCouldNotCreateTransport = errors.New("kafka transport could not be created")
+)
+
+// EventHandler processes the events of a partition one at a time.
+// Returning an error moves the message to the dead letter topic.
+type EventHandler func(ctx context.Context, event es.Event) error
+
+type settlement struct {
+	msg     kafka.Message
+	event   es.Event
+	attempt int
+	// A nil error acknowledges the message
+	err error
+}
+
+// settlements queues the acknowledgements for the consumer loop. Settling
+// never blocks the subscriber, as it may otherwise wait for the loop which
+// in turn waits for the subscriber to receive an error.
+type settlements struct {
+	mutex   sync.Mutex
+	pending []settlement
+	signal  chan struct{}
+}
+
+func createSettlements() *settlements {
+	return &settlements{
+		mutex:   sync.Mutex{},
+		pending: nil,
+		signal:  make(chan struct{}, 1),
+	}
+}
+
+func (queue *settlements) push(settled settlement) {
+	queue.mutex.Lock()
+	queue.pending = append(queue.pending, settled)
+	queue.mutex.Unlock()
+
+	select {
+	case queue.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (queue *settlements) drain() []settlement {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	pending := queue.pending
+	queue.pending = nil
+
+	return pending
+}
+
+// read delivers the events of the topic until the context ends, after which
+// both channels are closed. Offsets are only committed once the deliveries
+// are acknowledged, and negative acknowledgements are redelivered with an
+// exponential backoff until the maximum number of deliveries is reached.
+// Then the messages are moved to the dead letter topic, and so are messages
+// which cannot be decoded as events, such that they do not block the partition.
+// A message which cannot be moved is never committed, instead reading stops.
+func (stream *Stream) read(
+	ctx context.Context,
+	config kafka.ReaderConfig,
+	deliveries chan es.Delivery,
+	errs chan error,
+) {
+	var fetcher sync.WaitGroup
+
+	defer close(errs)
+	defer close(deliveries)
+	defer fetcher.Wait()
+
+	// Stopping early must also stop the fetcher, which is waited for above
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	reader := kafka.NewReader(config)
+	defer reader.Close()
+
+	deadLetters, err := stream.deadLetterWriter()
+	if err != nil {
+		stream.report(ctx, errs, err)
+
+		return
+	}
+
+	if deadLetters != nil {
+		defer deadLetters.Close()
+	}
+
+	fetched := make(chan kafka.Message)
+	settled := createSettlements()
+	redeliveries := make(chan es.Delivery)
+	tracker := createOffsetTracker(config.Topic)
+
+	fetcher.Add(1)
+
+	go func() {
+		defer fetcher.Done()
+		stream.fetchAll(ctx, reader, fetched, errs)
+	}()
+
+	var queue []es.Delivery
+
+	for {
+		// Fetching is paused while the subscriber is behind,
+		// and deliveries are only sent while there are any queued
+		var (
+			fetch = fetched
+			out   chan es.Delivery
+			next  es.Delivery
+		)
+
+		if len(queue) >= defaultQueueCapacity {
+			fetch = nil
+		}
+
+		if len(queue) > 0 {
+			out = deliveries
+			next = queue[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-fetch:
+			if !ok {
+				return
+			}
+
+			tracker.track(msg)
+
+			event, err := es.UnmarshalEvent(msg.Value)
+			if err != nil {
+				err = errors.Wrap(err, ErrKafkaCouldNotDecodeMessage.Error())
+				if !stream.settle(ctx, reader, deadLetters, tracker, msg, err, errs) {
+					return
+				}
+
+				continue
+			}
+
+			queue = append(queue, stream.delivery(msg, event, 1, settled))
+		case delivery := <-redeliveries:
+			queue = append(queue, delivery)
+		case out <- next:
+			queue = queue[1:]
+		case <-settled.signal:
+			for _, outcome := range settled.drain() {
+				if outcome.err != nil && outcome.attempt < stream.options.MaxDeliveries {
+					stream.redeliver(ctx, outcome, settled, redeliveries)
+
+					continue
+				}
+
+				if !stream.settle(ctx, reader, deadLetters, tracker, outcome.msg, outcome.err, errs) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// delivery creates the delivery of the message. Settling it after the
+// subscription ended has no effect, as the offset is not committed,
+// hence the message is redelivered to the next subscriber.
+func (stream *Stream) delivery(msg kafka.Message, event es.Event, attempt int, settled *settlements) es.Delivery {
+	settle := func(err error) {
+		settled.push(settlement{
+			msg:     msg,
+			event:   event,
+			attempt: attempt,
+			err:     err,
+		})
+	}
+
+	return es.CreateDelivery(
+		event,
+		attempt,
+		func() { settle(nil) },
+		settle,
+	)
+}
+
+func (stream *Stream) redeliver(
+	ctx context.Context,
+	nacked settlement,
+	settled *settlements,
+	redeliveries chan es.Delivery,
+) {
+	delivery := stream.delivery(nacked.msg, nacked.event, nacked.attempt+1, settled)
+
+	time.AfterFunc(stream.backoff(nacked.attempt), func() {
+		select {
+		case redeliveries <- delivery:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// settle moves the failed message to the dead letter topic, if it failed,
+// and commits the offsets which are no longer blocked by unsettled messages.
+// A failed message which could not be dead lettered is left unsettled.
+func (stream *Stream) settle(
+	ctx context.Context,
+	reader *kafka.Reader,
+	deadLetters *kafka.Writer,
+	tracker *offsetTracker,
+	msg kafka.Message,
+	err error,
+	errs chan error,
+) bool {
+	if err != nil && !stream.deadLetterOrStop(ctx, deadLetters, msg, err, errs) {
+		return false
+	}
+
+	committable, ok := tracker.settle(msg)
+	if !ok {
+		return true
+	}
+
+	return stream.commit(ctx, reader, committable, errs)
+}
+
+// fetchAll fetches messages until the context ends and then closes the channel.
+func (stream *Stream) fetchAll(ctx context.Context, reader *kafka.Reader, fetched chan kafka.Message, errs chan error) {
+	defer close(fetched)
+
+	for {
+		msg, ok := stream.fetch(ctx, reader, errs)
+		if !ok {
+			return
+		}
+
+		select {
+		case fetched <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Consume processes the partitions assigned to this consumer concurrently.
+// The events of each partition are handled sequentially by their own worker,
+// hence the events of a subject are handled in the order they were published.
+// The returned channel receives the errors and is closed when the context ends,
+// or when a failed message cannot be moved to the dead letter topic.
+func (stream *Stream) Consume(ctx context.Context, topic es.Topic, handler EventHandler) chan error {
+	errs := make(chan error)
+
+	config := stream.readerConfig(topic)
+	if err := config.Validate(); err != nil {
+		go func() {
+			defer close(errs)
+			stream.report(ctx, errs, errors.Wrap(err, ErrInvalidKafkaReaderConfig.Error()))
+		}()
+
+		return errs
+	}
+
+	go stream.consume(ctx, config, handler, errs)
+
+	return errs
+}
+
+func (stream *Stream) consume(
+	ctx context.Context,
+	config kafka.ReaderConfig,
+	handler EventHandler,
+	errs chan error,
+) {
+	defer close(errs)
+
+	// The workers stop the consumer when a message can neither be handled
+	// nor dead lettered, such that it is redelivered to the next consumer
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	reader := kafka.NewReader(config)
+	defer reader.Close()
+
+	deadLetters, err := stream.deadLetterWriter()
+	if err != nil {
+		stream.report(ctx, errs, err)
+
+		return
+	}
+
+	if deadLetters != nil {
+		defer deadLetters.Close()
+	}
+
+	var workers sync.WaitGroup
+
+	partitions := make(map[int]chan kafka.Message)
+
+	defer func() {
+		for _, partition := range partitions {
+			close(partition)
+		}
+
+		workers.Wait()
+	}()
+
+	for {
+		msg, ok := stream.fetch(ctx, reader, errs)
+		if !ok {
+			return
+		}
+
+		partition, found := partitions[msg.Partition]
+		if !found {
+			partition = make(chan kafka.Message, defaultQueueCapacity)
+			partitions[msg.Partition] = partition
+
+			workers.Add(1)
+
+			go func(messages chan kafka.Message) {
+				defer workers.Done()
+				stream.process(ctx, stop, reader, deadLetters, messages, handler, errs)
+			}(partition)
+		}
+
+		select {
+		case partition <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (stream *Stream) process(
+	ctx context.Context,
+	stop context.CancelFunc,
+	reader *kafka.Reader,
+	deadLetters *kafka.Writer,
+	messages chan kafka.Message,
+	handler EventHandler,
+	errs chan error,
+) {
+	for msg := range messages {
+		event, err := es.UnmarshalEvent(msg.Value)
+		if err != nil {
+			err = errors.Wrap(err, ErrKafkaCouldNotDecodeMessage.Error())
+		} else {
+			err = handler(ctx, event)
+		}
+
+		// Messages interrupted by the shutdown are not committed
+		// such that they are redelivered to the next consumer
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil && !stream.deadLetterOrStop(ctx, deadLetters, msg, err, errs) {
+			stop()
+
+			return
+		}
+
+		if !stream.commit(ctx, reader, msg, errs) {
+			return
+		}
+	}
+}
+
+// fetch reads the next message and retries with an exponential backoff
+// when the brokers fail. It returns false once the context ends.
+func (stream *Stream) fetch(ctx context.Context, reader *kafka.Reader, errs chan error) (kafka.Message, bool) {
+	for failures := 1; ; failures++ {
+		msg, err := reader.FetchMessage(ctx)
+		if err == nil {
+			return msg, true
+		}
+
+		if ctx.Err() != nil ||
+			!stream.report(ctx, errs, errors.Wrap(err, ErrKafkaCouldNotReadMessage.Error())) ||
+			!sleep(ctx, stream.backoff(failures)) {
+			return kafka.Message{}, false
+		}
+	}
+}
+
+// commit commits the offset of the message. Failed messages are only
+// committed once they are dead lettered, otherwise they would be lost.
+func (stream *Stream) commit(
+	ctx context.Context,
+	reader *kafka.Reader,
+	msg kafka.Message,
+	errs chan error,
+) bool {
+	if err := reader.CommitMessages(ctx, msg); err != nil {
+		return stream.report(ctx, errs, errors.Wrap(err, ErrKafkaCouldNotCommitMessage.Error()))
+	}
+
+	return true
+}
+
+// report sends the error to the subscriber and returns
+// false if the context ended before it was received.
+func (stream *Stream) report(ctx context.Context, errs chan error, err error) bool {
+	select {
+	case errs <- err:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (stream *Stream) backoff(failures int) time.Duration {
+	backoff := stream.options.BackoffMin
+
+	for attempt := 1; attempt < failures && backoff < stream.options.BackoffMax; attempt++ {
+		backoff *= 2
+	}
+
+	if backoff > stream.options.BackoffMax {
+		return stream.options.BackoffMax
+	}
+
+	return backoff
+}
+
+// sleep returns false if the context ended before the duration passed.
+func sleep(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (stream *Stream) deadLetterWriter() (*kafka.Writer, error) {
+	if stream.options.DeadLetterTopic == "" {
+		return nil, nil
+	}
+
+	transport, err := stream.options.transport()
+	if err != nil {
+		return nil, errors.Wrap(err, ErrKafkaCouldNotCreateTransport.Error())
+	}
+
+	return &kafka.Writer{
+		Addr:         kafka.TCP(stream.options.Brokers...),
+		Topic:        string(stream.options.DeadLetterTopic),
+		Balancer:     &kafka.Hash{},
+		MaxAttempts:  defaultMaxAttempts,
+		BatchSize:    1,
+		ReadTimeout:  defaultReadTimeout,
+		WriteTimeout: defaultWriteTimeout,
+		RequiredAcks: stream.options.RequiredAcks,
+		Compression:  stream.options.Compression,
+		Transport:    transport,
+	}, nil
+}
+
+// deadLetterOrStop moves the failed message to the dead letter topic and
+// retries with an exponential backoff while the writes fail. It returns false
+// if the consumer must stop instead, without committing the message, which
+// is when the context ends or when there is no dead letter topic to move it to.
+func (stream *Stream) deadLetterOrStop(
+	ctx context.Context,
+	writer *kafka.Writer,
+	msg kafka.Message,
+	cause error,
+	errs chan error,
+) bool {
+	if writer == nil {
+		cause = stream.deadLetter(ctx, writer, msg, cause)
+		stream.report(ctx, errs, errors.Mark(errors.Wrap(cause, ErrKafkaNoDeadLetterTopic.Error()), ErrKafkaNoDeadLetterTopic))
+
+		return false
+	}
+
+	for failures := 1; ; failures++ {
+		err := stream.deadLetter(ctx, writer, msg, cause)
+		if err == nil {
+			return true
+		}
+
+		if ctx.Err() != nil ||
+			!stream.report(ctx, errs, err) ||
+			!sleep(ctx, stream.backoff(failures)) {
+			return false
+		}
+	}
+}
+
+// deadLetter writes the message to the dead letter topic with its original
+// key, value and headers. The cause and origin are added as headers.
+// Without a dead letter topic the cause is returned to be reported instead.
+func (stream *Stream) deadLetter(ctx context.Context, writer *kafka.Writer, msg kafka.Message, cause error) error {
+	cause = errors.Wrapf(
+		cause,
+		"%s (topic %s, partition %d, offset %d)",
+		ErrKafkaCouldNotProcessMessage.Error(), msg.Topic, msg.Partition, msg.Offset,
+	)
+
+	if writer == nil {
+		return cause
+	}
+
+	headers := make([]kafka.Header, 0, len(msg.Headers)+4)
+	headers = append(headers, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDeadLetterError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDeadLetterTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderDeadLetterPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderDeadLetterOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+	)
+
+	err := writer.WriteMessages(ctx, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+		Time:    time.Now(),
+	})
+
+	return errors.Wrap(err, ErrKafkaCouldNotDeadLetter.Error())
+}
@@ -10,11 +10,11 @@ import (
 )
 
 type Stream struct {
-	// We only use a single topic per "bounded context"
-	// For this reason it fits the "topic" to be a field
-	// within the kafka stream struct instance
-	// https://www.confluent.io/blog/put-several-event-types-kafka-topic/
-	topic es.Topic
+	options Options
+	dialer  *kafka.Dialer
+	// The writer is shared by all publishers such that the connections
+	// to the partition leaders are reused and the messages are batched
+	writer *kafka.Writer
 }
 
 const (
@@ -42,161 +42,179 @@ const (
 	defaultIsolationLevel         = kafka.ReadCommitted
 
 	// Write kafka conf.
-	defaultBatchSize         = 100
-	defaultBatchBytes        = 1 << 20
-	defaultBatchTimeout      = 1 * time.Second
-	defaultReadTimeout       = 10 * time.Second
-	defaultWriteTimeout      = 10 * time.Second
-	defaultRebalanceInterval = 10 * time.Second // Deprecated
-	defaultIdleConnTimeout   = 10 * time.Second // Deprecated
-	defaultRequiredAcks      = -1               // Wait for all replicas
-	defaultAsync             = false            // By using false errors are not ignored
-	broker                   = "ia_kafka:9092"
-	group                    = "ia"
-
-	defaultOffset        = 0
-	defaultHighWaterMark = 0
+	defaultBatchSize  = 100
+	defaultBatchBytes = 1 << 20
+	// Synchronous writes wait for the batch to fill up or time out,
+	// hence a long timeout delays publishing a few events
+	defaultBatchTimeout = 10 * time.Millisecond
+	defaultReadTimeout  = 10 * time.Second
+	defaultWriteTimeout = 10 * time.Second
 )
 
 var (
 	ErrInvalidKafkaReaderConfig = errors.New("kafka reader config is invalid")
-	ErrInvalidKafkaWriterConfig = errors.New("kafka writer config is invalid")
 	ErrKafkaCouldNotWriteEvent  = errors.New("kafka writer failed writing the event")
 	ErrKafkaCouldNotCloseWriter = errors.New("kafka writer failed closing")
 	ErrEventMarhsallingFailed   = errors.New("failed marshalling event")
 	ErrFailedSteamingEvents     = errors.New("failed publishing the events through the kafka stream")
 )
 
-func CreateKafkaStream(topic es.Topic) *Stream {
-	/*conn, err := kafka.Dial("tcp", broker)
-	if err != nil {
-		panic(err)
+func CreateKafkaStream(options Options) (*Stream, error) {
+	if err := options.Validate(); err != nil {
+		return nil, errors.Wrap(err, ErrInvalidKafkaStreamOptions.Error())
 	}
-	defer conn.Close()
-
-	conn.CreateTopics(kafka.TopicConfig{
-		Topic:             string(topic),
-		NumPartitions:     1,
-		ReplicationFactor: 3,
-	})*/
 
-	return &Stream{
-		topic: topic,
+	dialer, err := options.dialer()
+	if err != nil {
+		return nil, errors.Wrap(err, ErrInvalidKafkaStreamOptions.Error())
 	}
-}
 
-func (stream *Stream) write(ctx context.Context, config kafka.WriterConfig, events []es.Event) error {
-	var defaultHeaders []kafka.Header
+	transport, err := options.transport()
+	if err != nil {
+		return nil, errors.Wrap(err, ErrInvalidKafkaStreamOptions.Error())
+	}
 
-	writer := kafka.NewWriter(config)
+	stream := &Stream{
+		options: options,
+		dialer:  dialer,
+		writer:  nil,
+	}
+	stream.writer = stream.createWriter(transport)
 
-	for _, event := range events {
-		value, err := event.Marshall()
-		if err != nil {
-			return errors.Wrap(err, ErrEventMarhsallingFailed.Error())
-		}
+	readerConfig := stream.readerConfig(options.Topic)
+	if err := readerConfig.Validate(); err != nil {
+		return nil, errors.Wrap(err, ErrInvalidKafkaReaderConfig.Error())
+	}
 
-		message := kafka.Message{
-			Key:           []byte(event.Subject),
-			Value:         value,
-			Topic:         string(stream.topic),
-			Partition:     defaultPartition,
-			Offset:        defaultOffset,
-			HighWaterMark: defaultHighWaterMark,
-			Headers:       defaultHeaders,
-			Time:          time.Now(),
-		}
+	if options.EnsureTopic {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultDialTimeout)
+		defer cancel()
 
-		if err := writer.WriteMessages(ctx, message); err != nil {
-			return errors.Wrap(err, ErrKafkaCouldNotWriteEvent.Error())
+		if err := stream.ensureTopic(ctx); err != nil {
+			return nil, err
 		}
 	}
 
+	return stream, nil
+}
+
+// Close flushes the pending messages and closes the connections of the writer.
+// In asynchronous mode it blocks until the delivery of all messages is reported.
+func (stream *Stream) Close() error {
 	return errors.Wrap(
-		writer.Close(),
+		stream.writer.Close(),
 		ErrKafkaCouldNotCloseWriter.Error(),
 	)
 }
 
-func (stream *Stream) Publish(events []es.Event) error {
+func (stream *Stream) createWriter(transport *kafka.Transport) *kafka.Writer {
 	var defaultLogger kafka.Logger
 
 	var defaultErrorLogger kafka.Logger
 
-	var defaultCompressionCodec kafka.CompressionCodec
-
-	defaultBalancer := &kafka.RoundRobin{}
-	defaultDialer := kafka.DefaultDialer
-
-	config := kafka.WriterConfig{
-		Brokers:           []string{broker},
-		Topic:             string(stream.topic),
-		Dialer:            defaultDialer,
-		Balancer:          defaultBalancer,
-		MaxAttempts:       defaultMaxAttempts,
-		QueueCapacity:     defaultQueueCapacity,
-		BatchSize:         defaultBatchSize,
-		BatchBytes:        defaultBatchBytes,
-		BatchTimeout:      defaultBatchTimeout,
-		ReadTimeout:       defaultReadTimeout,
-		WriteTimeout:      defaultWriteTimeout,
-		RebalanceInterval: defaultRebalanceInterval,
-		IdleConnTimeout:   defaultIdleConnTimeout,
-		RequiredAcks:      defaultRequiredAcks,
-		Async:             defaultAsync,
-		CompressionCodec:  defaultCompressionCodec,
-		Logger:            defaultLogger,
-		ErrorLogger:       defaultErrorLogger,
+	var completion func(messages []kafka.Message, err error)
+	if stream.options.OnDelivery != nil {
+		completion = stream.reportDelivery
 	}
 
-	if err := config.Validate(); err != nil {
-		panic(errors.Wrap(err, ErrInvalidKafkaWriterConfig.Error()))
+	// Events are keyed by their subject and the key is hashed to choose
+	// the partition. Thereby all events of a subject end up in the same
+	// partition in the order they were written, while the subjects are
+	// spread over all the partitions of the topic. Murmur2 is the same
+	// hash as the one used by the Java client.
+	defaultBalancer := &kafka.Murmur2Balancer{}
+
+	return &kafka.Writer{
+		Addr:         kafka.TCP(stream.options.Brokers...),
+		Topic:        string(stream.options.Topic),
+		Balancer:     defaultBalancer,
+		MaxAttempts:  defaultMaxAttempts,
+		BatchSize:    defaultBatchSize,
+		BatchBytes:   defaultBatchBytes,
+		BatchTimeout: defaultBatchTimeout,
+		ReadTimeout:  defaultReadTimeout,
+		WriteTimeout: defaultWriteTimeout,
+		RequiredAcks: stream.options.RequiredAcks,
+		Async:        stream.options.Async,
+		Completion:   completion,
+		Compression:  stream.options.Compression,
+		Logger:       defaultLogger,
+		ErrorLogger:  defaultErrorLogger,
+		Transport:    transport,
 	}
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// reportDelivery passes the outcome of writing a batch on to the callback
+// of the options. The writer only knows the messages, so they are decoded
+// back into the events which were published.
+func (stream *Stream) reportDelivery(messages []kafka.Message, err error) {
+	events := make([]es.Event, 0, len(messages))
 
-	return errors.Wrap(
-		stream.write(ctx, config, events),
-		ErrFailedSteamingEvents.Error(),
-	)
+	for _, message := range messages {
+		event, decodeErr := es.UnmarshalEvent(message.Value)
+		if decodeErr != nil {
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	if err != nil {
+		err = errors.Wrap(err, ErrKafkaCouldNotWriteEvent.Error())
+	}
+
+	stream.options.OnDelivery(events, err)
 }
 
-func (stream *Stream) read(
-	ctx context.Context,
-	config kafka.ReaderConfig,
-	events chan es.Event,
-	errors chan error,
-) {
-	reader := kafka.NewReader(config)
-	defer reader.Close() // What if closing the reader fails?
-
-	for {
-		msg, err := reader.ReadMessage(ctx)
+// Publish writes all the events in a single batched write. In asynchronous
+// mode it returns as soon as the events are queued and the delivery
+// is reported through the OnDelivery callback of the options.
+func (stream *Stream) Publish(events []es.Event) error {
+	var defaultHeaders []kafka.Header
+
+	messages := make([]kafka.Message, len(events))
+
+	for idx, event := range events {
+		value, err := event.Marshall()
 		if err != nil {
-			errors <- err
+			return errors.Wrap(
+				errors.Wrap(err, ErrEventMarhsallingFailed.Error()),
+				ErrFailedSteamingEvents.Error(),
+			)
 		}
 
-		event, err := es.UnmarshalEvent(msg.Value)
-		if err != nil {
-			errors <- err
+		// The partition is chosen by the balancer from the key,
+		// and the topic is the one configured on the writer
+		messages[idx] = kafka.Message{
+			Key:     []byte(event.Subject),
+			Value:   value,
+			Headers: defaultHeaders,
+			Time:    time.Now(),
 		}
-		events <- event
 	}
+
+	if err := stream.writer.WriteMessages(context.Background(), messages...); err != nil {
+		return errors.Wrap(
+			errors.Wrap(err, ErrKafkaCouldNotWriteEvent.Error()),
+			ErrFailedSteamingEvents.Error(),
+		)
+	}
+
+	return nil
 }
 
-func (stream *Stream) Subscribe(ctx context.Context, topic es.Topic) (chan es.Event, chan error) {
+func (stream *Stream) readerConfig(topic es.Topic) kafka.ReaderConfig {
 	var defaultLogger kafka.Logger
 
 	var defaultErrorLogger kafka.Logger
 
-	config := kafka.ReaderConfig{
-		Brokers:         []string{broker},
-		GroupID:         group,
+	return kafka.ReaderConfig{
+		Brokers:         stream.options.Brokers,
+		GroupID:         stream.options.Group,
 		GroupTopics:     nil, // Defined through "Topic"
 		Topic:           string(topic),
 		Partition:       defaultPartition, // the same as undefined
-		Dialer:          nil,
+		Dialer:          stream.dialer,
 		QueueCapacity:   defaultQueueCapacity,
 		MinBytes:        defaultMinBytes,
 		MaxBytes:        defaultMaxBytes, // 1 MB,
@@ -222,15 +240,28 @@ func (stream *Stream) Subscribe(ctx context.Context, topic es.Topic) (chan es.Ev
 		IsolationLevel:         defaultIsolationLevel,
 		MaxAttempts:            defaultMaxAttempts,
 	}
+}
+
+func (stream *Stream) Subscribe(ctx context.Context, topic es.Topic) (chan es.Delivery, chan error) {
+	deliveries := make(chan es.Delivery)
+	errs := make(chan error)
 
+	config := stream.readerConfig(topic)
 	if err := config.Validate(); err != nil {
-		panic(errors.Wrap(err, ErrInvalidKafkaReaderConfig.Error()))
-	}
+		go func() {
+			defer close(deliveries)
+			defer close(errs)
 
-	events := make(chan es.Event)
-	errors := make(chan error)
+			select {
+			case errs <- errors.Wrap(err, ErrInvalidKafkaReaderConfig.Error()):
+			case <-ctx.Done():
+			}
+		}()
+
+		return deliveries, errs
+	}
 
-	go stream.read(ctx, config, events, errors)
+	go stream.read(ctx, config, deliveries, errs)
 
-	return events, errors
+	return deliveries, errs
 }
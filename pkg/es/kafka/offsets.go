@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"sort"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type partitionOffsets struct {
+	// The offsets which are fetched but not yet committed in ascending order
+	pending []int64
+	settled map[int64]bool
+	// The greatest committed offset, or -1 before the first commit
+	committed int64
+}
+
+// offsetTracker keeps track of the settled messages of each partition.
+// Kafka commits an offset for everything before it in the partition,
+// hence an offset is only committed once all the messages before it are settled.
+// It is not safe for concurrent use.
+type offsetTracker struct {
+	topic      string
+	partitions map[int]*partitionOffsets
+}
+
+func createOffsetTracker(topic string) *offsetTracker {
+	return &offsetTracker{
+		topic:      topic,
+		partitions: make(map[int]*partitionOffsets),
+	}
+}
+
+func (tracker *offsetTracker) track(msg kafka.Message) {
+	partition, found := tracker.partitions[msg.Partition]
+	if !found {
+		partition = &partitionOffsets{
+			pending:   nil,
+			settled:   make(map[int64]bool),
+			committed: -1,
+		}
+		tracker.partitions[msg.Partition] = partition
+	}
+
+	// Messages are fetched in order, except after a rebalance
+	// where the partition is fetched again from the committed offset
+	if msg.Offset <= partition.committed {
+		return
+	}
+
+	idx, found := partition.search(msg.Offset)
+	if found {
+		return
+	}
+
+	partition.pending = append(partition.pending, 0)
+	copy(partition.pending[idx+1:], partition.pending[idx:])
+	partition.pending[idx] = msg.Offset
+}
+
+// settle marks the message as settled and returns the message
+// with the greatest offset that can be committed, if any. Settling
+// a message which is not pending, such as a redelivered message
+// which is already committed, has no effect.
+func (tracker *offsetTracker) settle(msg kafka.Message) (kafka.Message, bool) {
+	partition, found := tracker.partitions[msg.Partition]
+	if !found {
+		return kafka.Message{}, false
+	}
+
+	if _, pending := partition.search(msg.Offset); !pending {
+		return kafka.Message{}, false
+	}
+
+	partition.settled[msg.Offset] = true
+
+	committable := int64(-1)
+
+	for len(partition.pending) > 0 && partition.settled[partition.pending[0]] {
+		committable = partition.pending[0]
+		delete(partition.settled, committable)
+		partition.pending = partition.pending[1:]
+	}
+
+	if committable < 0 {
+		return kafka.Message{}, false
+	}
+
+	partition.committed = committable
+
+	return kafka.Message{
+		Topic:     tracker.topic,
+		Partition: msg.Partition,
+		Offset:    committable,
+	}, true
+}
+
+// search returns the index of the offset in the pending
+// offsets, or where it belongs if it is not pending.
+func (partition *partitionOffsets) search(offset int64) (int, bool) {
+	idx := sort.Search(len(partition.pending), func(i int) bool {
+		return partition.pending[i] >= offset
+	})
+
+	return idx, idx < len(partition.pending) && partition.pending[idx] == offset
+}
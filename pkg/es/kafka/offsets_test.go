@@ -0,0 +1,121 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// step tracks or settles the offset of the partition. Settling expects
+// the offset which is committed, where -1 is expected to commit nothing.
+type step struct {
+	settle    bool
+	partition int
+	offset    int64
+	commit    int64
+}
+
+func track(partition int, offset int64) step {
+	return step{settle: false, partition: partition, offset: offset, commit: -1}
+}
+
+func settle(partition int, offset int64, commit int64) step {
+	return step{settle: true, partition: partition, offset: offset, commit: commit}
+}
+
+func TestOffsetTrackerCommitsContiguousSettledOffsets(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "settled in order",
+			steps: []step{
+				track(0, 0), track(0, 1), track(0, 2),
+				settle(0, 0, 0), settle(0, 1, 1), settle(0, 2, 2),
+			},
+		},
+		{
+			name: "settled out of order",
+			steps: []step{
+				track(0, 0), track(0, 1), track(0, 2),
+				settle(0, 2, -1), settle(0, 1, -1), settle(0, 0, 2),
+			},
+		},
+		{
+			name: "offsets with gaps, as in compacted topics",
+			steps: []step{
+				track(0, 3), track(0, 7), track(0, 8),
+				settle(0, 7, -1), settle(0, 3, 7), settle(0, 8, 8),
+			},
+		},
+		{
+			name: "partitions are committed independently",
+			steps: []step{
+				track(0, 0), track(1, 0), track(0, 1),
+				settle(0, 1, -1), settle(1, 0, 0), settle(0, 0, 1),
+			},
+		},
+		{
+			name: "redelivered before being committed",
+			steps: []step{
+				track(0, 0), track(0, 1), settle(0, 1, -1),
+				// The partition is fetched again after a rebalance
+				track(0, 0), track(0, 1),
+				settle(0, 0, 1), settle(0, 1, -1),
+			},
+		},
+		{
+			name: "redelivered after being committed",
+			steps: []step{
+				track(0, 0), track(0, 1), settle(0, 0, 0),
+				// An older committed offset is fetched again after a rebalance
+				track(0, 0), settle(0, 0, -1),
+				settle(0, 1, 1),
+			},
+		},
+		{
+			name: "settled without being tracked",
+			steps: []step{
+				settle(0, 0, -1),
+				track(0, 1), settle(0, 2, -1), settle(0, 1, 1),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			tracker := createOffsetTracker("topic")
+
+			for idx, step := range test.steps {
+				msg := kafka.Message{Topic: "topic", Partition: step.partition, Offset: step.offset}
+
+				if !step.settle {
+					tracker.track(msg)
+
+					continue
+				}
+
+				committable, ok := tracker.settle(msg)
+
+				switch {
+				case step.commit < 0 && ok:
+					t.Errorf("step %d: expected nothing to be committed but got offset %d", idx, committable.Offset)
+				case step.commit >= 0 && !ok:
+					t.Errorf("step %d: expected offset %d to be committed but got nothing", idx, step.commit)
+				case ok && (committable.Offset != step.commit || committable.Partition != step.partition):
+					t.Errorf(
+						"step %d: expected offset %d of partition %d but got offset %d of partition %d",
+						idx, step.commit, step.partition, committable.Offset, committable.Partition,
+					)
+				}
+			}
+		})
+	}
+}
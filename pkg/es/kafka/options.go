@@ -0,0 +1,228 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+type SASLMechanism string
+
+const (
+	SASLNone        = SASLMechanism("")
+	SASLPlain       = SASLMechanism("PLAIN")
+	SASLScramSHA256 = SASLMechanism("SCRAM-SHA-256")
+	SASLScramSHA512 = SASLMechanism("SCRAM-SHA-512")
+)
+
+type SASLOptions struct {
+	Mechanism SASLMechanism
+	Username  string
+	Password  string
+}
+
+type Options struct {
+	Brokers []string
+	// We only use a single topic per "bounded context"
+	// https://www.confluent.io/blog/put-several-event-types-kafka-topic/
+	Topic    es.Topic
+	Group    string
+	ClientID string
+
+	// A nil TLS config means the connections are not encrypted
+	TLS  *tls.Config
+	SASL SASLOptions
+
+	// The zero value means the messages are not compressed
+	Compression  kafka.Compression
+	RequiredAcks kafka.RequiredAcks
+	// In asynchronous mode publishing does not wait for the brokers
+	// to acknowledge the events. The outcome of delivering them is
+	// reported through OnDelivery, which is also called in synchronous mode
+	Async      bool
+	OnDelivery func(events []es.Event, err error)
+
+	// When EnsureTopic is true the topic is created with
+	// the partitions and replication factor if it does not exist
+	EnsureTopic       bool
+	Partitions        int
+	ReplicationFactor int
+
+	// Messages which cannot be decoded as events are written to the
+	// dead letter topic. If it is empty, such a message is reported
+	// and the consumer stops without committing it
+	DeadLetterTopic es.Topic
+	// The consumer backs off exponentially between these durations
+	// when it fails reading from the brokers or redelivers an event
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+	// Negatively acknowledged events are redelivered until they are
+	// delivered this many times, then they are moved to the dead letter topic
+	MaxDeliveries int
+}
+
+const (
+	defaultBroker            = "ia_kafka:9092"
+	defaultGroup             = "ia"
+	defaultClientID          = "ia"
+	defaultPartitions        = 1
+	defaultReplicationFactor = 1
+	defaultDialTimeout       = 10 * time.Second
+	defaultBackoffMin        = 100 * time.Millisecond
+	defaultBackoffMax        = 10 * time.Second
+	defaultMaxDeliveries     = 5
+)
+
+var (
+	ErrNoBrokers                 = errors.New("kafka options must have at least one broker")
+	ErrNoTopic                   = errors.New("kafka options must have a topic")
+	ErrNoGroup                   = errors.New("kafka options must have a consumer group")
+	ErrInvalidPartitions         = errors.New("kafka topic must have at least one partition")
+	ErrInvalidReplicationFactor  = errors.New("kafka topic must have a replication factor of at least one")
+	ErrInvalidBackoff            = errors.New("kafka backoff minimum must be positive and at most the maximum")
+	ErrInvalidMaxDeliveries      = errors.New("kafka events must be delivered at least once")
+	ErrAsyncWithoutDelivery      = errors.New("kafka asynchronous publishing requires a delivery callback")
+	ErrUnsupportedSASLMechanism  = errors.New("kafka sasl mechanism is not supported")
+	ErrMissingSASLCredentials    = errors.New("kafka sasl mechanism requires a username and a password")
+	ErrSASLMechanismNotCreated   = errors.New("kafka sasl mechanism could not be created")
+	ErrUnsupportedCompression    = errors.New("kafka compression codec is not supported")
+	ErrUnsupportedRequiredAcks   = errors.New("kafka required acks must be none, one or all")
+	ErrInvalidKafkaStreamOptions = errors.New("kafka stream options are invalid")
+)
+
+func DefaultOptions(topic es.Topic) Options {
+	return Options{
+		Brokers:           []string{defaultBroker},
+		Topic:             topic,
+		Group:             defaultGroup,
+		ClientID:          defaultClientID,
+		TLS:               nil,
+		SASL:              SASLOptions{Mechanism: SASLNone},
+		Compression:       0,
+		RequiredAcks:      kafka.RequireAll,
+		Async:             false,
+		OnDelivery:        nil,
+		EnsureTopic:       false,
+		Partitions:        defaultPartitions,
+		ReplicationFactor: defaultReplicationFactor,
+		DeadLetterTopic:   "",
+		BackoffMin:        defaultBackoffMin,
+		BackoffMax:        defaultBackoffMax,
+		MaxDeliveries:     defaultMaxDeliveries,
+	}
+}
+
+func (options Options) Validate() error {
+	if len(options.Brokers) == 0 {
+		return ErrNoBrokers
+	}
+
+	if options.Topic == "" {
+		return ErrNoTopic
+	}
+
+	if options.Group == "" {
+		return ErrNoGroup
+	}
+
+	if options.Partitions < 1 {
+		return ErrInvalidPartitions
+	}
+
+	if options.ReplicationFactor < 1 {
+		return ErrInvalidReplicationFactor
+	}
+
+	if options.BackoffMin <= 0 || options.BackoffMin > options.BackoffMax {
+		return ErrInvalidBackoff
+	}
+
+	if options.MaxDeliveries < 1 {
+		return ErrInvalidMaxDeliveries
+	}
+
+	// Without the callback the errors of asynchronous writes are lost
+	if options.Async && options.OnDelivery == nil {
+		return ErrAsyncWithoutDelivery
+	}
+
+	if options.Compression != 0 && options.Compression.Codec() == nil {
+		return ErrUnsupportedCompression
+	}
+
+	switch options.RequiredAcks {
+	case kafka.RequireNone, kafka.RequireOne, kafka.RequireAll:
+	default:
+		return ErrUnsupportedRequiredAcks
+	}
+
+	_, err := options.saslMechanism()
+
+	return err
+}
+
+func (options Options) saslMechanism() (sasl.Mechanism, error) {
+	if options.SASL.Mechanism == SASLNone {
+		return nil, nil
+	}
+
+	if options.SASL.Username == "" || options.SASL.Password == "" {
+		return nil, ErrMissingSASLCredentials
+	}
+
+	var (
+		mechanism sasl.Mechanism
+		err       error
+	)
+
+	switch options.SASL.Mechanism {
+	case SASLPlain:
+		mechanism = plain.Mechanism{
+			Username: options.SASL.Username,
+			Password: options.SASL.Password,
+		}
+	case SASLScramSHA256:
+		mechanism, err = scram.Mechanism(scram.SHA256, options.SASL.Username, options.SASL.Password)
+	case SASLScramSHA512:
+		mechanism, err = scram.Mechanism(scram.SHA512, options.SASL.Username, options.SASL.Password)
+	default:
+		return nil, ErrUnsupportedSASLMechanism
+	}
+
+	return mechanism, errors.Wrap(err, ErrSASLMechanismNotCreated.Error())
+}
+
+func (options Options) dialer() (*kafka.Dialer, error) {
+	mechanism, err := options.saslMechanism()
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Dialer{
+		ClientID:      options.ClientID,
+		Timeout:       defaultDialTimeout,
+		DualStack:     true,
+		TLS:           options.TLS,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+func (options Options) transport() (*kafka.Transport, error) {
+	mechanism, err := options.saslMechanism()
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Transport{
+		ClientID:    options.ClientID,
+		DialTimeout: defaultDialTimeout,
+		TLS:         options.TLS,
+		SASL:        mechanism,
+	}, nil
+}
@@ -0,0 +1,68 @@
+package kafka
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	ErrCouldNotConnectToBrokers   = errors.New("kafka could not connect to any of the brokers")
+	ErrCouldNotFindController     = errors.New("kafka could not find the cluster controller")
+	ErrCouldNotConnectToControler = errors.New("kafka could not connect to the cluster controller")
+	ErrCouldNotCreateTopic        = errors.New("kafka could not create the topic")
+)
+
+// ensureTopic creates the topic of the stream if it does not
+// exist already. Topics can only be created by the controller
+// of the cluster, so we first ask any of the brokers for it.
+func (stream *Stream) ensureTopic(ctx context.Context) error {
+	conn, err := stream.dialAnyBroker(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	controller, err := conn.Controller()
+	if err != nil {
+		return errors.Wrap(err, ErrCouldNotFindController.Error())
+	}
+
+	controllerConn, err := stream.dialer.DialContext(
+		ctx,
+		"tcp",
+		net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)),
+	)
+	if err != nil {
+		return errors.Wrap(err, ErrCouldNotConnectToControler.Error())
+	}
+	defer controllerConn.Close()
+
+	// Creating a topic which already exists has no effect
+	return errors.Wrap(
+		controllerConn.CreateTopics(kafka.TopicConfig{
+			Topic:             string(stream.options.Topic),
+			NumPartitions:     stream.options.Partitions,
+			ReplicationFactor: stream.options.ReplicationFactor,
+		}),
+		ErrCouldNotCreateTopic.Error(),
+	)
+}
+
+func (stream *Stream) dialAnyBroker(ctx context.Context) (*kafka.Conn, error) {
+	var lastErr error
+
+	for _, broker := range stream.options.Brokers {
+		conn, err := stream.dialer.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn, nil
+		}
+
+		lastErr = err
+	}
+
+	return nil, errors.Wrap(lastErr, ErrCouldNotConnectToBrokers.Error())
+}
@@ -0,0 +1,128 @@
+package mediator
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+)
+
+type (
+	Request  interface{}
+	Response interface{}
+
+	// RequestHandler handles the requests of a single type.
+	RequestHandler func(ctx context.Context, request Request) (Response, error)
+	// Behaviour wraps the handling of every request sent through the bus.
+	// It must call next to continue handling the request.
+	Behaviour func(ctx context.Context, request Request, next RequestHandler) (Response, error)
+)
+
+// Validator is implemented by requests which can be validated by the ValidationBehaviour.
+type Validator interface {
+	Validate() error
+}
+
+// Bus dispatches commands and queries to exactly one handler,
+// which is registered by the type of the request. The behaviours
+// form a pipeline around the handler in the order they are used.
+// It is safe for concurrent use.
+type Bus struct {
+	lock       sync.RWMutex
+	handlers   map[reflect.Type]RequestHandler
+	behaviours []Behaviour
+}
+
+var (
+	ErrHandlerNotFound          = errors.New("mediator has no handler for the request")
+	ErrHandlerAlreadyRegistered = errors.New("mediator already has a handler for the request")
+	ErrInvalidRequest           = errors.New("mediator request is invalid")
+	ErrNilRequest               = errors.New("mediator request cannot be nil")
+)
+
+func CreateBus() *Bus {
+	return &Bus{
+		lock:       sync.RWMutex{},
+		handlers:   make(map[reflect.Type]RequestHandler),
+		behaviours: make([]Behaviour, 0),
+	}
+}
+
+// Register registers the handler for requests of the same type as the given request.
+func (bus *Bus) Register(request Request, handler RequestHandler) error {
+	if request == nil {
+		return ErrNilRequest
+	}
+
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	requestType := reflect.TypeOf(request)
+	if _, found := bus.handlers[requestType]; found {
+		return errors.Wrap(ErrHandlerAlreadyRegistered, requestType.String())
+	}
+
+	bus.handlers[requestType] = handler
+
+	return nil
+}
+
+// Use appends the behaviours to the pipeline. The first
+// behaviour used is the outermost one in the pipeline.
+func (bus *Bus) Use(behaviours ...Behaviour) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	bus.behaviours = append(bus.behaviours, behaviours...)
+}
+
+// Send handles the request through the pipeline and returns the response of the handler.
+func (bus *Bus) Send(ctx context.Context, request Request) (Response, error) {
+	if request == nil {
+		return nil, ErrNilRequest
+	}
+
+	bus.lock.RLock()
+	handler, found := bus.handlers[reflect.TypeOf(request)]
+	behaviours := bus.behaviours
+	bus.lock.RUnlock()
+
+	if !found {
+		return nil, errors.Wrap(ErrHandlerNotFound, reflect.TypeOf(request).String())
+	}
+
+	pipeline := handler
+
+	for idx := len(behaviours) - 1; idx >= 0; idx-- {
+		behaviour := behaviours[idx]
+		next := pipeline
+		pipeline = func(ctx context.Context, request Request) (Response, error) {
+			return behaviour(ctx, request, next)
+		}
+	}
+
+	return pipeline(ctx, request)
+}
+
+// ValidationBehaviour rejects requests which implement Validator and are invalid.
+func ValidationBehaviour(ctx context.Context, request Request, next RequestHandler) (Response, error) {
+	if validator, ok := request.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			// Marked such that callers can map it to a client error
+			return nil, errors.Mark(errors.Wrap(err, ErrInvalidRequest.Error()), ErrInvalidRequest)
+		}
+	}
+
+	return next(ctx, request)
+}
+
+// RequestName is the name of the type of the request, which is used by behaviours such as tracing.
+func RequestName(request Request) string {
+	requestType := reflect.TypeOf(request)
+	for requestType.Kind() == reflect.Ptr {
+		requestType = requestType.Elem()
+	}
+
+	return requestType.Name()
+}
@@ -0,0 +1,193 @@
+package mediator
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+var (
+	ErrConnectorQueueFull = errors.New("mediator connector queue is full")
+	ErrPublishTimedOut    = errors.New("mediator timed out waiting for room in the connector queue")
+	ErrMediatorClosed     = errors.New("mediator is closed")
+)
+
+// workerPool sends the queued results to the connectors. A connector is
+// scheduled on at most one worker at a time, which keeps its results in order.
+// The workers never wait for a connector. When it is not ready the connector
+// is parked until the result is received and then it is scheduled again,
+// meanwhile its queue fills according to the overflow policy.
+type workerPool struct {
+	lock    sync.Mutex
+	ready   *sync.Cond
+	pending []*connectorEntry
+	stopped chan struct{}
+	closed  bool
+	workers sync.WaitGroup
+}
+
+func createWorkerPool(workers int) *workerPool {
+	pool := &workerPool{
+		lock:    sync.Mutex{},
+		ready:   nil,
+		pending: nil,
+		stopped: make(chan struct{}),
+		closed:  false,
+		workers: sync.WaitGroup{},
+	}
+	pool.ready = sync.NewCond(&pool.lock)
+
+	pool.workers.Add(workers)
+
+	for worker := 0; worker < workers; worker++ {
+		go pool.run()
+	}
+
+	return pool
+}
+
+func (pool *workerPool) schedule(entry *connectorEntry) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	pool.pending = append(pool.pending, entry)
+	pool.ready.Signal()
+}
+
+func (pool *workerPool) next() (*connectorEntry, bool) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	for len(pool.pending) == 0 && !pool.closed {
+		pool.ready.Wait()
+	}
+
+	if pool.closed {
+		return nil, false
+	}
+
+	entry := pool.pending[0]
+	pool.pending = pool.pending[1:]
+
+	return entry, true
+}
+
+func (pool *workerPool) run() {
+	defer pool.workers.Done()
+
+	for {
+		entry, ok := pool.next()
+		if !ok {
+			return
+		}
+
+		pool.drain(entry)
+	}
+}
+
+func (pool *workerPool) drain(entry *connectorEntry) {
+	for {
+		select {
+		case result := <-entry.queue:
+			if !entry.trySend(result) {
+				pool.park(entry, result)
+
+				return
+			}
+		default:
+			atomic.StoreInt32(&entry.scheduled, 0)
+
+			// A result may have been queued after the queue was
+			// found empty, but before the connector was unscheduled
+			if len(entry.queue) > 0 && atomic.CompareAndSwapInt32(&entry.scheduled, 0, 1) {
+				continue
+			}
+
+			return
+		}
+	}
+}
+
+// park waits for the connector to receive the result without holding a worker.
+// The connector stays scheduled while parked, hence it is not drained by others.
+func (pool *workerPool) park(entry *connectorEntry, result ConnectorResult) {
+	// The calling worker is counted, hence the wait group cannot be waited on already
+	pool.workers.Add(1)
+
+	go func() {
+		defer pool.workers.Done()
+
+		entry.send(result, pool.stopped)
+
+		select {
+		case <-pool.stopped:
+		default:
+			pool.schedule(entry)
+		}
+	}()
+}
+
+// close stops the workers, and the results which are still queued are dropped.
+func (pool *workerPool) close() {
+	pool.lock.Lock()
+	if !pool.closed {
+		pool.closed = true
+		close(pool.stopped)
+		pool.ready.Broadcast()
+	}
+	pool.lock.Unlock()
+
+	pool.workers.Wait()
+}
+
+// enqueue queues the result for the connector according to the overflow
+// policy and schedules the connector if it is not scheduled already.
+func (mediator *Mediator) enqueue(entry *connectorEntry, result ConnectorResult) error {
+	select {
+	case <-mediator.pool.stopped:
+		return ErrMediatorClosed
+	default:
+	}
+
+	switch mediator.options.Overflow {
+	case OverflowError:
+		select {
+		case entry.queue <- result:
+		default:
+			return ErrConnectorQueueFull
+		}
+	case OverflowDropOldest:
+		for queued := false; !queued; {
+			select {
+			case entry.queue <- result:
+				queued = true
+			default:
+				select {
+				case <-entry.queue:
+				default:
+				}
+			}
+		}
+	case OverflowBlock:
+		timer := time.NewTimer(mediator.options.BlockTimeout)
+		defer timer.Stop()
+
+		select {
+		case entry.queue <- result:
+		case <-timer.C:
+			return ErrPublishTimedOut
+		case <-entry.done:
+			return nil
+		case <-mediator.pool.stopped:
+			return ErrMediatorClosed
+		}
+	}
+
+	if atomic.CompareAndSwapInt32(&entry.scheduled, 0, 1) {
+		mediator.pool.schedule(entry)
+	}
+
+	return nil
+}
@@ -1,12 +1,15 @@
 package mediator
 
 import (
+	"sync"
+
+	"github.com/cockroachdb/errors"
 	"github.com/hywmongous/example-service/pkg/es"
 )
 
 type (
-	Subscription func(subject es.SubjectID, data es.Data)
-	Connector    chan ConnectorResult
+	Receiver  func(subject es.SubjectID, data es.Data) error
+	Connector chan ConnectorResult
 )
 
 type ConnectorResult struct {
@@ -14,58 +17,154 @@ type ConnectorResult struct {
 	Data    es.Data
 }
 
+type receiverEntry struct {
+	id       uint64
+	receiver Receiver
+	policy   FailurePolicy
+}
+
+// connectorEntry owns the channel of a connector. The lock guards closing
+// the channel, such that it is never closed while a result is sent to it.
+type connectorEntry struct {
+	id        uint64
+	connector Connector
+	done      chan struct{}
+	lock      sync.RWMutex
+	closed    bool
+
+	// Only used when dispatching asynchronously
+	queue     chan ConnectorResult
+	scheduled int32
+}
+
+// The mediator is safe for concurrent use. Publishing does not hold
+// the lock while calling the receivers and sending to the connectors,
+// so receivers may listen and cancel subscriptions themselves.
 type Mediator struct {
-	connectors          map[es.Topic][]Connector
-	universalConnectors []Connector
-	receivers           map[es.Topic][]Subscription
-	universalReceivers  []Subscription
+	options Options
+	pool    *workerPool
+
+	lock                sync.RWMutex
+	nextID              uint64
+	connectors          map[es.Topic][]*connectorEntry
+	universalConnectors []*connectorEntry
+	receivers           map[es.Topic][]receiverEntry
+	universalReceivers  []receiverEntry
 }
 
+var ErrPublishFailed = errors.New("mediator failed publishing")
+
+// Create returns a mediator which dispatches synchronously.
 func Create() *Mediator {
-	return &Mediator{
-		connectors:          make(map[es.Topic][]Connector),
-		universalConnectors: make([]Connector, 0),
-		receivers:           make(map[es.Topic][]Subscription),
-		universalReceivers:  make([]Subscription, 0),
+	mediator, _ := CreateWithOptions(DefaultOptions())
+
+	return mediator
+}
+
+// CreateWithOptions returns a mediator with the options. When dispatching
+// asynchronously it must be closed to stop the workers.
+func CreateWithOptions(options Options) (*Mediator, error) {
+	if err := options.Validate(); err != nil {
+		return nil, errors.Wrap(err, ErrInvalidMediatorOptions.Error())
+	}
+
+	var pool *workerPool
+	if options.Mode == DispatchAsync {
+		pool = createWorkerPool(options.Workers)
 	}
+
+	return &Mediator{
+		options:             options,
+		pool:                pool,
+		lock:                sync.RWMutex{},
+		nextID:              0,
+		connectors:          make(map[es.Topic][]*connectorEntry),
+		universalConnectors: make([]*connectorEntry, 0),
+		receivers:           make(map[es.Topic][]receiverEntry),
+		universalReceivers:  make([]receiverEntry, 0),
+	}, nil
 }
 
-func createConnector() Connector {
-	return make(Connector)
+// Close stops the workers of an asynchronous mediator.
+// The results which are still queued are dropped.
+func (mediator *Mediator) Close() {
+	if mediator.pool != nil {
+		mediator.pool.close()
+	}
 }
 
-func (mediator *Mediator) ListenTo(topic es.Topic, receiver Subscription) {
-	if _, ok := mediator.receivers[topic]; !ok {
-		mediator.receivers[topic] = make([]Subscription, 0)
+func (mediator *Mediator) createConnector(id uint64) *connectorEntry {
+	var queue chan ConnectorResult
+	if mediator.options.Mode == DispatchAsync {
+		queue = make(chan ConnectorResult, mediator.options.QueueSize)
 	}
 
-	mediator.receivers[topic] = append(mediator.receivers[topic], receiver)
+	return &connectorEntry{
+		id:        id,
+		connector: make(Connector),
+		done:      make(chan struct{}),
+		lock:      sync.RWMutex{},
+		closed:    false,
+		queue:     queue,
+		scheduled: 0,
+	}
 }
 
-func (mediator *Mediator) Listen(receiver Subscription) {
-	mediator.universalReceivers = append(mediator.universalReceivers, receiver)
+func (mediator *Mediator) ListenTo(topic es.Topic, receiver Receiver, policy FailurePolicy) *Subscription {
+	mediator.lock.Lock()
+	defer mediator.lock.Unlock()
+
+	entry := receiverEntry{id: mediator.createID(), receiver: receiver, policy: policy}
+	mediator.receivers[topic] = append(mediator.receivers[topic], entry)
+
+	return mediator.createSubscription(func() {
+		mediator.receivers[topic] = removeReceiver(mediator.receivers[topic], entry.id)
+	})
 }
 
-func (mediator *Mediator) ChannelTo(topic es.Topic) Connector {
-	channel := createConnector()
+func (mediator *Mediator) Listen(receiver Receiver, policy FailurePolicy) *Subscription {
+	mediator.lock.Lock()
+	defer mediator.lock.Unlock()
 
-	if _, ok := mediator.connectors[topic]; !ok {
-		mediator.connectors[topic] = make([]Connector, 0)
-	}
+	entry := receiverEntry{id: mediator.createID(), receiver: receiver, policy: policy}
+	mediator.universalReceivers = append(mediator.universalReceivers, entry)
 
-	mediator.connectors[topic] = append(mediator.connectors[topic], channel)
+	return mediator.createSubscription(func() {
+		mediator.universalReceivers = removeReceiver(mediator.universalReceivers, entry.id)
+	})
+}
+
+func (mediator *Mediator) ChannelTo(topic es.Topic) (Connector, *Subscription) {
+	mediator.lock.Lock()
+	defer mediator.lock.Unlock()
+
+	entry := mediator.createConnector(mediator.createID())
+	mediator.connectors[topic] = append(mediator.connectors[topic], entry)
 
-	return channel
+	return entry.connector, mediator.createSubscription(func() {
+		mediator.connectors[topic] = removeConnector(mediator.connectors[topic], entry.id)
+		entry.close()
+	})
 }
 
-func (mediator *Mediator) Channel() Connector {
-	channel := createConnector()
-	mediator.universalConnectors = append(mediator.universalConnectors, channel)
+func (mediator *Mediator) Channel() (Connector, *Subscription) {
+	mediator.lock.Lock()
+	defer mediator.lock.Unlock()
 
-	return channel
+	entry := mediator.createConnector(mediator.createID())
+	mediator.universalConnectors = append(mediator.universalConnectors, entry)
+
+	return entry.connector, mediator.createSubscription(func() {
+		mediator.universalConnectors = removeConnector(mediator.universalConnectors, entry.id)
+		entry.close()
+	})
 }
 
-func (mediator *Mediator) Publish(subject es.SubjectID, data es.Data) {
+// Publish calls the receivers and then dispatches to the connectors.
+// Receivers are always called by the publisher, regardless of the dispatch mode.
+// The errors of the receivers are handled by their failure policies, and the
+// errors which are reported are combined with those of overflowing queues.
+func (mediator *Mediator) Publish(subject es.SubjectID, data es.Data) error {
 	connectorResult := ConnectorResult{
 		Subject: subject,
 		Data:    data,
@@ -73,19 +172,115 @@ func (mediator *Mediator) Publish(subject es.SubjectID, data es.Data) {
 
 	topic := es.CreateTopicForData(data)
 
-	for _, receiver := range mediator.receivers[topic] {
-		receiver(subject, data)
+	mediator.lock.RLock()
+	receivers := make([]receiverEntry, 0, len(mediator.receivers[topic])+len(mediator.universalReceivers))
+	receivers = append(receivers, mediator.receivers[topic]...)
+	receivers = append(receivers, mediator.universalReceivers...)
+	connectors := make([]*connectorEntry, 0, len(mediator.connectors[topic])+len(mediator.universalConnectors))
+	connectors = append(connectors, mediator.connectors[topic]...)
+	connectors = append(connectors, mediator.universalConnectors...)
+	mediator.lock.RUnlock()
+
+	var err error
+
+	for _, entry := range receivers {
+		receiverErr, stop := entry.policy.receive(entry.receiver, subject, data)
+		err = errors.CombineErrors(err, receiverErr)
+
+		if stop {
+			return errors.Wrap(err, ErrPublishFailed.Error())
+		}
+	}
+
+	for _, entry := range connectors {
+		if mediator.options.Mode == DispatchSync {
+			entry.send(connectorResult, nil)
+		} else {
+			err = errors.CombineErrors(err, mediator.enqueue(entry, connectorResult))
+		}
+	}
+
+	return errors.Wrap(err, ErrPublishFailed.Error())
+}
+
+// createID must be called while holding the lock.
+func (mediator *Mediator) createID() uint64 {
+	mediator.nextID++
+
+	return mediator.nextID
+}
+
+// send blocks until the result is received, the connector
+// is cancelled or the mediator is stopped.
+func (entry *connectorEntry) send(result ConnectorResult, stopped chan struct{}) {
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
+
+	if entry.closed {
+		return
 	}
 
-	for _, connector := range mediator.connectors[topic] {
-		connector <- connectorResult
+	select {
+	case entry.connector <- result:
+	case <-entry.done:
+	case <-stopped:
 	}
+}
+
+// trySend sends the result if the connector is ready to receive it, and
+// reports whether the result is handled, which it also is for cancelled connectors.
+func (entry *connectorEntry) trySend(result ConnectorResult) bool {
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
 
-	for _, receiver := range mediator.universalReceivers {
-		receiver(subject, data)
+	if entry.closed {
+		return true
 	}
 
-	for _, connector := range mediator.universalConnectors {
-		connector <- connectorResult
+	select {
+	case entry.connector <- result:
+		return true
+	case <-entry.done:
+		return true
+	default:
+		return false
 	}
 }
+
+// close unblocks the pending sends and then closes the channel,
+// such that the readers of the connector can range over it.
+func (entry *connectorEntry) close() {
+	close(entry.done)
+
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+
+	entry.closed = true
+	close(entry.connector)
+}
+
+// The slices are copied rather than modified in place
+// because Publish may be iterating over the current ones.
+func removeReceiver(entries []receiverEntry, id uint64) []receiverEntry {
+	remaining := make([]receiverEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.id != id {
+			remaining = append(remaining, entry)
+		}
+	}
+
+	return remaining
+}
+
+func removeConnector(entries []*connectorEntry, id uint64) []*connectorEntry {
+	remaining := make([]*connectorEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.id != id {
+			remaining = append(remaining, entry)
+		}
+	}
+
+	return remaining
+}
@@ -0,0 +1,288 @@
+package mediator_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+)
+
+type Deposited struct {
+	Amount int
+}
+
+const (
+	subject = es.SubjectID("subject")
+	timeout = time.Second
+)
+
+func createAsyncMediator(t *testing.T, overflow mediator.OverflowPolicy) *mediator.Mediator {
+	t.Helper()
+
+	options := mediator.DefaultOptions()
+	options.Mode = mediator.DispatchAsync
+	options.QueueSize = 1
+	options.Overflow = overflow
+
+	instance, err := mediator.CreateWithOptions(options)
+	if err != nil {
+		t.Fatal("CreateWithOptions failed with err:", err)
+	}
+
+	return instance
+}
+
+func TestCancelClosesConnector(t *testing.T) {
+	t.Parallel()
+
+	instance := mediator.Create()
+	connector, subscription := instance.Channel()
+
+	// The publisher is blocked until the connector is cancelled
+	published := make(chan error)
+
+	go func() {
+		published <- instance.Publish(subject, Deposited{Amount: 1})
+	}()
+
+	subscription.Cancel()
+
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Error("Publish failed with err:", err)
+		}
+	case <-time.After(timeout):
+		t.Fatal("Publish was not unblocked by cancelling the connector")
+	}
+
+	if _, ok := <-connector; ok {
+		t.Error("expected the connector to be closed")
+	}
+}
+
+func TestAsyncReceiversRunInline(t *testing.T) {
+	t.Parallel()
+
+	instance := createAsyncMediator(t, mediator.OverflowError)
+	defer instance.Close()
+
+	received := 0
+
+	instance.Listen(func(subject es.SubjectID, data es.Data) error {
+		received++
+
+		return nil
+	}, mediator.StopOnFailure())
+
+	if err := instance.Publish(subject, Deposited{Amount: 1}); err != nil {
+		t.Fatal("Publish failed with err:", err)
+	}
+
+	if received != 1 {
+		t.Error("expected the receiver to be called before Publish returned")
+	}
+}
+
+func TestAsyncOverflowError(t *testing.T) {
+	t.Parallel()
+
+	instance := createAsyncMediator(t, mediator.OverflowError)
+	defer instance.Close()
+
+	// Nobody reads the connector, so one result is held while the
+	// connector is parked and the next one fills the queue
+	instance.Channel()
+
+	var err error
+	for amount := 0; amount < 3 && err == nil; amount++ {
+		err = instance.Publish(subject, Deposited{Amount: amount})
+	}
+
+	if !errors.Is(err, mediator.ErrConnectorQueueFull) {
+		t.Error("expected the queue to be full but got", err)
+	}
+}
+
+func TestAsyncOverflowDropOldest(t *testing.T) {
+	t.Parallel()
+
+	instance := createAsyncMediator(t, mediator.OverflowDropOldest)
+	defer instance.Close()
+
+	connector, _ := instance.Channel()
+
+	for amount := 0; amount < 10; amount++ {
+		if err := instance.Publish(subject, Deposited{Amount: amount}); err != nil {
+			t.Fatal("Publish failed with err:", err)
+		}
+	}
+
+	// The latest result is never dropped
+	for {
+		select {
+		case result := <-connector:
+			if deposit, ok := result.Data.(Deposited); ok && deposit.Amount == 9 {
+				return
+			}
+		case <-time.After(timeout):
+			t.Fatal("the latest result was not received")
+		}
+	}
+}
+
+func TestAsyncStalledConnectorsDoNotBlockOthers(t *testing.T) {
+	t.Parallel()
+
+	options := mediator.DefaultOptions()
+	options.Mode = mediator.DispatchAsync
+	options.Workers = 1
+	options.Overflow = mediator.OverflowDropOldest
+
+	instance, err := mediator.CreateWithOptions(options)
+	if err != nil {
+		t.Fatal("CreateWithOptions failed with err:", err)
+	}
+	defer instance.Close()
+
+	// Nobody reads these connectors
+	for stalled := 0; stalled < 3; stalled++ {
+		instance.Channel()
+	}
+
+	connector, _ := instance.Channel()
+
+	for amount := 0; amount < 3; amount++ {
+		if err := instance.Publish(subject, Deposited{Amount: amount}); err != nil {
+			t.Fatal("Publish failed with err:", err)
+		}
+
+		select {
+		case <-connector:
+		case <-time.After(timeout):
+			t.Fatal("the result was not received while the other connectors are stalled")
+		}
+	}
+}
+
+func TestFailurePolicies(t *testing.T) {
+	t.Parallel()
+
+	errFailed := errors.New("receiver failed")
+	failing := func(subject es.SubjectID, data es.Data) error {
+		return errFailed
+	}
+
+	instance := mediator.Create()
+
+	var deadLetters, calls int
+
+	instance.Listen(failing, mediator.DeadLetterOnFailure(func(subject es.SubjectID, data es.Data, err error) error {
+		deadLetters++
+
+		return nil
+	}))
+	instance.Listen(failing, mediator.ContinueOnFailure())
+	instance.Listen(failing, mediator.RetryOnFailure(2, 0))
+	instance.Listen(func(subject es.SubjectID, data es.Data) error {
+		calls++
+
+		return nil
+	}, mediator.StopOnFailure())
+
+	err := instance.Publish(subject, Deposited{Amount: 1})
+	if !errors.Is(err, errFailed) {
+		t.Error("expected the error of the receivers but got", err)
+	}
+
+	if deadLetters != 1 {
+		t.Error("expected the failure to be dead lettered once but got", deadLetters)
+	}
+
+	if calls != 0 {
+		t.Error("expected the retried receiver to stop publishing")
+	}
+}
+
+func TestZeroFailurePolicyStopsOnFailure(t *testing.T) {
+	t.Parallel()
+
+	errFailed := errors.New("receiver failed")
+	instance := mediator.Create()
+
+	var calls int
+
+	instance.Listen(func(subject es.SubjectID, data es.Data) error {
+		calls++
+
+		return errFailed
+	}, mediator.FailurePolicy{})
+
+	if err := instance.Publish(subject, Deposited{Amount: 1}); !errors.Is(err, errFailed) {
+		t.Error("expected the error of the receiver but got", err)
+	}
+
+	if calls != 1 {
+		t.Error("expected the receiver to be called once but got", calls)
+	}
+}
+
+type Deposit struct {
+	Amount int
+}
+
+func (deposit *Deposit) Validate() error {
+	if deposit.Amount <= 0 {
+		return errors.New("deposits must be positive")
+	}
+
+	return nil
+}
+
+func TestBusPipeline(t *testing.T) {
+	t.Parallel()
+
+	bus := mediator.CreateBus()
+
+	var order []string
+
+	trace := func(name string) mediator.Behaviour {
+		return func(ctx context.Context, request mediator.Request, next mediator.RequestHandler) (mediator.Response, error) {
+			order = append(order, name)
+
+			return next(ctx, request)
+		}
+	}
+
+	bus.Use(trace("outer"), mediator.ValidationBehaviour, trace("inner"))
+
+	err := bus.Register(&Deposit{}, func(ctx context.Context, request mediator.Request) (mediator.Response, error) {
+		order = append(order, "handler")
+
+		return request.(*Deposit).Amount * 2, nil
+	})
+	if err != nil {
+		t.Fatal("Register failed with err:", err)
+	}
+
+	response, err := bus.Send(context.Background(), &Deposit{Amount: 21})
+	if err != nil || response != 42 {
+		t.Error("expected the response of the handler but got", response, err)
+	}
+
+	if strings.Join(order, ",") != "outer,inner,handler" {
+		t.Error("the behaviours wrapped the handler in the wrong order", order)
+	}
+
+	if _, err := bus.Send(context.Background(), &Deposit{Amount: -1}); !errors.Is(err, mediator.ErrInvalidRequest) {
+		t.Error("expected the request to be invalid but got", err)
+	}
+
+	if _, err := bus.Send(context.Background(), Deposited{Amount: 1}); !errors.Is(err, mediator.ErrHandlerNotFound) {
+		t.Error("expected no handler to be found but got", err)
+	}
+}
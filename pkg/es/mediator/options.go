@@ -0,0 +1,94 @@
+package mediator
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+type (
+	DispatchMode   int
+	OverflowPolicy int
+)
+
+const (
+	// Publishing sends to the connectors and waits for them to receive.
+	DispatchSync DispatchMode = iota
+	// Publishing queues the results of each connector, and a pool of
+	// workers sends them. Receivers are still called by the publisher.
+	DispatchAsync
+)
+
+const (
+	// Publishing waits for room in the queue until the timeout.
+	OverflowBlock OverflowPolicy = iota
+	// The oldest result in the queue is dropped to make room.
+	OverflowDropOldest
+	// Publishing fails immediately when the queue is full.
+	OverflowError
+)
+
+type Options struct {
+	Mode DispatchMode
+	// The capacity of the queue of each connector
+	QueueSize int
+	// The number of workers which send the queued results to the connectors
+	Workers      int
+	Overflow     OverflowPolicy
+	BlockTimeout time.Duration
+}
+
+const (
+	defaultQueueSize    = 64
+	defaultWorkers      = 4
+	defaultBlockTimeout = 5 * time.Second
+)
+
+var (
+	ErrInvalidQueueSize        = errors.New("mediator queue size must be at least one")
+	ErrInvalidWorkers          = errors.New("mediator must have at least one worker")
+	ErrInvalidBlockTimeout     = errors.New("mediator block timeout must be positive")
+	ErrUnsupportedOverflow     = errors.New("mediator overflow policy is not supported")
+	ErrUnsupportedDispatchMode = errors.New("mediator dispatch mode is not supported")
+	ErrInvalidMediatorOptions  = errors.New("mediator options are invalid")
+)
+
+func DefaultOptions() Options {
+	return Options{
+		Mode:         DispatchSync,
+		QueueSize:    defaultQueueSize,
+		Workers:      defaultWorkers,
+		Overflow:     OverflowBlock,
+		BlockTimeout: defaultBlockTimeout,
+	}
+}
+
+func (options Options) Validate() error {
+	switch options.Mode {
+	case DispatchSync:
+		return nil
+	case DispatchAsync:
+	default:
+		return ErrUnsupportedDispatchMode
+	}
+
+	if options.QueueSize < 1 {
+		return ErrInvalidQueueSize
+	}
+
+	if options.Workers < 1 {
+		return ErrInvalidWorkers
+	}
+
+	switch options.Overflow {
+	case OverflowBlock:
+		if options.BlockTimeout <= 0 {
+			return ErrInvalidBlockTimeout
+		}
+	case OverflowDropOldest, OverflowError:
+	default:
+		return ErrUnsupportedOverflow
+	}
+
+	return nil
+}
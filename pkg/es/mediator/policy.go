@@ -0,0 +1,106 @@
+package mediator
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+)
+
+type failureAction int
+
+const (
+	stopOnFailure failureAction = iota
+	continueOnFailure
+	retryOnFailure
+	deadLetterOnFailure
+)
+
+// DeadLetterHandler receives what a receiver failed handling, and the error it failed with.
+type DeadLetterHandler func(subject es.SubjectID, data es.Data, err error) error
+
+// FailurePolicy decides what Publish does when a receiver returns an error.
+// The zero value is StopOnFailure.
+type FailurePolicy struct {
+	action     failureAction
+	attempts   int
+	backoff    time.Duration
+	deadLetter DeadLetterHandler
+}
+
+var (
+	ErrReceiverFailed   = errors.New("mediator receiver failed")
+	ErrDeadLetterFailed = errors.New("mediator dead letter handler failed")
+)
+
+// StopOnFailure makes Publish return the error without calling the
+// remaining receivers and connectors. This is the policy of receivers
+// which must succeed for the event to be recorded.
+func StopOnFailure() FailurePolicy {
+	return FailurePolicy{action: stopOnFailure, attempts: 1, backoff: 0, deadLetter: nil}
+}
+
+// ContinueOnFailure makes Publish call the remaining receivers
+// and connectors, and return the error along with the other ones.
+func ContinueOnFailure() FailurePolicy {
+	return FailurePolicy{action: continueOnFailure, attempts: 1, backoff: 0, deadLetter: nil}
+}
+
+// RetryOnFailure calls the receiver up to the number of attempts
+// with the backoff between them. If it still fails Publish stops.
+func RetryOnFailure(attempts int, backoff time.Duration) FailurePolicy {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	return FailurePolicy{action: retryOnFailure, attempts: attempts, backoff: backoff, deadLetter: nil}
+}
+
+// DeadLetterOnFailure passes the failure to the handler and continues.
+// Publish only reports the failure if the handler fails as well.
+func DeadLetterOnFailure(handler DeadLetterHandler) FailurePolicy {
+	return FailurePolicy{action: deadLetterOnFailure, attempts: 1, backoff: 0, deadLetter: handler}
+}
+
+// receive calls the receiver according to the policy. It returns
+// the error to report and whether Publish must stop.
+func (policy FailurePolicy) receive(receiver Receiver, subject es.SubjectID, data es.Data) (error, bool) {
+	var err error
+
+	// The receiver is always called, even by the zero value of the policy
+	attempts := policy.attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = receiver(subject, data); err == nil {
+			return nil, false
+		}
+
+		if attempt < attempts {
+			time.Sleep(policy.backoff)
+		}
+	}
+
+	err = errors.Wrap(err, ErrReceiverFailed.Error())
+
+	switch policy.action {
+	case continueOnFailure:
+		return err, false
+	case deadLetterOnFailure:
+		if policy.deadLetter == nil {
+			return err, false
+		}
+
+		if deadLetterErr := policy.deadLetter(subject, data, err); deadLetterErr != nil {
+			return errors.CombineErrors(err, errors.Wrap(deadLetterErr, ErrDeadLetterFailed.Error())), false
+		}
+
+		return nil, false
+	case stopOnFailure, retryOnFailure:
+		return err, true
+	}
+
+	return err, true
+}
@@ -0,0 +1,31 @@
+package mediator
+
+import "sync"
+
+// Subscription is the handle of a receiver or connector.
+// Cancelling it removes the receiver or connector from the mediator,
+// and connectors are closed once the pending results are abandoned.
+type Subscription struct {
+	mediator *Mediator
+	remove   func()
+	once     sync.Once
+}
+
+// createSubscription must be called while holding the lock.
+func (mediator *Mediator) createSubscription(remove func()) *Subscription {
+	return &Subscription{
+		mediator: mediator,
+		remove:   remove,
+		once:     sync.Once{},
+	}
+}
+
+// Cancel is idempotent and safe to call from receivers.
+func (subscription *Subscription) Cancel() {
+	subscription.once.Do(func() {
+		subscription.mediator.lock.Lock()
+		defer subscription.mediator.lock.Unlock()
+
+		subscription.remove()
+	})
+}
@@ -0,0 +1,386 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+)
+
+// Broker holds the topics of the in-memory streams. Streams created with
+// the same broker see the events of each other, like the clients of a cluster.
+type Broker struct {
+	mutex  sync.Mutex
+	topics map[es.Topic]*topicLog
+}
+
+type topicLog struct {
+	events []es.Event
+	groups map[string]*groupOffsets
+	// Closed and replaced whenever the topic changes to wake up the subscribers
+	changed chan struct{}
+}
+
+type pendingDelivery struct {
+	offset  int
+	attempt int
+}
+
+type groupOffsets struct {
+	// The offset of the next event to deliver
+	next int
+	// All events before the committed offset are settled
+	committed    int
+	settled      map[int]bool
+	redeliveries []pendingDelivery
+}
+
+type subscription struct {
+	ended bool
+	// The attempt of the deliveries which are not settled yet by their offset
+	inflight map[int]int
+	// Closed when the subscription must stop because of the failure
+	stopped chan struct{}
+	failure error
+}
+
+// Options mirrors the options of the kafka stream which affect consumers.
+type Options struct {
+	Topic es.Topic
+	Group string
+	// Negatively acknowledged events are redelivered until they are
+	// delivered this many times, then they are moved to the dead letter topic.
+	// If it is empty, the subscription stops without settling the event and
+	// reports the failure, hence the next subscriber receives the event again
+	MaxDeliveries   int
+	DeadLetterTopic es.Topic
+}
+
+// Stream is an in-process es.EventStream. Every consumer group receives
+// all events of a topic from the beginning, and the subscribers of a group
+// compete for them. Like the kafka stream the offset of a group is only
+// committed once the events before it are acknowledged, hence subscribing
+// again continues with the events which were not acknowledged.
+type Stream struct {
+	broker  *Broker
+	options Options
+}
+
+const (
+	defaultGroup         = "ia"
+	defaultMaxDeliveries = 5
+)
+
+var (
+	ErrNoTopic                    = errors.New("memory stream options must have a topic")
+	ErrNoGroup                    = errors.New("memory stream options must have a consumer group")
+	ErrInvalidMaxDeliveries       = errors.New("memory stream events must be delivered at least once")
+	ErrInvalidMemoryStreamOptions = errors.New("memory stream options are invalid")
+	ErrNoDeadLetterTopic          = errors.New("memory stream subscription stopped as the failed event has no dead letter topic")
+)
+
+func CreateBroker() *Broker {
+	return &Broker{
+		mutex:  sync.Mutex{},
+		topics: make(map[es.Topic]*topicLog),
+	}
+}
+
+func DefaultOptions(topic es.Topic) Options {
+	return Options{
+		Topic:           topic,
+		Group:           defaultGroup,
+		MaxDeliveries:   defaultMaxDeliveries,
+		DeadLetterTopic: "",
+	}
+}
+
+func (options Options) Validate() error {
+	if options.Topic == "" {
+		return ErrNoTopic
+	}
+
+	if options.Group == "" {
+		return ErrNoGroup
+	}
+
+	if options.MaxDeliveries < 1 {
+		return ErrInvalidMaxDeliveries
+	}
+
+	return nil
+}
+
+func CreateMemoryStream(broker *Broker, options Options) (*Stream, error) {
+	if err := options.Validate(); err != nil {
+		return nil, errors.Wrap(err, ErrInvalidMemoryStreamOptions.Error())
+	}
+
+	return &Stream{
+		broker:  broker,
+		options: options,
+	}, nil
+}
+
+func (stream *Stream) Publish(events []es.Event) error {
+	stream.broker.mutex.Lock()
+	defer stream.broker.mutex.Unlock()
+
+	stream.broker.append(stream.options.Topic, events...)
+
+	return nil
+}
+
+// Subscribe delivers the events of the topic to the consumer group of the
+// stream until the context ends or the subscription fails, after which both
+// channels are closed. The deliveries which are not settled by then are redelivered.
+func (stream *Stream) Subscribe(ctx context.Context, topic es.Topic) (chan es.Delivery, chan error) {
+	deliveries := make(chan es.Delivery)
+	errs := make(chan error)
+
+	sub := &subscription{
+		ended:    false,
+		inflight: make(map[int]int),
+		stopped:  make(chan struct{}),
+		failure:  nil,
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(deliveries)
+		defer stream.broker.unsubscribe(topic, stream.options.Group, sub)
+
+		// The failure is set before the subscription is stopped
+		fail := func() {
+			select {
+			case errs <- sub.failure:
+			case <-ctx.Done():
+			}
+		}
+
+		for {
+			select {
+			case <-sub.stopped:
+				fail()
+
+				return
+			default:
+			}
+
+			delivery, changed, ok := stream.next(topic, sub)
+			if !ok {
+				select {
+				case <-changed:
+					continue
+				case <-sub.stopped:
+					fail()
+
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case deliveries <- delivery:
+			case <-sub.stopped:
+				fail()
+
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return deliveries, errs
+}
+
+// Events returns the events of the topic. It is meant for inspecting
+// topics in tests, for instance the dead letter topic.
+func (broker *Broker) Events(topic es.Topic) []es.Event {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	log := broker.topic(topic)
+	events := make([]es.Event, len(log.events))
+	copy(events, log.events)
+
+	return events
+}
+
+// Reset makes the consumer group replay the topic from the beginning.
+// The group is not expected to have any subscribers while it is reset.
+func (broker *Broker) Reset(topic es.Topic, group string) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	log := broker.topic(topic)
+	log.groups[group] = createGroupOffsets()
+	log.notify()
+}
+
+func (stream *Stream) next(topic es.Topic, sub *subscription) (es.Delivery, chan struct{}, bool) {
+	stream.broker.mutex.Lock()
+	defer stream.broker.mutex.Unlock()
+
+	log := stream.broker.topic(topic)
+	group := log.group(stream.options.Group)
+
+	var pending pendingDelivery
+
+	switch {
+	case len(group.redeliveries) > 0:
+		pending = group.redeliveries[0]
+		group.redeliveries = group.redeliveries[1:]
+	case group.next < len(log.events):
+		pending = pendingDelivery{offset: group.next, attempt: 1}
+		group.next++
+	default:
+		return es.Delivery{}, log.changed, false
+	}
+
+	sub.inflight[pending.offset] = pending.attempt
+
+	settle := func(err error) {
+		stream.settle(topic, sub, pending, err)
+	}
+
+	return es.CreateDelivery(
+		log.events[pending.offset],
+		pending.attempt,
+		func() { settle(nil) },
+		settle,
+	), nil, true
+}
+
+func (stream *Stream) settle(topic es.Topic, sub *subscription, pending pendingDelivery, err error) {
+	stream.broker.mutex.Lock()
+	defer stream.broker.mutex.Unlock()
+
+	// Deliveries of ended subscriptions are already queued for redelivery
+	if sub.ended || sub.inflight[pending.offset] != pending.attempt {
+		return
+	}
+
+	delete(sub.inflight, pending.offset)
+
+	log := stream.broker.topic(topic)
+	group := log.group(stream.options.Group)
+
+	if err != nil {
+		if pending.attempt < stream.options.MaxDeliveries {
+			group.redeliveries = append(group.redeliveries, pendingDelivery{
+				offset:  pending.offset,
+				attempt: pending.attempt + 1,
+			})
+			log.notify()
+
+			return
+		}
+
+		// Like the kafka stream the event is not settled without a dead letter topic
+		if stream.options.DeadLetterTopic == "" {
+			sub.inflight[pending.offset] = pending.attempt
+			sub.stop(errors.Mark(errors.Wrap(err, ErrNoDeadLetterTopic.Error()), ErrNoDeadLetterTopic))
+
+			return
+		}
+
+		stream.broker.append(stream.options.DeadLetterTopic, log.events[pending.offset])
+	}
+
+	group.settled[pending.offset] = true
+	for group.settled[group.committed] {
+		delete(group.settled, group.committed)
+		group.committed++
+	}
+}
+
+// stop must be called while holding the lock of the broker.
+func (sub *subscription) stop(failure error) {
+	if sub.failure != nil {
+		return
+	}
+
+	sub.failure = failure
+	close(sub.stopped)
+}
+
+func (broker *Broker) unsubscribe(topic es.Topic, groupName string, sub *subscription) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	sub.ended = true
+
+	if len(sub.inflight) == 0 {
+		return
+	}
+
+	log := broker.topic(topic)
+	group := log.group(groupName)
+
+	offsets := make([]int, 0, len(sub.inflight))
+	for offset := range sub.inflight {
+		offsets = append(offsets, offset)
+	}
+
+	sort.Ints(offsets)
+
+	for _, offset := range offsets {
+		group.redeliveries = append(group.redeliveries, pendingDelivery{
+			offset:  offset,
+			attempt: sub.inflight[offset],
+		})
+	}
+
+	log.notify()
+}
+
+// append must be called while holding the lock of the broker.
+func (broker *Broker) append(topic es.Topic, events ...es.Event) {
+	log := broker.topic(topic)
+	log.events = append(log.events, events...)
+	log.notify()
+}
+
+// topic must be called while holding the lock of the broker.
+func (broker *Broker) topic(topic es.Topic) *topicLog {
+	log, found := broker.topics[topic]
+	if !found {
+		log = &topicLog{
+			events:  nil,
+			groups:  make(map[string]*groupOffsets),
+			changed: make(chan struct{}),
+		}
+		broker.topics[topic] = log
+	}
+
+	return log
+}
+
+func (log *topicLog) group(group string) *groupOffsets {
+	offsets, found := log.groups[group]
+	if !found {
+		offsets = createGroupOffsets()
+		log.groups[group] = offsets
+	}
+
+	return offsets
+}
+
+func (log *topicLog) notify() {
+	close(log.changed)
+	log.changed = make(chan struct{})
+}
+
+func createGroupOffsets() *groupOffsets {
+	return &groupOffsets{
+		next:         0,
+		committed:    0,
+		settled:      make(map[int]bool),
+		redeliveries: nil,
+	}
+}
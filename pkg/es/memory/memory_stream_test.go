@@ -0,0 +1,176 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/memory"
+)
+
+const (
+	topic      = es.Topic("topic")
+	deadLetter = es.Topic("dead-letter")
+	timeout    = time.Second
+)
+
+func createStream(t *testing.T, broker *memory.Broker, group string) *memory.Stream {
+	t.Helper()
+
+	options := memory.DefaultOptions(topic)
+	options.Group = group
+	options.MaxDeliveries = 2
+	options.DeadLetterTopic = deadLetter
+
+	stream, err := memory.CreateMemoryStream(broker, options)
+	if err != nil {
+		t.Fatal("CreateMemoryStream failed with err:", err)
+	}
+
+	return stream
+}
+
+func publish(t *testing.T, stream *memory.Stream, subjects ...es.SubjectID) {
+	t.Helper()
+
+	events := make([]es.Event, len(subjects))
+	for idx, subject := range subjects {
+		events[idx] = es.Event{ID: es.Ident(subject), Subject: subject}
+	}
+
+	if err := stream.Publish(events); err != nil {
+		t.Fatal("Publish failed with err:", err)
+	}
+}
+
+func receive(t *testing.T, deliveries chan es.Delivery) es.Delivery {
+	t.Helper()
+
+	select {
+	case delivery := <-deliveries:
+		return delivery
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for a delivery")
+	}
+
+	return es.Delivery{}
+}
+
+func TestGroupsReceiveAllEvents(t *testing.T) {
+	t.Parallel()
+
+	broker := memory.CreateBroker()
+	first := createStream(t, broker, "first")
+	second := createStream(t, broker, "second")
+
+	publish(t, first, "a", "b")
+
+	for _, stream := range []*memory.Stream{first, second} {
+		ctx, cancel := context.WithCancel(context.Background())
+		deliveries, _ := stream.Subscribe(ctx, topic)
+
+		for _, expected := range []es.SubjectID{"a", "b"} {
+			delivery := receive(t, deliveries)
+			if delivery.Event.Subject != expected {
+				t.Error("expected subject", expected, "but got", delivery.Event.Subject)
+			}
+
+			delivery.Ack()
+		}
+
+		cancel()
+	}
+}
+
+func TestUnacknowledgedEventsAreRedelivered(t *testing.T) {
+	t.Parallel()
+
+	broker := memory.CreateBroker()
+	stream := createStream(t, broker, "group")
+
+	publish(t, stream, "a", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	deliveries, _ := stream.Subscribe(ctx, topic)
+
+	receive(t, deliveries).Ack()
+	// The second event is received but never settled
+	receive(t, deliveries)
+	cancel()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	deliveries, _ = stream.Subscribe(ctx, topic)
+
+	delivery := receive(t, deliveries)
+	if delivery.Event.Subject != "b" {
+		t.Error("expected the unacknowledged event but got", delivery.Event.Subject)
+	}
+}
+
+func TestNackedEventsAreDeadLettered(t *testing.T) {
+	t.Parallel()
+
+	broker := memory.CreateBroker()
+	stream := createStream(t, broker, "group")
+
+	publish(t, stream, "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deliveries, _ := stream.Subscribe(ctx, topic)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		delivery := receive(t, deliveries)
+		if delivery.Attempt != attempt {
+			t.Error("expected attempt", attempt, "but got", delivery.Attempt)
+		}
+
+		delivery.Nack(errors.New("handler failed"))
+	}
+
+	deadLetters := broker.Events(deadLetter)
+	if len(deadLetters) != 1 || deadLetters[0].Subject != "a" {
+		t.Error("expected the event in the dead letter topic but got", deadLetters)
+	}
+}
+
+func TestFailedEventsWithoutDeadLetterTopicStopTheSubscription(t *testing.T) {
+	t.Parallel()
+
+	options := memory.DefaultOptions(topic)
+	options.MaxDeliveries = 1
+
+	stream, err := memory.CreateMemoryStream(memory.CreateBroker(), options)
+	if err != nil {
+		t.Fatal("CreateMemoryStream failed with err:", err)
+	}
+
+	publish(t, stream, "a", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deliveries, errs := stream.Subscribe(ctx, topic)
+	receive(t, deliveries).Nack(errors.New("handler failed"))
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, memory.ErrNoDeadLetterTopic) {
+			t.Error("expected the subscription to stop without a dead letter topic but got", err)
+		}
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for the subscription to stop")
+	}
+
+	// The event is not settled, so the next subscription receives it again
+	deliveries, _ = stream.Subscribe(ctx, topic)
+
+	if delivery := receive(t, deliveries); delivery.Event.Subject != "a" {
+		t.Error("expected the failed event again but got", delivery.Event.Subject)
+	}
+}
@@ -0,0 +1,105 @@
+package mongo
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/projection"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CheckpointStore keeps the checkpoints of the projections in
+// the event store database, with one document per projection.
+type CheckpointStore struct {
+	uri string
+}
+
+type checkpointDocument struct {
+	Projection     string `bson:"_id"`
+	Position       uint64 `bson:"position"`
+	EventID        string `bson:"eventid"`
+	EventTimestamp int64  `bson:"eventtimestamp"`
+}
+
+const (
+	checkpointsCollection = "checkpoints"
+	defaultURI            = "mongodb://root:root@ia_mongo:27017"
+)
+
+var (
+	ErrCouldNotLoadCheckpoint = errors.New("checkpoint could not be loaded from mongo")
+	ErrCouldNotSaveCheckpoint = errors.New("checkpoint could not be saved to mongo")
+)
+
+func CreateMongoCheckpointStore() *CheckpointStore {
+	return &CheckpointStore{
+		uri: defaultURI,
+	}
+}
+
+func (store *CheckpointStore) Load(ctx context.Context, name string) (projection.Checkpoint, error) {
+	var document checkpointDocument
+
+	err := store.withCollection(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		return collection.FindOne(ctx, bson.D{{Key: documentIDKey, Value: name}}).Decode(&document)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return projection.Checkpoint{}, projection.ErrNoCheckpoint
+	}
+
+	if err != nil {
+		return projection.Checkpoint{}, errors.Wrap(err, ErrCouldNotLoadCheckpoint.Error())
+	}
+
+	return projection.Checkpoint{
+		Projection:     document.Projection,
+		Position:       projection.Position(document.Position),
+		EventID:        es.Ident(document.EventID),
+		EventTimestamp: es.Timestamp(document.EventTimestamp),
+	}, nil
+}
+
+func (store *CheckpointStore) Save(ctx context.Context, checkpoint projection.Checkpoint) error {
+	document := checkpointDocument{
+		Projection:     checkpoint.Projection,
+		Position:       uint64(checkpoint.Position),
+		EventID:        string(checkpoint.EventID),
+		EventTimestamp: int64(checkpoint.EventTimestamp),
+	}
+
+	return errors.Wrap(
+		store.withCollection(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+			_, err := collection.ReplaceOne(
+				ctx,
+				bson.D{{Key: documentIDKey, Value: checkpoint.Projection}},
+				document,
+				options.Replace().SetUpsert(true),
+			)
+
+			return err
+		}),
+		ErrCouldNotSaveCheckpoint.Error(),
+	)
+}
+
+// withCollection connects to mongo for the duration of the action,
+// in the same way as the event store does for each of its operations.
+func (store *CheckpointStore) withCollection(ctx context.Context, action mongoConnectionAction) error {
+	ctx, cancel := context.WithTimeout(ctx, timeoutDuration)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(store.uri))
+	if err != nil {
+		return errors.Wrap(err, ErrMongoClientCouldNotConnect.Error())
+	}
+
+	err = action(ctx, client.Database(databaseName).Collection(checkpointsCollection))
+
+	return errors.CombineErrors(
+		err,
+		errors.Wrap(client.Disconnect(ctx), ErrMongoClientCouldNotDisconnect.Error()),
+	)
+}
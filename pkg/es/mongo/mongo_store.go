@@ -28,10 +28,19 @@ const (
 	databaseName        = "eventstore"
 	eventsCollection    = "events"
 	snapshotsCollection = "snapshots"
+	countersCollection  = "counters"
+
+	// A sequence is inserted within the timeout of the connection which reserved it,
+	// hence the gaps in the sequences which are older than this are events which
+	// failed shipping, rather than events which are still being inserted.
+	sequenceGapTimeout = 3 * timeoutDuration
 )
 
 const (
 	documentIDKey = "_id"
+	// The sequence of the event in the log of its producer and when it was reserved
+	sequenceKey = "seq"
+	shippedKey  = "shipped"
 
 	// The commented constants are kept to display document structure.
 	// eventIdKey              = "event.id".
@@ -56,6 +65,7 @@ const (
 	mongoLessThan    = "$lt"
 	mongoGreaterThan = "$gt"
 	mongoIn          = "$in"
+	mongoIncrement   = "$inc"
 
 	mongoAscending  = 1
 	mongoDescending = -1
@@ -91,6 +101,8 @@ var (
 	ErrMongoClientCouldNotConnectionToCollection = errors.New("mongo client could not connect to collection")
 	ErrMongoClientCouldNotPerformAction          = errors.New("mongo client could not perform action")
 	ErrMongoClientCouldNotDisconnect             = errors.New("mongo client failed disconnecting")
+	ErrCouldNotReserveSequences                  = errors.New("sequences could not be reserved for the events")
+	ErrCouldNotIndexEvents                       = errors.New("events collection could not be indexed")
 )
 
 func CreateMongoEventStore() *EventStore {
@@ -170,7 +182,10 @@ func (store *EventStore) connect(action mongoConnectionAction, collectionName st
 		return nil
 	})
 
-	return errors.Wrap(client.Disconnect(ctx), ErrMongoClientCouldNotDisconnect.Error())
+	return errors.CombineErrors(
+		err,
+		errors.Wrap(client.Disconnect(ctx), ErrMongoClientCouldNotDisconnect.Error()),
+	)
 }
 
 func (store *EventStore) findOneEvent(filter interface{}, options ...*options.FindOneOptions) (es.Event, error) {
@@ -219,6 +234,106 @@ func (store *EventStore) findAllEvents(filter interface{}, options ...*options.F
 	return events, store.connect(action, eventsCollection)
 }
 
+// sequencedDocument is the part of the event documents which orders them in the log.
+type sequencedDocument struct {
+	Sequence es.Sequence `bson:"seq"`
+	Shipped  time.Time   `bson:"shipped"`
+}
+
+// findSequencedEvents returns the events along with when their sequences were reserved.
+func (store *EventStore) findSequencedEvents(
+	filter interface{},
+	options ...*options.FindOptions,
+) ([]es.SequencedEvent, []time.Time, error) {
+	var (
+		events  []es.SequencedEvent
+		shipped []time.Time
+	)
+
+	action := func(ctx context.Context, collection *mongo.Collection) error {
+		cursor, err := collection.Find(ctx, filter, options...)
+		if err != nil {
+			return errors.Wrap(err, ErrCouldNotFindEvents.Error())
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var (
+				document sequencedDocument
+				event    es.Event
+			)
+
+			if err := cursor.Decode(&document); err != nil {
+				return errors.Wrap(err, ErrEventCouldNotBeDecoded.Error())
+			}
+
+			if err := decodeEvent(cursor, &event); err != nil {
+				return errors.Wrap(err, ErrEventCouldNotBeDecoded.Error())
+			}
+
+			events = append(events, es.SequencedEvent{Sequence: document.Sequence, Event: event})
+			shipped = append(shipped, document.Shipped)
+		}
+
+		return nil
+	}
+
+	return events, shipped, store.connect(action, eventsCollection)
+}
+
+// reserveSequences reserves the next sequences of the producer and returns the
+// latest of them. The counter is incremented atomically, so the sequences of
+// concurrent writers never overlap, but they may be inserted out of order.
+func (store *EventStore) reserveSequences(producer es.ProducerID, count int) (es.Sequence, error) {
+	var counter sequencedDocument
+
+	action := func(ctx context.Context, collection *mongo.Collection) error {
+		result := collection.FindOneAndUpdate(
+			ctx,
+			bson.D{{Key: documentIDKey, Value: producer}},
+			bson.D{{Key: mongoIncrement, Value: bson.D{{Key: sequenceKey, Value: count}}}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		)
+
+		return errors.Wrap(result.Decode(&counter), ErrCouldNotReserveSequences.Error())
+	}
+
+	if err := store.connect(action, countersCollection); err != nil {
+		return 0, err
+	}
+
+	return counter.Sequence, nil
+}
+
+// EnsureIndexes creates the indexes of the events unless they exist. The versions
+// of a subject are unique, which is what makes shipping the stage of a subject an
+// optimistic version check: isStageInSync reads the latest version before inserting,
+// so two stores can both find their stage in sync, but only one of them can insert it.
+func (store *EventStore) EnsureIndexes() error {
+	action := func(ctx context.Context, collection *mongo.Collection) error {
+		_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: eventSubjectKey, Value: mongoAscending},
+					{Key: eventVersionKey, Value: mongoAscending},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: eventProducerKey, Value: mongoAscending},
+					{Key: sequenceKey, Value: mongoAscending},
+				},
+				Options: nil,
+			},
+		})
+
+		return err
+	}
+
+	return errors.Wrap(store.connect(action, eventsCollection), ErrCouldNotIndexEvents.Error())
+}
+
 func (store *EventStore) addToInsertionHistory(collectionName string, insertionIDs ...interface{}) {
 	if _, found := store.insertionHistory[collectionName]; !found {
 		store.insertionHistory[collectionName] = make([]interface{}, 0)
@@ -236,6 +351,22 @@ func (store *EventStore) insertManyDocuments(documents []interface{}, collection
 		results, err := collection.InsertMany(ctx, documents)
 		if err == nil {
 			store.addToInsertionHistory(collectionName, results.InsertedIDs...)
+
+			return nil
+		}
+
+		// The insertion is ordered, hence the documents before the
+		// first write error are inserted and must be rolled back
+		var writeErr mongo.BulkWriteException
+		if results != nil && errors.As(err, &writeErr) && len(writeErr.WriteErrors) > 0 {
+			if inserted := writeErr.WriteErrors[0].Index; inserted <= len(results.InsertedIDs) {
+				store.addToInsertionHistory(collectionName, results.InsertedIDs[:inserted]...)
+			}
+		}
+
+		// Another store inserted an event with the same version of the subject first
+		if mongo.IsDuplicateKeyError(err) {
+			return errors.Mark(errors.Wrap(err, ErrStageOutOfSync.Error()), es.ErrConcurrencyConflict)
 		}
 
 		return errors.Wrap(err, ErrMongoDocumentInsertionFailed.Error())
@@ -342,20 +473,12 @@ func decodeSnapshot(
 	return nil
 }
 
-func marshallEventDocument(event es.Event) interface{} {
-	return bson.D{{
-		Key:   "event",
-		Value: event,
-	}}
-}
-
-func marshallEventDocuments(events []es.Event) []interface{} {
-	documents := make([]interface{}, len(events))
-	for idx, event := range events {
-		documents[idx] = marshallEventDocument(event)
+func marshallEventDocument(event es.Event, sequence es.Sequence, shipped time.Time) interface{} {
+	return bson.D{
+		{Key: "event", Value: event},
+		{Key: sequenceKey, Value: sequence},
+		{Key: shippedKey, Value: shipped},
 	}
-
-	return documents
 }
 
 func marshallSnapshotDocument(snapshot es.Snapshot) interface{} {
@@ -420,11 +543,45 @@ func (store *EventStore) sendEvents(events []es.Event) error {
 		return nil
 	}
 
-	documents := marshallEventDocuments(events)
+	documents, err := store.sequenceEvents(events)
+	if err != nil {
+		return err
+	}
 
 	return store.insertManyDocuments(documents, eventsCollection)
 }
 
+// sequenceEvents reserves the sequences of the events in the logs of their
+// producers and returns the documents of the events in the same order.
+func (store *EventStore) sequenceEvents(events []es.Event) ([]interface{}, error) {
+	counts := make(map[es.ProducerID]int)
+	for _, event := range events {
+		counts[event.Producer]++
+	}
+
+	// The next sequence of each producer
+	next := make(map[es.ProducerID]es.Sequence, len(counts))
+
+	for producer, count := range counts {
+		latest, err := store.reserveSequences(producer, count)
+		if err != nil {
+			return nil, err
+		}
+
+		next[producer] = latest - es.Sequence(count) + 1
+	}
+
+	shipped := time.Now()
+	documents := make([]interface{}, len(events))
+
+	for idx, event := range events {
+		documents[idx] = marshallEventDocument(event, next[event.Producer], shipped)
+		next[event.Producer]++
+	}
+
+	return documents, nil
+}
+
 func (store *EventStore) sendSnapshot(snapshot es.Snapshot) error {
 	document := marshallSnapshotDocument(snapshot)
 
@@ -448,6 +605,9 @@ func (store *EventStore) Clear() {
 	}
 }
 
+// isStageInSync fails fast when the stage is outdated, but it is only
+// a read, hence the unique index of EnsureIndexes is what rejects the
+// stages which are outdated by the time they are inserted.
 func (store *EventStore) isStageInSync(subject es.SubjectID) bool {
 	// Check whether the first staged event is
 	// the next remote event in the remote store
@@ -469,7 +629,7 @@ func (store *EventStore) isStageInSync(subject es.SubjectID) bool {
 
 func (store *EventStore) shipSubject(subject es.SubjectID) error {
 	if !store.isStageInSync(subject) {
-		return ErrStageOutOfSync
+		return errors.Mark(ErrStageOutOfSync, es.ErrConcurrencyConflict)
 	}
 
 	stages := store.stage.EventStages(subject)
@@ -569,6 +729,54 @@ func (store *EventStore) By(producer es.ProducerID) ([]es.Event, error) {
 	return events, nil
 }
 
+// Log returns at most limit events of the producer after the sequence, in the
+// order of their sequences. Concurrent writers may insert their events out of
+// order, so the events after a gap in the sequences are only returned once
+// the gap is too old to be filled, such that no event is ever returned
+// after events with greater sequences.
+func (store *EventStore) Log(producer es.ProducerID, after es.Sequence, limit int) ([]es.SequencedEvent, error) {
+	filter := bson.D{
+		{Key: eventProducerKey, Value: producer},
+		{Key: sequenceKey, Value: bson.D{{Key: mongoGreaterThan, Value: after}}},
+	}
+	options := options.Find()
+	options.SetSort(bson.D{{Key: sequenceKey, Value: mongoAscending}})
+	options.SetLimit(int64(limit))
+
+	events, shipped, err := store.findSequencedEvents(filter, options)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := after + 1
+
+	for idx, event := range events {
+		if event.Sequence != expected && time.Since(shipped[idx]) < sequenceGapTimeout {
+			return events[:idx], nil
+		}
+
+		expected = event.Sequence + 1
+	}
+
+	return events, nil
+}
+
+// LogHead returns the latest sequence which is reserved for the producer, or zero.
+func (store *EventStore) LogHead(producer es.ProducerID) (es.Sequence, error) {
+	var counter sequencedDocument
+
+	action := func(ctx context.Context, collection *mongo.Collection) error {
+		result := collection.FindOne(ctx, bson.D{{Key: documentIDKey, Value: producer}})
+		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			return nil
+		}
+
+		return errors.Wrap(result.Decode(&counter), ErrCouldNotFindEvents.Error())
+	}
+
+	return counter.Sequence, store.connect(action, countersCollection)
+}
+
 func (store *EventStore) Between(subject es.SubjectID, from es.Version, to es.Version) ([]es.Event, error) {
 	filter := bson.D{
 		{Key: eventSubjectKey, Value: subject},
@@ -0,0 +1,176 @@
+package projection
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+)
+
+// Position is where an event is in the source. The positions of the events
+// increase along the source, starting from one, but they may have gaps.
+type Position uint64
+
+// Entry is an event of the source along with its position.
+type Entry struct {
+	Position Position
+	Event    es.Event
+}
+
+type (
+	// Projection is a read model which is kept up to date by applying events.
+	Projection interface {
+		// Name identifies the checkpoint of the projection, so it must not change.
+		Name() string
+		// Apply applies the event to the read model. Events are applied again if the
+		// projector stops between applying them and saving the checkpoint, hence
+		// applying an event more than once must have the same effect as applying it once.
+		Apply(ctx context.Context, event es.Event) error
+		// Reset removes the read model, such that it can be rebuilt from scratch.
+		Reset(ctx context.Context) error
+	}
+
+	// Source is an ordered log of events, in which the positions of the events never
+	// change. Events are never added before the events which have already been read.
+	Source interface {
+		// Read returns at most limit events after the position in the order of their positions.
+		Read(ctx context.Context, after Position, limit int) ([]Entry, error)
+		// Head returns the position of the latest event, or zero.
+		Head(ctx context.Context) (Position, error)
+	}
+
+	// Log is an event store which numbers the events of a producer in the order
+	// they were shipped. The versions only order the events of a subject,
+	// hence the order of By changes when other subjects ship events.
+	Log interface {
+		// Log returns at most limit events of the producer after the sequence.
+		Log(producer es.ProducerID, after es.Sequence, limit int) ([]es.SequencedEvent, error)
+		// LogHead returns the sequence of the latest event of the producer, or zero.
+		LogHead(producer es.ProducerID) (es.Sequence, error)
+	}
+
+	// CheckpointStore keeps the checkpoints of the projections.
+	CheckpointStore interface {
+		// Load returns the checkpoint of the projection, or ErrNoCheckpoint.
+		Load(ctx context.Context, projection string) (Checkpoint, error)
+		Save(ctx context.Context, checkpoint Checkpoint) error
+	}
+)
+
+// Checkpoint is how far a projection has come in applying the events.
+type Checkpoint struct {
+	Projection string
+	// The position of the latest applied event
+	Position Position
+	EventID  es.Ident
+	// When the latest applied event happened
+	EventTimestamp es.Timestamp
+}
+
+var ErrNoCheckpoint = errors.New("projection does not have a checkpoint")
+
+// InitialCheckpoint is the checkpoint of projections which have not applied any events.
+func InitialCheckpoint(projection string) Checkpoint {
+	return Checkpoint{
+		Projection:     projection,
+		Position:       0,
+		EventID:        "",
+		EventTimestamp: es.BeginningOfTime,
+	}
+}
+
+// MemoryCheckpointStore keeps the checkpoints in memory.
+// It is meant for tests and projections which are rebuilt on start.
+type MemoryCheckpointStore struct {
+	lock        sync.RWMutex
+	checkpoints map[string]Checkpoint
+}
+
+func CreateMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{
+		lock:        sync.RWMutex{},
+		checkpoints: make(map[string]Checkpoint),
+	}
+}
+
+func (store *MemoryCheckpointStore) Load(ctx context.Context, projection string) (Checkpoint, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	checkpoint, found := store.checkpoints[projection]
+	if !found {
+		return Checkpoint{}, ErrNoCheckpoint
+	}
+
+	return checkpoint, nil
+}
+
+func (store *MemoryCheckpointStore) Save(ctx context.Context, checkpoint Checkpoint) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.checkpoints[checkpoint.Projection] = checkpoint
+
+	return nil
+}
+
+// StoreSource reads the events of a producer from the event
+// store, where the positions are the sequences of the events.
+type StoreSource struct {
+	log      Log
+	producer es.ProducerID
+}
+
+func CreateStoreSource(log Log, producer es.ProducerID) StoreSource {
+	return StoreSource{
+		log:      log,
+		producer: producer,
+	}
+}
+
+func (source StoreSource) Read(ctx context.Context, after Position, limit int) ([]Entry, error) {
+	events, err := source.log.Log(source.producer, es.Sequence(after), limit)
+	if errors.Is(err, es.ErrNoEvents) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, len(events))
+	for idx, event := range events {
+		entries[idx] = Entry{
+			Position: Position(event.Sequence),
+			Event:    event.Event,
+		}
+	}
+
+	return entries, nil
+}
+
+func (source StoreSource) Head(ctx context.Context) (Position, error) {
+	head, err := source.log.LogHead(source.producer)
+	if errors.Is(err, es.ErrNoEvents) {
+		return 0, nil
+	}
+
+	return Position(head), err
+}
+
+// lagOf returns how many positions the checkpoint is behind the head,
+// and how long ago the latest applied event happened.
+func lagOf(checkpoint Checkpoint, head Position) (Position, time.Duration) {
+	var events Position
+	if head > checkpoint.Position {
+		events = head - checkpoint.Position
+	}
+
+	if checkpoint.EventTimestamp == es.BeginningOfTime {
+		return events, 0
+	}
+
+	return events, time.Since(time.Unix(int64(checkpoint.EventTimestamp), 0))
+}
@@ -0,0 +1,480 @@
+package projection
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+)
+
+type Options struct {
+	// The number of events which are applied between saving the checkpoints
+	BatchSize int
+	// How long the projections wait for new events once they are caught up
+	PollInterval time.Duration
+}
+
+// Projector keeps the registered projections up to date. Every projection
+// is applied by its own goroutine, hence a slow projection does not hold back
+// the others, and saves its checkpoint after every batch of events.
+type Projector struct {
+	source      Source
+	checkpoints CheckpointStore
+	options     Options
+
+	lock    sync.RWMutex
+	runners map[string]*runner
+}
+
+// Status is how far behind the events of the source a projection is.
+type Status struct {
+	Checkpoint Checkpoint
+	Head       Position
+	// The number of positions which are not applied yet, which
+	// is the number of events unless the positions have gaps
+	Lag Position
+	// How long ago the latest applied event happened
+	Age time.Duration
+}
+
+type runner struct {
+	projection Projection
+	// Held while applying events or rebuilding
+	work sync.Mutex
+	// Held while reading or changing the checkpoint
+	lock       sync.RWMutex
+	checkpoint *Checkpoint
+}
+
+const (
+	defaultBatchSize    = 100
+	defaultPollInterval = 500 * time.Millisecond
+)
+
+var (
+	ErrInvalidBatchSize            = errors.New("projector batch size must be positive")
+	ErrInvalidPollInterval         = errors.New("projector poll interval must be positive")
+	ErrInvalidProjectorOptions     = errors.New("projector options are invalid")
+	ErrProjectionAlreadyRegistered = errors.New("projection with the same name is already registered")
+	ErrProjectionNotFound          = errors.New("projection is not registered")
+	ErrCouldNotLoadCheckpoint      = errors.New("projection checkpoint could not be loaded")
+	ErrCouldNotSaveCheckpoint      = errors.New("projection checkpoint could not be saved")
+	ErrCouldNotReadSource          = errors.New("projection source could not be read")
+	ErrCouldNotApplyEvent          = errors.New("projection could not apply the event")
+	ErrCouldNotResetProjection     = errors.New("projection could not be reset")
+	ErrSourceRequired              = errors.New("projector requires a source to read events from")
+)
+
+func DefaultOptions() Options {
+	return Options{
+		BatchSize:    defaultBatchSize,
+		PollInterval: defaultPollInterval,
+	}
+}
+
+func (options Options) Validate() error {
+	if options.BatchSize < 1 {
+		return ErrInvalidBatchSize
+	}
+
+	if options.PollInterval <= 0 {
+		return ErrInvalidPollInterval
+	}
+
+	return nil
+}
+
+// CreateProjector creates a projector which reads the events from the
+// source. The source can be nil if the events are followed on a stream.
+func CreateProjector(source Source, checkpoints CheckpointStore, options Options) (*Projector, error) {
+	if err := options.Validate(); err != nil {
+		return nil, errors.Wrap(err, ErrInvalidProjectorOptions.Error())
+	}
+
+	return &Projector{
+		source:      source,
+		checkpoints: checkpoints,
+		options:     options,
+		lock:        sync.RWMutex{},
+		runners:     make(map[string]*runner),
+	}, nil
+}
+
+func (projector *Projector) Register(projection Projection) error {
+	projector.lock.Lock()
+	defer projector.lock.Unlock()
+
+	if _, found := projector.runners[projection.Name()]; found {
+		return errors.Wrap(ErrProjectionAlreadyRegistered, projection.Name())
+	}
+
+	projector.runners[projection.Name()] = &runner{
+		projection: projection,
+		work:       sync.Mutex{},
+		lock:       sync.RWMutex{},
+		checkpoint: nil,
+	}
+
+	return nil
+}
+
+// Run applies the events of the source to the projections until the context
+// ends. The errors are reported and the failed batches are retried after the
+// poll interval. The errors channel is closed once all the projections stop.
+func (projector *Projector) Run(ctx context.Context) chan error {
+	errs := make(chan error)
+	runners := projector.snapshot()
+
+	var group sync.WaitGroup
+
+	for _, worker := range runners {
+		group.Add(1)
+
+		go func(runner *runner) {
+			defer group.Done()
+
+			for {
+				caughtUp, err := projector.step(ctx, runner)
+				if err != nil {
+					report(ctx, errs, err)
+				}
+
+				if err != nil || caughtUp {
+					if !sleep(ctx, projector.options.PollInterval) {
+						return
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+			}
+		}(worker)
+	}
+
+	go func() {
+		group.Wait()
+		close(errs)
+	}()
+
+	return errs
+}
+
+// CatchUp applies the events of the source to the projections, in parallel,
+// until they have applied all the events which were there when it was called.
+func (projector *Projector) CatchUp(ctx context.Context) error {
+	runners := projector.snapshot()
+	failures := make(chan error, len(runners))
+
+	var group sync.WaitGroup
+
+	for _, worker := range runners {
+		group.Add(1)
+
+		go func(runner *runner) {
+			defer group.Done()
+
+			for {
+				caughtUp, err := projector.step(ctx, runner)
+				if err != nil || caughtUp {
+					failures <- err
+
+					return
+				}
+			}
+		}(worker)
+	}
+
+	group.Wait()
+	close(failures)
+
+	var err error
+	for failure := range failures {
+		err = errors.CombineErrors(err, failure)
+	}
+
+	return err
+}
+
+// Follow applies the events delivered on the topic to all the projections
+// until the context ends. The positions of the checkpoints count the events
+// applied from the stream, since the stream keeps its own offsets. Events which
+// any projection fails to apply are negatively acknowledged, and reported.
+func (projector *Projector) Follow(ctx context.Context, stream es.EventStream, topic es.Topic) chan error {
+	errs := make(chan error)
+
+	go func() {
+		defer close(errs)
+
+		deliveries, streamErrs := stream.Subscribe(ctx, topic)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case delivery, ok := <-deliveries:
+				if !ok {
+					return
+				}
+
+				if err := projector.applyToAll(ctx, delivery.Event); err != nil {
+					delivery.Nack(err)
+					report(ctx, errs, err)
+				} else {
+					delivery.Ack()
+				}
+			case err, ok := <-streamErrs:
+				if !ok {
+					streamErrs = nil
+
+					continue
+				}
+
+				report(ctx, errs, err)
+			}
+		}
+	}()
+
+	return errs
+}
+
+// Rebuild resets the projection and its checkpoint, such that
+// it applies all the events again from the start of the source.
+func (projector *Projector) Rebuild(ctx context.Context, name string) error {
+	runner, err := projector.runner(name)
+	if err != nil {
+		return err
+	}
+
+	runner.work.Lock()
+	defer runner.work.Unlock()
+
+	if err := runner.projection.Reset(ctx); err != nil {
+		return errors.Wrap(err, ErrCouldNotResetProjection.Error())
+	}
+
+	return projector.save(ctx, runner, InitialCheckpoint(name))
+}
+
+// Status returns how far behind the source each of the projections is.
+func (projector *Projector) Status(ctx context.Context) (map[string]Status, error) {
+	var (
+		head Position
+		err  error
+	)
+
+	if projector.source != nil {
+		if head, err = projector.source.Head(ctx); err != nil {
+			return nil, errors.Wrap(err, ErrCouldNotReadSource.Error())
+		}
+	}
+
+	statuses := make(map[string]Status)
+
+	for name, runner := range projector.snapshot() {
+		checkpoint, err := projector.checkpoint(ctx, runner)
+		if err != nil {
+			return nil, err
+		}
+
+		// Streams do not have a head, so only the age tells the lag
+		runnerHead := head
+		if projector.source == nil {
+			runnerHead = checkpoint.Position
+		}
+
+		lag, age := lagOf(checkpoint, runnerHead)
+		statuses[name] = Status{
+			Checkpoint: checkpoint,
+			Head:       runnerHead,
+			Lag:        lag,
+			Age:        age,
+		}
+	}
+
+	return statuses, nil
+}
+
+// step applies the next batch of events to the projection,
+// and returns whether the projection has caught up with the source.
+func (projector *Projector) step(ctx context.Context, runner *runner) (bool, error) {
+	if projector.source == nil {
+		return true, ErrSourceRequired
+	}
+
+	runner.work.Lock()
+	defer runner.work.Unlock()
+
+	checkpoint, err := projector.checkpoint(ctx, runner)
+	if err != nil {
+		return false, err
+	}
+
+	entries, err := projector.source.Read(ctx, checkpoint.Position, projector.options.BatchSize)
+	if err != nil {
+		return false, errors.Wrap(err, ErrCouldNotReadSource.Error())
+	}
+
+	if len(entries) == 0 {
+		return true, nil
+	}
+
+	var applyErr error
+
+	for _, entry := range entries {
+		if applyErr = runner.projection.Apply(ctx, entry.Event); applyErr != nil {
+			applyErr = errors.Wrap(applyErr, ErrCouldNotApplyEvent.Error())
+
+			break
+		}
+
+		checkpoint = advance(checkpoint, entry.Position, entry.Event)
+	}
+
+	// The progress before a failing event is kept
+	if err := projector.save(ctx, runner, checkpoint); err != nil {
+		return false, errors.CombineErrors(applyErr, err)
+	}
+
+	return applyErr == nil && len(entries) < projector.options.BatchSize, applyErr
+}
+
+func (projector *Projector) applyToAll(ctx context.Context, event es.Event) error {
+	runners := projector.snapshot()
+	failures := make(chan error, len(runners))
+
+	var group sync.WaitGroup
+
+	for _, worker := range runners {
+		group.Add(1)
+
+		go func(runner *runner) {
+			defer group.Done()
+
+			failures <- projector.applyOne(ctx, runner, event)
+		}(worker)
+	}
+
+	group.Wait()
+	close(failures)
+
+	var err error
+	for failure := range failures {
+		err = errors.CombineErrors(err, failure)
+	}
+
+	return err
+}
+
+func (projector *Projector) applyOne(ctx context.Context, runner *runner, event es.Event) error {
+	runner.work.Lock()
+	defer runner.work.Unlock()
+
+	checkpoint, err := projector.checkpoint(ctx, runner)
+	if err != nil {
+		return err
+	}
+
+	// The event is redelivered because another projection failed applying it
+	if checkpoint.EventID == event.ID {
+		return nil
+	}
+
+	if err := runner.projection.Apply(ctx, event); err != nil {
+		return errors.Wrap(err, ErrCouldNotApplyEvent.Error())
+	}
+
+	return projector.save(ctx, runner, advance(checkpoint, checkpoint.Position+1, event))
+}
+
+// checkpoint returns the checkpoint of the runner, which is loaded the first time.
+func (projector *Projector) checkpoint(ctx context.Context, runner *runner) (Checkpoint, error) {
+	runner.lock.RLock()
+	cached := runner.checkpoint
+	runner.lock.RUnlock()
+
+	if cached != nil {
+		return *cached, nil
+	}
+
+	name := runner.projection.Name()
+
+	checkpoint, err := projector.checkpoints.Load(ctx, name)
+	if errors.Is(err, ErrNoCheckpoint) {
+		checkpoint, err = InitialCheckpoint(name), nil
+	}
+
+	if err != nil {
+		return Checkpoint{}, errors.Wrap(err, ErrCouldNotLoadCheckpoint.Error())
+	}
+
+	runner.lock.Lock()
+	runner.checkpoint = &checkpoint
+	runner.lock.Unlock()
+
+	return checkpoint, nil
+}
+
+func (projector *Projector) save(ctx context.Context, runner *runner, checkpoint Checkpoint) error {
+	if err := projector.checkpoints.Save(ctx, checkpoint); err != nil {
+		return errors.Wrap(err, ErrCouldNotSaveCheckpoint.Error())
+	}
+
+	runner.lock.Lock()
+	runner.checkpoint = &checkpoint
+	runner.lock.Unlock()
+
+	return nil
+}
+
+func (projector *Projector) runner(name string) (*runner, error) {
+	projector.lock.RLock()
+	defer projector.lock.RUnlock()
+
+	runner, found := projector.runners[name]
+	if !found {
+		return nil, errors.Wrap(ErrProjectionNotFound, name)
+	}
+
+	return runner, nil
+}
+
+func (projector *Projector) snapshot() map[string]*runner {
+	projector.lock.RLock()
+	defer projector.lock.RUnlock()
+
+	runners := make(map[string]*runner, len(projector.runners))
+	for name, runner := range projector.runners {
+		runners[name] = runner
+	}
+
+	return runners
+}
+
+func advance(checkpoint Checkpoint, position Position, event es.Event) Checkpoint {
+	return Checkpoint{
+		Projection:     checkpoint.Projection,
+		Position:       position,
+		EventID:        event.ID,
+		EventTimestamp: event.Timestamp,
+	}
+}
+
+func report(ctx context.Context, errs chan error, err error) {
+	select {
+	case errs <- err:
+	case <-ctx.Done():
+	}
+}
+
+func sleep(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
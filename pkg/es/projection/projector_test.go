@@ -0,0 +1,256 @@
+package projection_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/file"
+	"github.com/hywmongous/example-service/pkg/es/memory"
+	"github.com/hywmongous/example-service/pkg/es/projection"
+)
+
+type Deposited struct {
+	Amount int
+}
+
+const (
+	producer = es.ProducerID("producer")
+	topic    = es.Topic("deposits")
+	timeout  = time.Second
+)
+
+// balances is a projection of the balance of every subject.
+type balances struct {
+	name     string
+	lock     sync.Mutex
+	balances map[es.SubjectID]int
+	resets   int
+}
+
+func createBalances(name string) *balances {
+	return &balances{
+		name:     name,
+		lock:     sync.Mutex{},
+		balances: make(map[es.SubjectID]int),
+		resets:   0,
+	}
+}
+
+func (projection *balances) Name() string {
+	return projection.name
+}
+
+func (projection *balances) Apply(ctx context.Context, event es.Event) error {
+	var deposited Deposited
+	if err := event.Unmarshal(&deposited); err != nil {
+		return err
+	}
+
+	projection.lock.Lock()
+	defer projection.lock.Unlock()
+
+	projection.balances[event.Subject] += deposited.Amount
+
+	return nil
+}
+
+func (projection *balances) Reset(ctx context.Context) error {
+	projection.lock.Lock()
+	defer projection.lock.Unlock()
+
+	projection.balances = make(map[es.SubjectID]int)
+	projection.resets++
+
+	return nil
+}
+
+func (projection *balances) balance(subject es.SubjectID) int {
+	projection.lock.Lock()
+	defer projection.lock.Unlock()
+
+	return projection.balances[subject]
+}
+
+func deposit(t *testing.T, store es.EventStore, subject es.SubjectID, amounts ...int) {
+	t.Helper()
+
+	data := make([]es.Data, len(amounts))
+	for idx, amount := range amounts {
+		data[idx] = Deposited{Amount: amount}
+	}
+
+	if _, err := store.Send(producer, subject, data); err != nil {
+		t.Fatal("Send failed with err:", err)
+	}
+}
+
+func createProjector(t *testing.T, source projection.Source, projections ...projection.Projection) *projection.Projector {
+	t.Helper()
+
+	options := projection.DefaultOptions()
+	// Small batches such that catching up takes several batches
+	options.BatchSize = 2
+
+	projector, err := projection.CreateProjector(source, projection.CreateMemoryCheckpointStore(), options)
+	if err != nil {
+		t.Fatal("CreateProjector failed with err:", err)
+	}
+
+	for _, projection := range projections {
+		if err := projector.Register(projection); err != nil {
+			t.Fatal("Register failed with err:", err)
+		}
+	}
+
+	return projector
+}
+
+func TestProjectorCatchesUpAndTracksLag(t *testing.T) {
+	t.Parallel()
+
+	store, err := file.CreateFileEventStore(file.DefaultOptions(t.TempDir()))
+	if err != nil {
+		t.Fatal("CreateFileEventStore failed with err:", err)
+	}
+	defer store.Close()
+
+	first, second := createBalances("first"), createBalances("second")
+	projector := createProjector(t, projection.CreateStoreSource(store, producer), first, second)
+	ctx := context.Background()
+
+	deposit(t, store, "alice", 1, 2, 3)
+	deposit(t, store, "bob", 10)
+
+	if err := projector.CatchUp(ctx); err != nil {
+		t.Fatal("CatchUp failed with err:", err)
+	}
+
+	for _, projection := range []*balances{first, second} {
+		if projection.balance("alice") != 6 || projection.balance("bob") != 10 {
+			t.Errorf("expected %s to have the balances 6 and 10", projection.Name())
+		}
+	}
+
+	deposit(t, store, "bob", 20, 30)
+
+	statuses, err := projector.Status(ctx)
+	if err != nil {
+		t.Fatal("Status failed with err:", err)
+	}
+
+	if status := statuses["first"]; status.Lag != 2 || status.Checkpoint.Position != 4 {
+		t.Errorf("expected the first projection to lag 2 events behind but got %+v", status)
+	}
+
+	// Rebuilding applies all the events again rather than the new ones only
+	if err := projector.Rebuild(ctx, "first"); err != nil {
+		t.Fatal("Rebuild failed with err:", err)
+	}
+
+	if err := projector.CatchUp(ctx); err != nil {
+		t.Fatal("CatchUp failed with err:", err)
+	}
+
+	if first.resets != 1 || first.balance("bob") != 60 || second.balance("bob") != 60 {
+		t.Errorf("expected the balance of bob to be 60 after rebuilding but got %d and %d", first.balance("bob"), second.balance("bob"))
+	}
+}
+
+func TestProjectorFollowsStream(t *testing.T) {
+	t.Parallel()
+
+	stream, err := memory.CreateMemoryStream(memory.CreateBroker(), memory.DefaultOptions(topic))
+	if err != nil {
+		t.Fatal("CreateMemoryStream failed with err:", err)
+	}
+
+	balances := createBalances("balances")
+	projector := createProjector(t, nil, balances)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := projector.Follow(ctx, stream, topic)
+
+	go func() {
+		for err := range errs {
+			t.Error("Follow failed with err:", err)
+		}
+	}()
+
+	events := []es.Event{
+		{ID: "1", Subject: "alice", Timestamp: es.Timestamp(time.Now().Unix()), Data: Deposited{Amount: 5}},
+		{ID: "2", Subject: "alice", Timestamp: es.Timestamp(time.Now().Unix()), Data: Deposited{Amount: 7}},
+	}
+	if err := stream.Publish(events); err != nil {
+		t.Fatal("Publish failed with err:", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for balances.balance("alice") != 12 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the events to be applied")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// gappedSource is a source whose positions have gaps, such as
+// the sequences of the events which failed shipping.
+type gappedSource []projection.Entry
+
+func (source gappedSource) Read(ctx context.Context, after projection.Position, limit int) ([]projection.Entry, error) {
+	entries := make([]projection.Entry, 0, limit)
+
+	for _, entry := range source {
+		if entry.Position > after && len(entries) < limit {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func (source gappedSource) Head(ctx context.Context) (projection.Position, error) {
+	return source[len(source)-1].Position, nil
+}
+
+func TestProjectorCheckpointsThePositionsOfTheEvents(t *testing.T) {
+	t.Parallel()
+
+	source := gappedSource{
+		{Position: 1, Event: es.Event{ID: "1", Subject: "alice", Data: Deposited{Amount: 1}}},
+		{Position: 4, Event: es.Event{ID: "4", Subject: "alice", Data: Deposited{Amount: 2}}},
+		{Position: 5, Event: es.Event{ID: "5", Subject: "alice", Data: Deposited{Amount: 3}}},
+	}
+
+	balances := createBalances("balances")
+	projector := createProjector(t, source, balances)
+	ctx := context.Background()
+
+	if err := projector.CatchUp(ctx); err != nil {
+		t.Fatal("CatchUp failed with err:", err)
+	}
+
+	statuses, err := projector.Status(ctx)
+	if err != nil {
+		t.Fatal("Status failed with err:", err)
+	}
+
+	if status := statuses["balances"]; status.Checkpoint.Position != 5 || status.Lag != 0 {
+		t.Errorf("expected the checkpoint to be at the latest position but got %+v", status)
+	}
+
+	// Catching up again does not apply the events after the gap twice
+	if err := projector.CatchUp(ctx); err != nil {
+		t.Fatal("CatchUp failed with err:", err)
+	}
+
+	if balances.balance("alice") != 6 {
+		t.Errorf("expected the balance of alice to be 6 but got %d", balances.balance("alice"))
+	}
+}
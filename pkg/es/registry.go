@@ -0,0 +1,96 @@
+package es
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Registry knows the types of the event data by their titles, such that the
+// data of events which are loaded from a store can be decoded into their types.
+type Registry struct {
+	lock  sync.RWMutex
+	types map[Title]reflect.Type
+}
+
+var (
+	ErrUnregisteredData    = errors.New("data type is not registered")
+	ErrCouldNotDecodeData  = errors.New("data could not be decoded into its registered type")
+	ErrCouldNotEncodeData  = errors.New("data could not be encoded")
+	ErrDataTitleConflicted = errors.New("another data type is registered with the same title")
+)
+
+func CreateRegistry() *Registry {
+	return &Registry{
+		lock:  sync.RWMutex{},
+		types: make(map[Title]reflect.Type),
+	}
+}
+
+// Register registers the types of the prototypes. Pointer prototypes
+// are decoded as pointers and other prototypes are decoded as values.
+func (registry *Registry) Register(prototypes ...Data) error {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for _, prototype := range prototypes {
+		title := CreateTitleForData(prototype)
+		dataType := reflect.TypeOf(prototype)
+
+		if registered, found := registry.types[title]; found && registered != dataType {
+			return errors.Wrap(ErrDataTitleConflicted, string(title))
+		}
+
+		registry.types[title] = dataType
+	}
+
+	return nil
+}
+
+func (registry *Registry) Registered(title Title) bool {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	_, found := registry.types[title]
+
+	return found
+}
+
+// Decode returns the data of the event as its registered type.
+func (registry *Registry) Decode(event Event) (Data, error) {
+	payload, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotEncodeData.Error())
+	}
+
+	return registry.DecodeJSON(event.Name, payload)
+}
+
+// DecodeJSON decodes the JSON encoded data with the title as its registered type.
+func (registry *Registry) DecodeJSON(title Title, payload []byte) (Data, error) {
+	registry.lock.RLock()
+	dataType, found := registry.types[title]
+	registry.lock.RUnlock()
+
+	if !found {
+		return nil, errors.Wrap(ErrUnregisteredData, string(title))
+	}
+
+	isPointer := dataType.Kind() == reflect.Ptr
+	if isPointer {
+		dataType = dataType.Elem()
+	}
+
+	data := reflect.New(dataType)
+	if err := json.Unmarshal(payload, data.Interface()); err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotDecodeData.Error())
+	}
+
+	if isPointer {
+		return data.Interface(), nil
+	}
+
+	return data.Elem().Interface(), nil
+}
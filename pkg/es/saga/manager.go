@@ -0,0 +1,604 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+)
+
+// Dispatcher sends the commands of the saga instances.
+type Dispatcher func(ctx context.Context, command mediator.Request) error
+
+// Manager correlates events with the instances of a saga definition and
+// lets them handle the events. The state of the instances is kept as events
+// in the store, such that they survive restarts, and the events are handled
+// one at a time, such that the instances never handle events concurrently.
+// Handling an event records its claim with an optimistic version check, hence
+// an event is handled once even if the managers of several instances race for
+// it, provided the store ships atomically with the check as es.ErrConcurrencyConflict
+// requires. The commands are recorded along with the claim and dispatched after
+// it, in the order they were sent, until they are dispatched. Hence a command
+// is dispatched at least once, even if dispatching fails or the manager stops.
+type Manager struct {
+	definition Definition
+	store      es.EventStore
+	dispatch   Dispatcher
+	commands   *es.Registry
+
+	// Held while handling events, which includes using the stage of the store
+	lock   sync.Mutex
+	timers map[timerKey]*time.Timer
+	fired  chan firedTimeout
+	// The instances which have commands to dispatch again
+	retries     map[ID]*time.Timer
+	undelivered chan ID
+	done        chan struct{}
+	closed      *sync.Once
+}
+
+type instance struct {
+	state     State
+	started   bool
+	completed bool
+	handled   map[es.Ident]bool
+	// The deadlines of the timeouts which have not elapsed
+	pending map[string]int64
+	// The commands which are not dispatched yet in the order they were sent
+	outbox []SagaCommandIssued
+	// The version which the next event of the instance must have
+	next es.Version
+}
+
+type timerKey struct {
+	id   ID
+	name string
+}
+
+type firedTimeout struct {
+	key      timerKey
+	deadline int64
+}
+
+const (
+	// Timeouts which could not be handled are retried after this delay.
+	timeoutRetryDelay = time.Second
+	// Commands which could not be dispatched are retried after this delay.
+	commandRetryDelay = time.Second
+)
+
+var (
+	ErrCouldNotLoadSaga   = errors.New("saga instance could not be loaded from the event store")
+	ErrCouldNotApplyEvent = errors.New("saga instance could not apply its event")
+	ErrSagaHandlingFailed = errors.New("saga instance failed handling the event")
+	ErrCommandFailed      = errors.New("saga instance command could not be sent")
+	ErrCouldNotStoreSaga  = errors.New("saga instance events could not be stored")
+	ErrCouldNotResume     = errors.New("saga instances could not be resumed")
+	ErrSagaChanged        = errors.New("saga instance was changed since it was loaded")
+	ErrCouldNotEncode     = errors.New("saga instance command could not be encoded")
+)
+
+var (
+	eventHandledTitle     = es.CreateTitleForData(SagaEventHandled{})
+	timeoutScheduledTitle = es.CreateTitleForData(SagaTimeoutScheduled{})
+	timeoutCancelledTitle = es.CreateTitleForData(SagaTimeoutCancelled{})
+	timeoutElapsedTitle   = es.CreateTitleForData(SagaTimeoutElapsed{})
+	completedTitle        = es.CreateTitleForData(SagaCompleted{})
+	commandIssuedTitle    = es.CreateTitleForData(SagaCommandIssued{})
+	commandSentTitle      = es.CreateTitleForData(SagaCommandSent{})
+)
+
+func CreateManager(definition Definition, store es.EventStore, dispatch Dispatcher) *Manager {
+	return &Manager{
+		definition:  definition,
+		store:       store,
+		dispatch:    dispatch,
+		commands:    es.CreateRegistry(),
+		lock:        sync.Mutex{},
+		timers:      make(map[timerKey]*time.Timer),
+		fired:       make(chan firedTimeout),
+		retries:     make(map[ID]*time.Timer),
+		undelivered: make(chan ID),
+		done:        make(chan struct{}),
+		closed:      &sync.Once{},
+	}
+}
+
+// Register registers the types of the commands which the instances send,
+// such that the commands can be decoded when they are dispatched again.
+func (manager *Manager) Register(prototypes ...es.Data) error {
+	return manager.commands.Register(prototypes...)
+}
+
+// BusDispatcher sends the commands through the bus and discards their responses.
+func BusDispatcher(bus *mediator.Bus) Dispatcher {
+	return func(ctx context.Context, command mediator.Request) error {
+		_, err := bus.Send(ctx, command)
+
+		return err
+	}
+}
+
+// Run resumes the timeouts and the commands of the instances and then handles
+// the events of the topic, the timeouts and the commands until the context ends.
+// Events are acknowledged once handled and negatively acknowledged if handling
+// them fails, in which case the error is reported as well. Commands which
+// cannot be dispatched are reported and dispatched again after a delay.
+// The errors channel is closed when it stops.
+func (manager *Manager) Run(ctx context.Context, stream es.EventStream, topic es.Topic) chan error {
+	errs := make(chan error)
+
+	go func() {
+		defer close(errs)
+
+		if err := manager.resume(ctx); err != nil {
+			report(ctx, errs, err)
+		}
+
+		deliveries, streamErrs := stream.Subscribe(ctx, topic)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case delivery, ok := <-deliveries:
+				if !ok {
+					return
+				}
+
+				if err := manager.Handle(ctx, delivery.Event); err != nil {
+					delivery.Nack(err)
+					report(ctx, errs, err)
+				} else {
+					delivery.Ack()
+				}
+			case err, ok := <-streamErrs:
+				if !ok {
+					streamErrs = nil
+
+					continue
+				}
+
+				report(ctx, errs, err)
+			case fired := <-manager.fired:
+				if err := manager.handleTimeout(ctx, fired); err != nil {
+					report(ctx, errs, err)
+				}
+			case id := <-manager.undelivered:
+				if err := manager.redeliver(ctx, id); err != nil {
+					report(ctx, errs, err)
+				}
+			}
+		}
+	}()
+
+	return errs
+}
+
+// Close stops the timeouts and the retries of the commands. They
+// are resumed by the next manager which runs.
+func (manager *Manager) Close() {
+	manager.closed.Do(func() {
+		close(manager.done)
+
+		manager.lock.Lock()
+		defer manager.lock.Unlock()
+
+		for key, timer := range manager.timers {
+			timer.Stop()
+			delete(manager.timers, key)
+		}
+
+		for id, timer := range manager.retries {
+			timer.Stop()
+			delete(manager.retries, id)
+		}
+	})
+}
+
+// Handle lets the instance which the event concerns handle the event.
+func (manager *Manager) Handle(ctx context.Context, event es.Event) error {
+	id, starts, ok := manager.definition.Correlate(event)
+	if !ok {
+		return nil
+	}
+
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	instance, err := manager.load(id)
+	if err != nil {
+		return err
+	}
+
+	if instance.completed || (!instance.started && !starts) || instance.handled[event.ID] {
+		return nil
+	}
+
+	return manager.handle(ctx, id, instance, event)
+}
+
+func (manager *Manager) handleTimeout(ctx context.Context, fired firedTimeout) error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	instance, err := manager.load(fired.key.id)
+	if err != nil {
+		manager.arm(fired.key, fired.deadline, timeoutRetryDelay)
+
+		return err
+	}
+
+	// The timeout is stale if it was cancelled or scheduled again since
+	if instance.completed || instance.pending[fired.key.name] != fired.deadline {
+		return nil
+	}
+
+	delete(manager.timers, fired.key)
+
+	event := es.Event{
+		ID:              es.Ident(fmt.Sprintf("%s/%s/%d", fired.key.id, fired.key.name, fired.deadline)),
+		Producer:        manager.definition.Name(),
+		Subject:         es.SubjectID(fired.key.id),
+		Version:         es.InitialEventVersion,
+		SchemaVersion:   es.InitialEventSchemaVersion,
+		SnapshotVersion: es.InitialSnapshotVersion,
+		Name:            timeoutElapsedTitle,
+		Timestamp:       es.Timestamp(time.Now().Unix()),
+		Data:            SagaTimeoutElapsed{Name: fired.key.name},
+	}
+
+	if err := manager.handle(ctx, fired.key.id, instance, event); err != nil {
+		manager.arm(fired.key, fired.deadline, timeoutRetryDelay)
+
+		return err
+	}
+
+	return nil
+}
+
+// handle must be called while holding the lock. Events which
+// the manager of another instance claimed first are left to it.
+// The commands are dispatched once the event is claimed.
+func (manager *Manager) handle(ctx context.Context, id ID, instance *instance, event es.Event) error {
+	saga := createContext(id, instance.state)
+
+	if err := instance.state.Handle(ctx, event, saga); err != nil {
+		return errors.Wrap(err, ErrSagaHandlingFailed.Error())
+	}
+
+	issued, err := manager.issue(event, saga.commands)
+	if err != nil {
+		return err
+	}
+
+	data := saga.events(event)
+	for _, command := range issued {
+		data = append(data, command)
+	}
+
+	err = manager.append(ctx, id, instance, data)
+	if errors.Is(err, es.ErrConcurrencyConflict) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	instance.next += es.Version(len(data))
+	instance.outbox = append(instance.outbox, issued...)
+
+	manager.schedule(id, saga)
+
+	return manager.deliver(ctx, id, instance)
+}
+
+// issue encodes the commands which are sent in reaction to the event, such
+// that they can be recorded. Their ids are derived from the id of the event.
+func (manager *Manager) issue(event es.Event, commands []mediator.Request) ([]SagaCommandIssued, error) {
+	issued := make([]SagaCommandIssued, 0, len(commands))
+
+	for idx, command := range commands {
+		title := es.CreateTitleForData(command)
+		if !manager.commands.Registered(title) {
+			return nil, errors.Wrap(es.ErrUnregisteredData, string(title))
+		}
+
+		payload, err := json.Marshal(command)
+		if err != nil {
+			return nil, errors.Wrap(err, ErrCouldNotEncode.Error())
+		}
+
+		issued = append(issued, SagaCommandIssued{
+			ID:      fmt.Sprintf("%s/%d", event.ID, idx),
+			Name:    title,
+			Payload: payload,
+		})
+	}
+
+	return issued, nil
+}
+
+// deliver must be called while holding the lock. It dispatches the commands
+// of the instance in order and records that they are sent. The commands
+// which cannot be dispatched, and those after them, are dispatched again later.
+func (manager *Manager) deliver(ctx context.Context, id ID, instance *instance) error {
+	for len(instance.outbox) > 0 {
+		issued := instance.outbox[0]
+
+		command, err := manager.commands.DecodeJSON(issued.Name, issued.Payload)
+		if err != nil {
+			manager.retry(id)
+
+			return errors.Wrap(err, ErrCommandFailed.Error())
+		}
+
+		if err := manager.dispatch(ctx, command); err != nil {
+			manager.retry(id)
+
+			return errors.Wrap(err, ErrCommandFailed.Error())
+		}
+
+		// The command is dispatched again if the instance was changed elsewhere,
+		// since it cannot be told whether the other manager has dispatched it
+		if err := manager.append(ctx, id, instance, []es.Data{SagaCommandSent{ID: issued.ID}}); err != nil {
+			manager.retry(id)
+
+			return err
+		}
+
+		instance.next++
+		instance.outbox = instance.outbox[1:]
+	}
+
+	return nil
+}
+
+// retry must be called while holding the lock.
+func (manager *Manager) retry(id ID) {
+	if _, found := manager.retries[id]; found {
+		return
+	}
+
+	manager.retries[id] = time.AfterFunc(commandRetryDelay, func() {
+		select {
+		case manager.undelivered <- id:
+		case <-manager.done:
+		}
+	})
+}
+
+func (manager *Manager) redeliver(ctx context.Context, id ID) error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	delete(manager.retries, id)
+
+	instance, err := manager.load(id)
+	if err != nil {
+		manager.retry(id)
+
+		return err
+	}
+
+	return manager.deliver(ctx, id, instance)
+}
+
+// append ships the events of the instance at once. It fails with
+// es.ErrConcurrencyConflict unless the events follow the events which
+// the instance was loaded from, such that only one of the managers
+// which loaded the same events can append to the instance.
+func (manager *Manager) append(ctx context.Context, id ID, instance *instance, data []es.Data) error {
+	// The stage is only used within the lock, so it is cleared whether shipping succeeds or not
+	defer manager.store.Clear()
+
+	subject := es.SubjectID(id)
+
+	for _, event := range data {
+		if err := manager.store.Load(manager.definition.Name(), subject, event); err != nil {
+			return errors.Wrap(err, ErrCouldNotStoreSaga.Error())
+		}
+	}
+
+	stage := manager.store.Stage()
+	if staged, _ := stage.FirstEvent(subject); staged.Version != instance.next {
+		return errors.Mark(ErrSagaChanged, es.ErrConcurrencyConflict)
+	}
+
+	if err := manager.store.Ship(ctx); err != nil {
+		return errors.Wrap(err, ErrCouldNotStoreSaga.Error())
+	}
+
+	return nil
+}
+
+func (manager *Manager) schedule(id ID, saga *Context) {
+	if saga.completed {
+		for key, timer := range manager.timers {
+			if key.id == id {
+				timer.Stop()
+				delete(manager.timers, key)
+			}
+		}
+
+		return
+	}
+
+	for _, timeout := range saga.timeouts {
+		switch timeout := timeout.(type) {
+		case SagaTimeoutScheduled:
+			key := timerKey{id: id, name: timeout.Name}
+			manager.arm(key, timeout.Deadline, time.Until(time.Unix(0, timeout.Deadline)))
+		case SagaTimeoutCancelled:
+			key := timerKey{id: id, name: timeout.Name}
+			if timer, found := manager.timers[key]; found {
+				timer.Stop()
+				delete(manager.timers, key)
+			}
+		}
+	}
+}
+
+// arm must be called while holding the lock.
+func (manager *Manager) arm(key timerKey, deadline int64, after time.Duration) {
+	if timer, found := manager.timers[key]; found {
+		timer.Stop()
+	}
+
+	manager.timers[key] = time.AfterFunc(after, func() {
+		select {
+		case manager.fired <- firedTimeout{key: key, deadline: deadline}:
+		case <-manager.done:
+		}
+	})
+}
+
+// resume arms the pending timeouts of all the instances and dispatches their
+// commands. Deadlines which passed while no manager was running elapse immediately.
+func (manager *Manager) resume(ctx context.Context) error {
+	events, err := manager.store.By(manager.definition.Name())
+	if err != nil && !errors.Is(err, es.ErrNoEvents) {
+		return errors.Wrap(err, ErrCouldNotResume.Error())
+	}
+
+	concerning := make(map[ID][]es.Event)
+	for _, event := range events {
+		id := ID(event.Subject)
+		concerning[id] = append(concerning[id], event)
+	}
+
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	var result error
+
+	for id, events := range concerning {
+		instance, err := manager.rebuild(id, events)
+		if err != nil {
+			return errors.Wrap(err, ErrCouldNotResume.Error())
+		}
+
+		// Completed instances may still have commands to dispatch
+		if err := manager.deliver(ctx, id, instance); err != nil {
+			result = errors.CombineErrors(result, err)
+		}
+
+		if instance.completed {
+			continue
+		}
+
+		for name, deadline := range instance.pending {
+			manager.arm(timerKey{id: id, name: name}, deadline, time.Until(time.Unix(0, deadline)))
+		}
+	}
+
+	return result
+}
+
+func (manager *Manager) load(id ID) (*instance, error) {
+	events, err := manager.store.Concerning(es.SubjectID(id))
+	if err != nil && !errors.Is(err, es.ErrNoEvents) {
+		return nil, errors.Wrap(err, ErrCouldNotLoadSaga.Error())
+	}
+
+	return manager.rebuild(id, events)
+}
+
+func (manager *Manager) rebuild(id ID, events []es.Event) (*instance, error) {
+	instance := &instance{
+		state:     manager.definition.New(id),
+		started:   len(events) > 0,
+		completed: false,
+		handled:   make(map[es.Ident]bool),
+		pending:   make(map[string]int64),
+		outbox:    make([]SagaCommandIssued, 0),
+		next:      es.InitialEventVersion,
+	}
+
+	for _, event := range events {
+		if err := instance.apply(event); err != nil {
+			return nil, errors.Wrap(err, ErrCouldNotApplyEvent.Error())
+		}
+
+		instance.next = event.Version + 1
+	}
+
+	return instance, nil
+}
+
+func (instance *instance) apply(event es.Event) error {
+	switch event.Name {
+	case eventHandledTitle:
+		var handled SagaEventHandled
+		if err := event.Unmarshal(&handled); err != nil {
+			return err
+		}
+
+		instance.handled[es.Ident(handled.EventID)] = true
+	case timeoutScheduledTitle:
+		var scheduled SagaTimeoutScheduled
+		if err := event.Unmarshal(&scheduled); err != nil {
+			return err
+		}
+
+		instance.pending[scheduled.Name] = scheduled.Deadline
+	case timeoutCancelledTitle:
+		var cancelled SagaTimeoutCancelled
+		if err := event.Unmarshal(&cancelled); err != nil {
+			return err
+		}
+
+		delete(instance.pending, cancelled.Name)
+	case timeoutElapsedTitle:
+		var elapsed SagaTimeoutElapsed
+		if err := event.Unmarshal(&elapsed); err != nil {
+			return err
+		}
+
+		delete(instance.pending, elapsed.Name)
+	case commandIssuedTitle:
+		var issued SagaCommandIssued
+		if err := event.Unmarshal(&issued); err != nil {
+			return err
+		}
+
+		instance.outbox = append(instance.outbox, issued)
+	case commandSentTitle:
+		var sent SagaCommandSent
+		if err := event.Unmarshal(&sent); err != nil {
+			return err
+		}
+
+		instance.send(sent.ID)
+	case completedTitle:
+		instance.completed = true
+	default:
+		return instance.state.Apply(event)
+	}
+
+	return nil
+}
+
+// send removes the command from the outbox of the instance.
+func (instance *instance) send(id string) {
+	for idx, issued := range instance.outbox {
+		if issued.ID == id {
+			instance.outbox = append(instance.outbox[:idx], instance.outbox[idx+1:]...)
+
+			return
+		}
+	}
+}
+
+func report(ctx context.Context, errs chan error, err error) {
+	select {
+	case errs <- err:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,178 @@
+package saga
+
+import (
+	"context"
+	"time"
+
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+)
+
+// ID identifies a saga instance. It is the subject of the events of the instance.
+type ID string
+
+type (
+	// Definition describes a kind of saga, such as the registration of an identity.
+	Definition interface {
+		// Name is the producer of the events of the instances.
+		Name() es.ProducerID
+		// Correlate returns the instance which the event concerns, and whether
+		// the event starts the instance. Events which do not concern any
+		// instance are ignored, as are events for instances which are not started.
+		Correlate(event es.Event) (id ID, starts bool, ok bool)
+		// New returns the state of an instance before any of its events are applied.
+		New(id ID) State
+	}
+
+	// State is the state of a saga instance, which is rebuilt by applying
+	// the events it has recorded. It must only change when they are applied.
+	State interface {
+		// Apply applies an event recorded by the instance. The data of events which
+		// are loaded from the store must be unmarshalled with event.Unmarshal.
+		Apply(event es.Event) error
+		// Handle reacts to an event which is correlated with the instance, or to
+		// one of its timeouts elapsing, through the context of the saga.
+		Handle(ctx context.Context, event es.Event, saga *Context) error
+	}
+)
+
+// Context is what a saga instance does in reaction to an event. The events are
+// recorded and the commands are sent once the instance has handled the event.
+type Context struct {
+	id       ID
+	state    State
+	recorded []es.Data
+	commands []mediator.Request
+	// The scheduled and cancelled timeouts in the order of the calls
+	timeouts  []es.Data
+	completed bool
+}
+
+// The events which the manager records for the instances, beside their own.
+type (
+	// SagaEventHandled makes redelivered events have no effect.
+	SagaEventHandled struct {
+		EventID string
+	}
+	SagaTimeoutScheduled struct {
+		Name string
+		// Unix nanoseconds
+		Deadline int64
+	}
+	SagaTimeoutCancelled struct {
+		Name string
+	}
+	SagaTimeoutElapsed struct {
+		Name string
+	}
+	SagaCompleted struct{}
+	// SagaCommandIssued records a command which is sent, until it is dispatched.
+	SagaCommandIssued struct {
+		ID      string
+		Name    es.Title
+		Payload []byte
+	}
+	SagaCommandSent struct {
+		ID string
+	}
+)
+
+func createContext(id ID, state State) *Context {
+	return &Context{
+		id:        id,
+		state:     state,
+		recorded:  make([]es.Data, 0),
+		commands:  make([]mediator.Request, 0),
+		timeouts:  make([]es.Data, 0),
+		completed: false,
+	}
+}
+
+func (saga *Context) ID() ID {
+	return saga.id
+}
+
+// Record records an event of the instance and applies it to the state.
+func (saga *Context) Record(data es.Data) error {
+	if err := saga.state.Apply(es.Event{
+		ID:              "",
+		Producer:        "",
+		Subject:         es.SubjectID(saga.id),
+		Version:         es.InitialEventVersion,
+		SchemaVersion:   es.InitialEventSchemaVersion,
+		SnapshotVersion: es.InitialSnapshotVersion,
+		Name:            es.CreateTitleForData(data),
+		Timestamp:       es.Timestamp(time.Now().Unix()),
+		Data:            data,
+	}); err != nil {
+		return err
+	}
+
+	saga.recorded = append(saga.recorded, data)
+
+	return nil
+}
+
+// Send sends the command once the event is handled. The command is recorded
+// along with the events of the instance and sent until it is dispatched, hence
+// its handler must tolerate receiving it more than once. The type of the
+// command must be registered with the manager.
+func (saga *Context) Send(command mediator.Request) {
+	saga.commands = append(saga.commands, command)
+}
+
+// Timeout makes the instance handle a SagaTimeoutElapsed event after
+// the duration, unless it is cancelled or the instance is completed.
+// Scheduling a timeout with the same name again replaces it.
+func (saga *Context) Timeout(name string, after time.Duration) {
+	saga.timeouts = append(saga.timeouts, SagaTimeoutScheduled{
+		Name:     name,
+		Deadline: time.Now().Add(after).UnixNano(),
+	})
+}
+
+func (saga *Context) CancelTimeout(name string) {
+	saga.timeouts = append(saga.timeouts, SagaTimeoutCancelled{
+		Name: name,
+	})
+}
+
+// Complete ends the instance, after which it ignores all events.
+func (saga *Context) Complete() {
+	saga.completed = true
+}
+
+// ElapsedTimeout returns the name of the timeout if the event is a timeout elapsing.
+func ElapsedTimeout(event es.Event) (string, bool) {
+	if event.Name != es.CreateTitleForData(SagaTimeoutElapsed{}) {
+		return "", false
+	}
+
+	var elapsed SagaTimeoutElapsed
+	if err := event.Unmarshal(&elapsed); err != nil {
+		return "", false
+	}
+
+	return elapsed.Name, true
+}
+
+// events returns the events to record for handling the event. The event
+// is marked as handled first, such that an elapsed timeout can be scheduled again.
+func (saga *Context) events(handled es.Event) []es.Data {
+	data := make([]es.Data, 0, len(saga.recorded)+len(saga.timeouts)+2)
+
+	if name, ok := ElapsedTimeout(handled); ok {
+		data = append(data, SagaTimeoutElapsed{Name: name})
+	} else {
+		data = append(data, SagaEventHandled{EventID: string(handled.ID)})
+	}
+
+	data = append(data, saga.recorded...)
+	data = append(data, saga.timeouts...)
+
+	if saga.completed {
+		data = append(data, SagaCompleted{})
+	}
+
+	return data
+}
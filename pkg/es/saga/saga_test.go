@@ -0,0 +1,344 @@
+package saga_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/file"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+	"github.com/hywmongous/example-service/pkg/es/memory"
+	"github.com/hywmongous/example-service/pkg/es/saga"
+)
+
+type (
+	// The events which the saga reacts to
+	Registered struct{}
+	Confirmed  struct{}
+
+	// The event which the saga records
+	ConfirmationRequested struct{}
+
+	// The commands which the saga sends
+	SendConfirmation struct {
+		Subject es.SubjectID
+	}
+	ExpireRegistration struct {
+		Subject es.SubjectID
+	}
+)
+
+const (
+	topic   = es.Topic("identities")
+	expire  = "expire"
+	timeout = time.Second
+)
+
+type registrationSaga struct {
+	expiresAfter time.Duration
+	// Called while handling, before the manager stores the instance
+	handling func(subject es.SubjectID)
+}
+
+type registration struct {
+	subject   es.SubjectID
+	requested bool
+	expires   time.Duration
+	handling  func(subject es.SubjectID)
+}
+
+func (definition registrationSaga) Name() es.ProducerID {
+	return es.ProducerID("registration")
+}
+
+func (definition registrationSaga) Correlate(event es.Event) (saga.ID, bool, bool) {
+	switch event.Name {
+	case es.CreateTitleForData(Registered{}):
+		return saga.ID(event.Subject), true, true
+	case es.CreateTitleForData(Confirmed{}):
+		return saga.ID(event.Subject), false, true
+	default:
+		return "", false, false
+	}
+}
+
+func (definition registrationSaga) New(id saga.ID) saga.State {
+	return &registration{
+		subject:   es.SubjectID(id),
+		requested: false,
+		expires:   definition.expiresAfter,
+		handling:  definition.handling,
+	}
+}
+
+func (state *registration) Apply(event es.Event) error {
+	if event.Name == es.CreateTitleForData(ConfirmationRequested{}) {
+		state.requested = true
+	}
+
+	return nil
+}
+
+func (state *registration) Handle(ctx context.Context, event es.Event, instance *saga.Context) error {
+	if state.handling != nil {
+		state.handling(state.subject)
+	}
+
+	if name, ok := saga.ElapsedTimeout(event); ok && name == expire {
+		instance.Send(ExpireRegistration{Subject: state.subject})
+		instance.Complete()
+
+		return nil
+	}
+
+	switch event.Name {
+	case es.CreateTitleForData(Registered{}):
+		if err := instance.Record(ConfirmationRequested{}); err != nil {
+			return err
+		}
+
+		instance.Send(SendConfirmation{Subject: state.subject})
+		instance.Timeout(expire, state.expires)
+	case es.CreateTitleForData(Confirmed{}):
+		instance.CancelTimeout(expire)
+		instance.Complete()
+	}
+
+	return nil
+}
+
+func createEvent(id string, subject es.SubjectID, data es.Data) es.Event {
+	return es.Event{
+		ID:      es.Ident(id),
+		Subject: subject,
+		Name:    es.CreateTitleForData(data),
+		Data:    data,
+	}
+}
+
+func createStore(t *testing.T, directory string) *file.EventStore {
+	t.Helper()
+
+	store, err := file.CreateFileEventStore(file.DefaultOptions(directory))
+	if err != nil {
+		t.Fatal("CreateFileEventStore failed with err:", err)
+	}
+
+	return store
+}
+
+func createManager(t *testing.T, definition saga.Definition, store es.EventStore, dispatch saga.Dispatcher) *saga.Manager {
+	t.Helper()
+
+	manager := saga.CreateManager(definition, store, dispatch)
+	if err := manager.Register(SendConfirmation{}, ExpireRegistration{}); err != nil {
+		t.Fatal("Register failed with err:", err)
+	}
+
+	return manager
+}
+
+func recordCommands() (saga.Dispatcher, chan mediator.Request) {
+	commands := make(chan mediator.Request, 16)
+
+	return func(ctx context.Context, command mediator.Request) error {
+		commands <- command
+
+		return nil
+	}, commands
+}
+
+func receive(t *testing.T, commands chan mediator.Request) mediator.Request {
+	t.Helper()
+
+	select {
+	case command := <-commands:
+		return command
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for a command")
+	}
+
+	return nil
+}
+
+func TestManagerCorrelatesEventsOnce(t *testing.T) {
+	t.Parallel()
+
+	store := createStore(t, t.TempDir())
+	defer store.Close()
+
+	dispatch, commands := recordCommands()
+	manager := createManager(t, registrationSaga{expiresAfter: time.Hour}, store, dispatch)
+	defer manager.Close()
+
+	ctx := context.Background()
+	events := []es.Event{
+		// Confirming an instance which is not started has no effect
+		createEvent("1", "bob", Confirmed{}),
+		createEvent("2", "bob", Registered{}),
+		// Redelivered events have no effect
+		createEvent("2", "bob", Registered{}),
+		createEvent("3", "bob", Confirmed{}),
+		// Completed instances ignore all events
+		createEvent("4", "bob", Registered{}),
+	}
+
+	for _, event := range events {
+		if err := manager.Handle(ctx, event); err != nil {
+			t.Fatal("Handle failed with err:", err)
+		}
+	}
+
+	if command := receive(t, commands); command != (SendConfirmation{Subject: "bob"}) {
+		t.Errorf("expected the confirmation to be sent but got %v", command)
+	}
+
+	if len(commands) != 0 {
+		t.Errorf("expected exactly one command but got %d more", len(commands))
+	}
+}
+
+func TestManagerResumesTimeouts(t *testing.T) {
+	t.Parallel()
+
+	store := createStore(t, t.TempDir())
+	defer store.Close()
+
+	dispatch, commands := recordCommands()
+	definition := registrationSaga{expiresAfter: 50 * time.Millisecond}
+
+	// The first manager stops before the registration expires
+	stopped := createManager(t, definition, store, dispatch)
+	if err := stopped.Handle(context.Background(), createEvent("1", "bob", Registered{})); err != nil {
+		t.Fatal("Handle failed with err:", err)
+	}
+
+	stopped.Close()
+	receive(t, commands)
+
+	// The next manager expires the registration and handles the published events
+	stream, err := memory.CreateMemoryStream(memory.CreateBroker(), memory.DefaultOptions(topic))
+	if err != nil {
+		t.Fatal("CreateMemoryStream failed with err:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manager := createManager(t, definition, store, dispatch)
+	defer manager.Close()
+
+	errs := manager.Run(ctx, stream, topic)
+
+	go func() {
+		for err := range errs {
+			t.Error("Run failed with err:", err)
+		}
+	}()
+
+	if command := receive(t, commands); command != (ExpireRegistration{Subject: "bob"}) {
+		t.Errorf("expected the registration to expire but got %v", command)
+	}
+
+	if err := stream.Publish([]es.Event{createEvent("2", "alice", Registered{})}); err != nil {
+		t.Fatal("Publish failed with err:", err)
+	}
+
+	if command := receive(t, commands); command != (SendConfirmation{Subject: "alice"}) {
+		t.Errorf("expected the confirmation to be sent but got %v", command)
+	}
+}
+
+func TestManagerLeavesEventsClaimedElsewhere(t *testing.T) {
+	t.Parallel()
+
+	store := createStore(t, t.TempDir())
+	defer store.Close()
+
+	definition := registrationSaga{expiresAfter: time.Hour, handling: nil}
+
+	// The manager of another instance handles the event first
+	definition.handling = func(subject es.SubjectID) {
+		if _, err := store.Send(definition.Name(), subject, []es.Data{
+			saga.SagaEventHandled{EventID: "1"},
+		}); err != nil {
+			t.Error("Send failed with err:", err)
+		}
+	}
+
+	dispatch, commands := recordCommands()
+	manager := createManager(t, definition, store, dispatch)
+	defer manager.Close()
+
+	if err := manager.Handle(context.Background(), createEvent("1", "bob", Registered{})); err != nil {
+		t.Fatal("Handle failed with err:", err)
+	}
+
+	if len(commands) != 0 {
+		t.Errorf("expected the event to be left to the other manager but got %d commands", len(commands))
+	}
+
+	events, err := store.Concerning("bob")
+	if err != nil {
+		t.Fatal("Concerning failed with err:", err)
+	}
+
+	if len(events) != 1 {
+		t.Errorf("expected only the event of the other manager but got %d events", len(events))
+	}
+}
+
+func TestManagerDispatchesFailedCommandsAgain(t *testing.T) {
+	t.Parallel()
+
+	store := createStore(t, t.TempDir())
+	defer store.Close()
+
+	definition := registrationSaga{expiresAfter: time.Hour, handling: nil}
+
+	// The first manager claims the event but cannot dispatch its command
+	failing := createManager(t, definition, store, func(ctx context.Context, command mediator.Request) error {
+		return errors.New("bus is unavailable")
+	})
+	if err := failing.Handle(context.Background(), createEvent("1", "bob", Registered{})); err == nil {
+		t.Fatal("expected dispatching the command to fail")
+	}
+
+	failing.Close()
+
+	// The next manager dispatches the command when it resumes
+	stream, err := memory.CreateMemoryStream(memory.CreateBroker(), memory.DefaultOptions(topic))
+	if err != nil {
+		t.Fatal("CreateMemoryStream failed with err:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dispatch, commands := recordCommands()
+	manager := createManager(t, definition, store, dispatch)
+	defer manager.Close()
+
+	errs := manager.Run(ctx, stream, topic)
+
+	go func() {
+		for err := range errs {
+			t.Error("Run failed with err:", err)
+		}
+	}()
+
+	if command := receive(t, commands); command != (SendConfirmation{Subject: "bob"}) {
+		t.Errorf("expected the confirmation to be sent but got %v", command)
+	}
+
+	// Redelivering the event neither handles it nor dispatches the command again
+	if err := manager.Handle(ctx, createEvent("1", "bob", Registered{})); err != nil {
+		t.Fatal("Handle failed with err:", err)
+	}
+
+	if len(commands) != 0 {
+		t.Errorf("expected the command to be dispatched once but got %d more", len(commands))
+	}
+}
@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"encoding/json"
+
+	"github.com/hywmongous/example-service/pkg/es"
+)
+
+// ID identifies a schedule. It is the subject of the events of the schedule,
+// hence it should tell what the schedule is for, such as "session-expiry/<id>".
+type ID string
+
+// Kind is whether a schedule dispatches a command or records an event.
+type Kind string
+
+const (
+	CommandKind = Kind("command")
+	EventKind   = Kind("event")
+)
+
+// The events which the scheduler records for the schedules.
+type (
+	ScheduleCreated struct {
+		Kind Kind
+		// The title of the payload, whose type must be registered
+		Name    es.Title
+		Payload json.RawMessage
+		// The producer and subject which scheduled events are recorded for
+		Producer es.ProducerID
+		Subject  es.SubjectID
+		// Unix nanoseconds
+		Due int64
+	}
+	// ScheduleFired claims the schedule, such that only one scheduler fires it.
+	ScheduleFired struct {
+		Attempt int
+		// Unix nanoseconds until which the command is being dispatched,
+		// after which it is dispatched again. It is zero for events
+		Lease int64
+	}
+	// ScheduleDispatched ends a schedule whose command is dispatched.
+	ScheduleDispatched struct {
+		Attempt int
+	}
+	// ScheduleRetried makes a schedule whose command failed due again.
+	ScheduleRetried struct {
+		Attempt int
+		Error   string
+		// Unix nanoseconds
+		Due int64
+	}
+	// ScheduleFailed ends a schedule which cannot fire.
+	ScheduleFailed struct {
+		Attempt int
+		Error   string
+	}
+	ScheduleCancelled struct {
+		Reason string
+	}
+)
+
+type status int
+
+const (
+	statusPending status = iota
+	// The command is fired but not yet dispatched, which it is due again once the lease expires
+	statusDispatching
+	statusFired
+	statusFailed
+	statusCancelled
+)
+
+// schedule is the state of a schedule, which is rebuilt from its events.
+type schedule struct {
+	id       ID
+	created  ScheduleCreated
+	status   status
+	due      int64
+	attempts int
+	// The version which the next event of the schedule must have
+	next es.Version
+}
+
+var (
+	createdTitle    = es.CreateTitleForData(ScheduleCreated{})
+	firedTitle      = es.CreateTitleForData(ScheduleFired{})
+	dispatchedTitle = es.CreateTitleForData(ScheduleDispatched{})
+	retriedTitle    = es.CreateTitleForData(ScheduleRetried{})
+	failedTitle     = es.CreateTitleForData(ScheduleFailed{})
+	cancelledTitle  = es.CreateTitleForData(ScheduleCancelled{})
+)
+
+func rebuild(id ID, events []es.Event) (*schedule, error) {
+	schedule := &schedule{
+		id:       id,
+		created:  ScheduleCreated{},
+		status:   statusPending,
+		due:      0,
+		attempts: 0,
+		next:     es.InitialEventVersion,
+	}
+
+	for _, event := range events {
+		if err := schedule.apply(event); err != nil {
+			return nil, err
+		}
+	}
+
+	return schedule, nil
+}
+
+// pending is whether the schedule is yet to fire, or to be dispatched again.
+func (schedule *schedule) pending() bool {
+	return schedule.status == statusPending || schedule.status == statusDispatching
+}
+
+func (schedule *schedule) apply(event es.Event) error {
+	schedule.next = event.Version + 1
+
+	switch event.Name {
+	case createdTitle:
+		if err := event.Unmarshal(&schedule.created); err != nil {
+			return err
+		}
+
+		schedule.due = schedule.created.Due
+	case firedTitle:
+		var fired ScheduleFired
+		if err := event.Unmarshal(&fired); err != nil {
+			return err
+		}
+
+		schedule.attempts = fired.Attempt
+
+		// The commands which were fired before they were leased are done
+		if fired.Lease == 0 {
+			schedule.status = statusFired
+		} else {
+			schedule.status = statusDispatching
+			schedule.due = fired.Lease
+		}
+	case dispatchedTitle:
+		schedule.status = statusFired
+	case retriedTitle:
+		var retried ScheduleRetried
+		if err := event.Unmarshal(&retried); err != nil {
+			return err
+		}
+
+		schedule.status = statusPending
+		schedule.due = retried.Due
+	case failedTitle:
+		schedule.status = statusFailed
+	case cancelledTitle:
+		schedule.status = statusCancelled
+	}
+
+	return nil
+}
@@ -0,0 +1,530 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+)
+
+// Dispatcher sends the commands of the schedules.
+type Dispatcher func(ctx context.Context, command mediator.Request) error
+
+type Options struct {
+	// How often the schedules are read from the store when none are due sooner,
+	// which picks up the schedules created by the schedulers of other instances
+	PollInterval time.Duration
+	// How long a command which failed waits before it is dispatched again
+	RetryDelay time.Duration
+	// The number of times a command is dispatched before the schedule fails
+	MaxAttempts int
+	// How long a command which is fired may take to be dispatched before it is
+	// dispatched again, since the scheduler which fired it may have stopped
+	Lease time.Duration
+}
+
+// Scheduler dispatches commands and records events at a future time. The
+// schedules are kept as events in the store, such that they survive restarts.
+// Firing a schedule records its claim with an optimistic version check, hence
+// only one of the schedulers of several instances which race for it fires it,
+// provided the store ships atomically with the check as es.ErrConcurrencyConflict
+// requires. The mongo store does so through the index of its EnsureIndexes.
+// Scheduled events are recorded along with the claim, so they are recorded
+// exactly once. Commands are claimed with a lease and recorded as dispatched
+// afterwards. A command which is not recorded as dispatched once its lease
+// expires, such as when the scheduler stops while dispatching it, is dispatched
+// again. Hence commands are dispatched at least once, and their handlers must
+// tolerate receiving them more than once.
+type Scheduler struct {
+	store   Store
+	options Options
+
+	// Held while using the stage of the store
+	lock     sync.Mutex
+	payloads *es.Registry
+	wake     chan struct{}
+
+	// The schedules which have not fired, as read from the log of the
+	// schedules up to the position. Held while reading the log
+	indexLock sync.Mutex
+	pending   map[ID]*schedule
+	position  es.Sequence
+}
+
+// Store is the event store of the schedules. The scheduler reads the log
+// of the schedules since it last read it, rather than every schedule,
+// to find the schedules which are due.
+type Store interface {
+	es.EventStore
+	// Log returns at most limit events of the producer after the sequence.
+	Log(producer es.ProducerID, after es.Sequence, limit int) ([]es.SequencedEvent, error)
+}
+
+const (
+	producer = es.ProducerID("scheduler")
+
+	defaultPollInterval = 5 * time.Second
+	defaultRetryDelay   = 30 * time.Second
+	defaultMaxAttempts  = 5
+	defaultLease        = time.Minute
+
+	// The number of events which are read from the log of the schedules at once
+	logBatchSize = 1000
+)
+
+var (
+	ErrInvalidPollInterval     = errors.New("scheduler poll interval must be positive")
+	ErrInvalidRetryDelay       = errors.New("scheduler retry delay must not be negative")
+	ErrInvalidMaxAttempts      = errors.New("scheduler max attempts must be positive")
+	ErrInvalidLease            = errors.New("scheduler lease must be positive")
+	ErrInvalidSchedulerOptions = errors.New("scheduler options are invalid")
+	ErrCouldNotEncodePayload   = errors.New("schedule payload could not be encoded")
+	ErrScheduleExists          = errors.New("schedule with the same id already exists")
+	ErrScheduleNotFound        = errors.New("schedule does not exist")
+	ErrScheduleNotPending      = errors.New("schedule has already fired, failed or been cancelled")
+	ErrCouldNotLoadSchedules   = errors.New("schedules could not be loaded from the event store")
+	ErrCouldNotStoreSchedule   = errors.New("schedule events could not be stored")
+	ErrScheduledCommandFailed  = errors.New("scheduled command could not be dispatched")
+	ErrDispatcherRequired      = errors.New("scheduler requires a dispatcher to fire commands")
+	ErrScheduleChanged         = errors.New("schedule was changed since it was read")
+	ErrLeaseExpired            = errors.New("scheduled command was not dispatched before its lease expired")
+)
+
+func DefaultOptions() Options {
+	return Options{
+		PollInterval: defaultPollInterval,
+		RetryDelay:   defaultRetryDelay,
+		MaxAttempts:  defaultMaxAttempts,
+		Lease:        defaultLease,
+	}
+}
+
+func (options Options) Validate() error {
+	if options.PollInterval <= 0 {
+		return ErrInvalidPollInterval
+	}
+
+	if options.RetryDelay < 0 {
+		return ErrInvalidRetryDelay
+	}
+
+	if options.MaxAttempts < 1 {
+		return ErrInvalidMaxAttempts
+	}
+
+	if options.Lease <= 0 {
+		return ErrInvalidLease
+	}
+
+	return nil
+}
+
+// CreateScheduler creates a scheduler which keeps the schedules in the store.
+// The store must not be used by anything else, since the scheduler uses its stage.
+func CreateScheduler(store Store, options Options) (*Scheduler, error) {
+	if err := options.Validate(); err != nil {
+		return nil, errors.Wrap(err, ErrInvalidSchedulerOptions.Error())
+	}
+
+	return &Scheduler{
+		store:    store,
+		options:  options,
+		lock:     sync.Mutex{},
+		payloads: es.CreateRegistry(),
+		wake:     make(chan struct{}, 1),
+
+		indexLock: sync.Mutex{},
+		pending:   make(map[ID]*schedule),
+		position:  0,
+	}, nil
+}
+
+// Register registers the types of the commands and events which are scheduled,
+// such that the payloads can be decoded when the schedules fire.
+func (scheduler *Scheduler) Register(prototypes ...es.Data) error {
+	return scheduler.payloads.Register(prototypes...)
+}
+
+// ScheduleCommand schedules the command to be dispatched once the due time has come.
+func (scheduler *Scheduler) ScheduleCommand(id ID, due time.Time, command mediator.Request) error {
+	return scheduler.create(id, CommandKind, due, "", "", command)
+}
+
+// ScheduleEvent schedules the event to be recorded for the subject once the due time has come.
+func (scheduler *Scheduler) ScheduleEvent(
+	id ID,
+	due time.Time,
+	eventProducer es.ProducerID,
+	eventSubject es.SubjectID,
+	data es.Data,
+) error {
+	return scheduler.create(id, EventKind, due, eventProducer, eventSubject, data)
+}
+
+// Cancel cancels the schedule, unless it has already fired, failed or been cancelled.
+func (scheduler *Scheduler) Cancel(id ID, reason string) error {
+	schedule, err := scheduler.load(id)
+	if err != nil {
+		return err
+	}
+
+	if schedule.next == es.InitialEventVersion {
+		return errors.Wrap(ErrScheduleNotFound, string(id))
+	}
+
+	if schedule.status != statusPending {
+		return errors.Wrap(ErrScheduleNotPending, string(id))
+	}
+
+	err = scheduler.append(schedule, ScheduleCancelled{Reason: reason})
+	if errors.Is(err, es.ErrConcurrencyConflict) {
+		return errors.Mark(errors.Wrap(err, string(id)), ErrScheduleNotPending)
+	}
+
+	return err
+}
+
+// Run fires the schedules when they are due until the context ends. The errors
+// are reported, and the errors channel is closed once the scheduler stops.
+func (scheduler *Scheduler) Run(ctx context.Context, dispatch Dispatcher) chan error {
+	errs := make(chan error)
+
+	go func() {
+		defer close(errs)
+
+		for {
+			next, err := scheduler.fireDue(ctx, dispatch, time.Now())
+			if err != nil {
+				report(ctx, errs, err)
+			}
+
+			wait := scheduler.options.PollInterval
+			if !next.IsZero() && time.Until(next) < wait {
+				wait = time.Until(next)
+			}
+
+			timer := time.NewTimer(wait)
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+
+				return
+			case <-scheduler.wake:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}()
+
+	return errs
+}
+
+// FireDue fires the schedules which are due at the time, which is useful
+// when the schedules are fired by an external trigger rather than Run.
+func (scheduler *Scheduler) FireDue(ctx context.Context, dispatch Dispatcher, now time.Time) error {
+	_, err := scheduler.fireDue(ctx, dispatch, now)
+
+	return err
+}
+
+// fireDue returns when the next pending schedule is due.
+func (scheduler *Scheduler) fireDue(ctx context.Context, dispatch Dispatcher, now time.Time) (time.Time, error) {
+	due, next, result := scheduler.due(now)
+
+	for _, id := range due {
+		if ctx.Err() != nil {
+			return next, result
+		}
+
+		// The schedule may have changed since the log was read
+		schedule, err := scheduler.load(id)
+		if err != nil {
+			result = errors.CombineErrors(result, err)
+
+			continue
+		}
+
+		if !schedule.pending() {
+			continue
+		}
+
+		if due := time.Unix(0, schedule.due); due.After(now) {
+			if next.IsZero() || due.Before(next) {
+				next = due
+			}
+
+			continue
+		}
+
+		if err := scheduler.fire(ctx, dispatch, schedule); err != nil {
+			result = errors.CombineErrors(result, err)
+		}
+	}
+
+	return next, result
+}
+
+// due reads the log of the schedules since it was last read, and returns the
+// pending schedules which are due at the time and when the next of the others is due.
+func (scheduler *Scheduler) due(now time.Time) ([]ID, time.Time, error) {
+	scheduler.indexLock.Lock()
+	defer scheduler.indexLock.Unlock()
+
+	var result error
+
+	for {
+		entries, err := scheduler.store.Log(producer, scheduler.position, logBatchSize)
+		if err != nil {
+			result = errors.CombineErrors(result, errors.Wrap(err, ErrCouldNotLoadSchedules.Error()))
+
+			break
+		}
+
+		for _, entry := range entries {
+			if err := scheduler.index(entry.Event); err != nil {
+				result = errors.CombineErrors(result, errors.Wrap(err, ErrCouldNotLoadSchedules.Error()))
+			}
+
+			scheduler.position = entry.Sequence
+		}
+
+		if len(entries) < logBatchSize {
+			break
+		}
+	}
+
+	var (
+		due  []ID
+		next time.Time
+	)
+
+	for id, schedule := range scheduler.pending {
+		if at := time.Unix(0, schedule.due); at.After(now) {
+			if next.IsZero() || at.Before(next) {
+				next = at
+			}
+
+			continue
+		}
+
+		due = append(due, id)
+	}
+
+	return due, next, result
+}
+
+// index must be called while holding the index lock. The schedules
+// are forgotten once they are no longer pending.
+func (scheduler *Scheduler) index(event es.Event) error {
+	id := ID(event.Subject)
+
+	schedule, found := scheduler.pending[id]
+	if !found {
+		schedule, _ = rebuild(id, nil)
+	}
+
+	if err := schedule.apply(event); err != nil {
+		return err
+	}
+
+	if schedule.pending() {
+		scheduler.pending[id] = schedule
+	} else {
+		delete(scheduler.pending, id)
+	}
+
+	return nil
+}
+
+func (scheduler *Scheduler) fire(ctx context.Context, dispatch Dispatcher, schedule *schedule) error {
+	payload, err := scheduler.payloads.DecodeJSON(schedule.created.Name, schedule.created.Payload)
+	if err != nil {
+		return scheduler.fail(schedule, schedule.attempts, err)
+	}
+
+	// The scheduler which fired the command stopped before it was dispatched,
+	// which counts as a failed attempt since dispatching it may be what stops it
+	if schedule.status == statusDispatching && schedule.attempts >= scheduler.options.MaxAttempts {
+		return scheduler.fail(schedule, schedule.attempts, ErrLeaseExpired)
+	}
+
+	attempt := schedule.attempts + 1
+
+	if schedule.created.Kind == EventKind {
+		err = scheduler.append(schedule, ScheduleFired{Attempt: attempt, Lease: 0}, scheduledEvent{
+			producer: schedule.created.Producer,
+			subject:  schedule.created.Subject,
+			data:     payload,
+		})
+
+		return ignoreClaimedElsewhere(err)
+	}
+
+	if dispatch == nil {
+		return ErrDispatcherRequired
+	}
+
+	lease := time.Now().Add(scheduler.options.Lease).UnixNano()
+	if err := scheduler.append(schedule, ScheduleFired{Attempt: attempt, Lease: lease}); err != nil {
+		return ignoreClaimedElsewhere(err)
+	}
+
+	schedule.status = statusDispatching
+	schedule.next++
+
+	// The command is dispatched again by another scheduler if the lease expired meanwhile
+	dispatchErr := dispatch(ctx, payload)
+	if dispatchErr == nil {
+		return ignoreClaimedElsewhere(scheduler.append(schedule, ScheduleDispatched{Attempt: attempt}))
+	}
+
+	dispatchErr = errors.Wrap(dispatchErr, ErrScheduledCommandFailed.Error())
+
+	if attempt >= scheduler.options.MaxAttempts {
+		return scheduler.fail(schedule, attempt, dispatchErr)
+	}
+
+	return errors.CombineErrors(dispatchErr, scheduler.append(schedule, ScheduleRetried{
+		Attempt: attempt,
+		Error:   dispatchErr.Error(),
+		Due:     time.Now().Add(scheduler.options.RetryDelay).UnixNano(),
+	}))
+}
+
+func (scheduler *Scheduler) fail(schedule *schedule, attempt int, cause error) error {
+	return errors.CombineErrors(cause, scheduler.append(schedule, ScheduleFailed{
+		Attempt: attempt,
+		Error:   cause.Error(),
+	}))
+}
+
+func (scheduler *Scheduler) create(
+	id ID,
+	kind Kind,
+	due time.Time,
+	eventProducer es.ProducerID,
+	eventSubject es.SubjectID,
+	data es.Data,
+) error {
+	title := es.CreateTitleForData(data)
+
+	if !scheduler.payloads.Registered(title) {
+		return errors.Wrap(es.ErrUnregisteredData, string(title))
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, ErrCouldNotEncodePayload.Error())
+	}
+
+	schedule, err := scheduler.load(id)
+	if err != nil {
+		return err
+	}
+
+	if schedule.next != es.InitialEventVersion {
+		return errors.Wrap(ErrScheduleExists, string(id))
+	}
+
+	err = scheduler.append(schedule, ScheduleCreated{
+		Kind:     kind,
+		Name:     title,
+		Payload:  payload,
+		Producer: eventProducer,
+		Subject:  eventSubject,
+		Due:      due.UnixNano(),
+	})
+	if errors.Is(err, es.ErrConcurrencyConflict) {
+		return errors.Mark(errors.Wrap(err, string(id)), ErrScheduleExists)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// The scheduler may be waiting for a schedule which is due later
+	select {
+	case scheduler.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (scheduler *Scheduler) load(id ID) (*schedule, error) {
+	events, err := scheduler.store.Concerning(es.SubjectID(id))
+	if err != nil && !errors.Is(err, es.ErrNoEvents) {
+		return nil, errors.Wrap(err, ErrCouldNotLoadSchedules.Error())
+	}
+
+	schedule, err := rebuild(id, events)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotLoadSchedules.Error())
+	}
+
+	return schedule, nil
+}
+
+// scheduledEvent is recorded for another subject along with the event of the schedule.
+type scheduledEvent struct {
+	producer es.ProducerID
+	subject  es.SubjectID
+	data     es.Data
+}
+
+// append ships the event of the schedule, and the scheduled events, at once. It
+// fails with es.ErrConcurrencyConflict unless the event of the schedule follows
+// the events which the schedule was rebuilt from, such that only one of the
+// schedulers which read the same events can append to the schedule.
+func (scheduler *Scheduler) append(schedule *schedule, data es.Data, scheduled ...scheduledEvent) error {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	// The stage is only used within the lock, so it is cleared whether shipping succeeds or not
+	defer scheduler.store.Clear()
+
+	subject := es.SubjectID(schedule.id)
+
+	if err := scheduler.store.Load(producer, subject, data); err != nil {
+		return errors.Wrap(err, ErrCouldNotStoreSchedule.Error())
+	}
+
+	stage := scheduler.store.Stage()
+	if staged, _ := stage.FirstEvent(subject); staged.Version != schedule.next {
+		return errors.Mark(ErrScheduleChanged, es.ErrConcurrencyConflict)
+	}
+
+	for _, event := range scheduled {
+		if err := scheduler.store.Load(event.producer, event.subject, event.data); err != nil {
+			return errors.Wrap(err, ErrCouldNotStoreSchedule.Error())
+		}
+	}
+
+	if err := scheduler.store.Ship(context.Background()); err != nil {
+		return errors.Wrap(err, ErrCouldNotStoreSchedule.Error())
+	}
+
+	return nil
+}
+
+// ignoreClaimedElsewhere ignores the conflicts of claiming a schedule,
+// since they mean that another scheduler fired or cancelled it.
+func ignoreClaimedElsewhere(err error) error {
+	if errors.Is(err, es.ErrConcurrencyConflict) {
+		return nil
+	}
+
+	return err
+}
+
+func report(ctx context.Context, errs chan error, err error) {
+	select {
+	case errs <- err:
+	case <-ctx.Done():
+	}
+}
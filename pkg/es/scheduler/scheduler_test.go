@@ -0,0 +1,200 @@
+package scheduler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hywmongous/example-service/pkg/es"
+	"github.com/hywmongous/example-service/pkg/es/file"
+	"github.com/hywmongous/example-service/pkg/es/mediator"
+	"github.com/hywmongous/example-service/pkg/es/scheduler"
+)
+
+type (
+	ExpireSession struct {
+		SessionID string
+	}
+	SessionExpired struct {
+		SessionID string
+	}
+)
+
+var ErrUnavailable = errors.New("service is unavailable")
+
+func createStore(t *testing.T) *file.EventStore {
+	t.Helper()
+
+	store, err := file.CreateFileEventStore(file.DefaultOptions(t.TempDir()))
+	if err != nil {
+		t.Fatal("CreateFileEventStore failed with err:", err)
+	}
+
+	return store
+}
+
+// unlistedStore fails listing the events of a producer, such
+// that the schedulers must find the due schedules in the log.
+type unlistedStore struct {
+	*file.EventStore
+}
+
+func (store unlistedStore) By(producer es.ProducerID) ([]es.Event, error) {
+	return nil, errors.New("listing every event of the producer is too slow")
+}
+
+func createScheduler(t *testing.T, store *file.EventStore, options scheduler.Options) *scheduler.Scheduler {
+	t.Helper()
+
+	created, err := scheduler.CreateScheduler(unlistedStore{EventStore: store}, options)
+	if err != nil {
+		t.Fatal("CreateScheduler failed with err:", err)
+	}
+
+	if err := created.Register(ExpireSession{}, SessionExpired{}); err != nil {
+		t.Fatal("Register failed with err:", err)
+	}
+
+	return created
+}
+
+func recordCommands(err error) (scheduler.Dispatcher, *[]mediator.Request) {
+	commands := make([]mediator.Request, 0)
+
+	return func(ctx context.Context, command mediator.Request) error {
+		commands = append(commands, command)
+
+		return err
+	}, &commands
+}
+
+func TestSchedulerFiresOnceAcrossRestarts(t *testing.T) {
+	t.Parallel()
+
+	store := createStore(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+	dispatch, commands := recordCommands(nil)
+	first := createScheduler(t, store, scheduler.DefaultOptions())
+
+	if err := first.ScheduleCommand("expire/1", now, ExpireSession{SessionID: "1"}); err != nil {
+		t.Fatal("ScheduleCommand failed with err:", err)
+	}
+
+	if err := first.ScheduleCommand("expire/1", now, ExpireSession{SessionID: "1"}); !errors.Is(err, scheduler.ErrScheduleExists) {
+		t.Errorf("expected scheduling the same id twice to fail but got %v", err)
+	}
+
+	if err := first.ScheduleCommand("expire/2", now, ExpireSession{SessionID: "2"}); err != nil {
+		t.Fatal("ScheduleCommand failed with err:", err)
+	}
+
+	if err := first.ScheduleEvent("expired/3", now, "sessions", "3", SessionExpired{SessionID: "3"}); err != nil {
+		t.Fatal("ScheduleEvent failed with err:", err)
+	}
+
+	// The condition of the second schedule no longer holds
+	if err := first.Cancel("expire/2", "logged out"); err != nil {
+		t.Fatal("Cancel failed with err:", err)
+	}
+
+	if err := first.FireDue(ctx, dispatch, now); err != nil {
+		t.Fatal("FireDue failed with err:", err)
+	}
+
+	// The scheduler of the next run does not fire the schedules again
+	restarted := createScheduler(t, store, scheduler.DefaultOptions())
+	if err := restarted.FireDue(ctx, dispatch, now.Add(time.Hour)); err != nil {
+		t.Fatal("FireDue failed with err:", err)
+	}
+
+	if len(*commands) != 1 || (*commands)[0] != (ExpireSession{SessionID: "1"}) {
+		t.Errorf("expected the first session to expire once but got %v", *commands)
+	}
+
+	if err := restarted.Cancel("expire/1", "logged out"); !errors.Is(err, scheduler.ErrScheduleNotPending) {
+		t.Errorf("expected cancelling a fired schedule to fail but got %v", err)
+	}
+
+	events, err := store.Concerning("3")
+	if err != nil || len(events) != 1 || events[0].Name != es.CreateTitleForData(SessionExpired{}) {
+		t.Errorf("expected the scheduled event to be recorded once but got %v and %v", events, err)
+	}
+}
+
+func TestSchedulerRetriesFailedCommands(t *testing.T) {
+	t.Parallel()
+
+	store := createStore(t)
+	defer store.Close()
+
+	options := scheduler.DefaultOptions()
+	options.RetryDelay = time.Minute
+	options.MaxAttempts = 2
+
+	ctx := context.Background()
+	now := time.Now()
+	dispatch, commands := recordCommands(ErrUnavailable)
+	scheduler := createScheduler(t, store, options)
+
+	if err := scheduler.ScheduleCommand("expire/1", now.Add(time.Minute), ExpireSession{SessionID: "1"}); err != nil {
+		t.Fatal("ScheduleCommand failed with err:", err)
+	}
+
+	if err := scheduler.FireDue(ctx, dispatch, now); err != nil || len(*commands) != 0 {
+		t.Fatalf("expected nothing to fire before the due time but got %v and %v", *commands, err)
+	}
+
+	// Every retry is due a minute after the previous attempt failed
+	for hours := 1; hours <= 3; hours++ {
+		err := scheduler.FireDue(ctx, dispatch, now.Add(time.Duration(hours)*time.Hour))
+		if hours <= options.MaxAttempts && !errors.Is(err, ErrUnavailable) {
+			t.Errorf("expected attempt %d to fail but got %v", hours, err)
+		}
+	}
+
+	if len(*commands) != options.MaxAttempts {
+		t.Errorf("expected %d attempts but got %d", options.MaxAttempts, len(*commands))
+	}
+}
+
+func TestSchedulerDispatchesCommandsAgainOnceTheLeaseExpires(t *testing.T) {
+	t.Parallel()
+
+	store := createStore(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+	options := scheduler.DefaultOptions()
+	dispatch, commands := recordCommands(nil)
+	schedules := createScheduler(t, store, options)
+
+	if err := schedules.ScheduleCommand("expire/1", now, ExpireSession{SessionID: "1"}); err != nil {
+		t.Fatal("ScheduleCommand failed with err:", err)
+	}
+
+	// Another scheduler fired the command but stopped before it was dispatched
+	if _, err := store.Send("scheduler", "expire/1", []es.Data{
+		scheduler.ScheduleFired{Attempt: 1, Lease: now.Add(options.Lease).UnixNano()},
+	}); err != nil {
+		t.Fatal("Send failed with err:", err)
+	}
+
+	if err := schedules.FireDue(ctx, dispatch, now); err != nil || len(*commands) != 0 {
+		t.Fatalf("expected nothing to fire before the lease expires but got %v and %v", *commands, err)
+	}
+
+	for _, later := range []time.Duration{2 * options.Lease, time.Hour} {
+		if err := schedules.FireDue(ctx, dispatch, now.Add(later)); err != nil {
+			t.Fatal("FireDue failed with err:", err)
+		}
+	}
+
+	if len(*commands) != 1 || (*commands)[0] != (ExpireSession{SessionID: "1"}) {
+		t.Errorf("expected the session to expire once but got %v", *commands)
+	}
+}
@@ -61,4 +61,9 @@ type EventStore interface {
 var (
 	ErrNoEvents    = errors.New("event store does not have any events for the given subject")
 	ErrNoSnapshots = errors.New("event store does not have any snapshots for the given subject")
+	// Stores mark the errors of shipping stages which are based on outdated
+	// versions with this error. Retrying with the latest events may succeed.
+	// The check must be atomic with the shipping, such that only one of the
+	// stages which race for the same version of a subject is shipped.
+	ErrConcurrencyConflict = errors.New("event store stage conflicts with concurrently shipped events")
 )
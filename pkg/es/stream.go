@@ -7,7 +7,9 @@ import (
 
 type EventStream interface {
 	Publish(events []Event) error
-	Subscribe(ctx context.Context, topic Topic) (chan Event, chan error)
+	// The deliveries must be acknowledged, otherwise
+	// the events are redelivered to the next subscriber
+	Subscribe(ctx context.Context, topic Topic) (chan Delivery, chan error)
 }
 
 type (
@@ -22,6 +22,7 @@ type (
 	SubjectID  string
 	Version    uint
 	Timestamp  int64
+	Sequence   uint64
 	Data       interface{}
 )
 
@@ -0,0 +1,121 @@
+// Command bloomgen builds a bloom filter from a list with one entry per
+// line, such that the list can be bundled without bundling the entries.
+// The list is either a file or downloaded, hence it need not be committed.
+// Empty lines and lines starting with # are skipped.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hywmongous/example-service/pkg/bloom"
+)
+
+const (
+	defaultFalsePositiveRate = 0.001
+	filePermissions          = 0o644
+	downloadTimeout          = time.Minute
+)
+
+func main() {
+	in := flag.String("in", "", "the list with one entry per line")
+	url := flag.String("url", "", "the url to download the list from instead")
+	limit := flag.Int("limit", 0, "the number of entries to take from the start of the list, or all when zero")
+	out := flag.String("out", "", "the file to write the filter to")
+	rate := flag.Float64("rate", defaultFalsePositiveRate, "the false positive rate of the filter")
+	flag.Parse()
+
+	if (*in == "") == (*url == "") || *out == "" || *limit < 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	list, err := openList(*in, *url)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer list.Close()
+
+	entries, err := readEntries(list, *limit)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	filter, err := bloom.Create(len(entries), *rate)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		filter.Add([]byte(entry))
+	}
+
+	data, err := filter.MarshalBinary()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(*out, data, filePermissions); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("wrote", len(entries), "entries in", len(data), "bytes to", *out)
+}
+
+func openList(path string, url string) (io.ReadCloser, error) {
+	if path != "" {
+		return os.Open(path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+
+		return nil, fmt.Errorf("downloading %s responded with %s", url, response.Status)
+	}
+
+	// The whole list is read before the deadline cancels the body
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	return io.NopCloser(bytes.NewReader(body)), err
+}
+
+// readEntries reads the entries in the order of the list, which
+// for password lists is the most common first, up to the limit.
+func readEntries(list io.Reader, limit int) ([]string, error) {
+	entries := make([]string, 0)
+	scanner := bufio.NewScanner(list)
+
+	for scanner.Scan() && (limit == 0 || len(entries) < limit) {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}